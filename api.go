@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// API v1 (/api/v1/...) всегда отвечает JSON. Ошибка приходит в едином конверте
+// {"error": {"code": "...", "message": "...", "request_id": "..."}}: code — стабильный
+// машиночитаемый код, message — текст для человека на русском.
+// Старые адреса (/api/book, /admin/...) отвечают как раньше, а JSON вместо HTML-страницы
+// отдают, если клиент просит его в заголовке Accept.
+
+const apiPrefix = "/api/v1/"
+
+// apiError — ошибка в ответе API v1
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	// Нарушения схемы запроса, по одному на поле
+	Details []string `json:"details,omitempty"`
+}
+
+// isAPIRequest сообщает, что запрос пришел в API v1
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiPrefix)
+}
+
+// wantsJSON выбирает формат ответа: API v1 — всегда JSON, остальные адреса — по заголовку Accept
+// (application/json предпочтительнее text/html). X-Requested-With: XMLHttpRequest
+// поддерживается для скриптов, написанных до появления API v1.
+func wantsJSON(r *http.Request) bool {
+	if isAPIRequest(r) || r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return true
+	}
+	jsonQ, htmlQ := -1.0, -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = q
+		case "text/html":
+			htmlQ = q
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
+
+// writeJSON отдает значение v в формате JSON с кодом status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError отдает ошибку: клиентам JSON — в конверте с кодом code, остальным — текстом, как раньше
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if !wantsJSON(r) {
+		http.Error(w, message, status)
+		return
+	}
+	writeJSON(w, status, map[string]apiError{
+		"error": {Code: code, Message: message, RequestID: requestID(r.Context())},
+	})
+}
+
+// writeInternalError отдает 500 без подробностей: причина пишется в журнал вызывающим кодом
+func writeInternalError(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusInternalServerError, "internal_error", "Внутренняя ошибка сервера")
+}
+
+// writeCreated отдает созданный ресурс: в API v1 с кодом 201, в старых адресах — 200, как раньше
+func writeCreated(w http.ResponseWriter, r *http.Request, v interface{}) {
+	status := http.StatusOK
+	if isAPIRequest(r) {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, v)
+}
+
+// writeDeleted подтверждает удаление: в API v1 — 204 без тела, в старых адресах — сообщением
+func writeDeleted(w http.ResponseWriter, r *http.Request, message string) {
+	if isAPIRequest(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": message})
+}
+
+// Коды ошибок проверки бронирования в API. Причины для метрик (BookingError.Cause)
+// названы раньше и остаются прежними, чтобы не ломать графики.
+var bookingCauseCodes = map[string]string{
+	"bad_phone":  "invalid_phone",
+	"bad_email":  "invalid_email",
+	"bad_date":   "invalid_date",
+	"bad_time":   "invalid_time",
+	"bad_guests": "invalid_guests",
+}
+
+// code возвращает машиночитаемый код ошибки проверки бронирования
+func (e *BookingError) code() string {
+	switch {
+	case e.Reason != "":
+		return e.Reason
+	case bookingCauseCodes[e.Cause] != "":
+		return bookingCauseCodes[e.Cause]
+	case e.Cause != "":
+		return e.Cause
+	}
+	return "invalid_request"
+}
+
+// writeBookingConflict отдает отказ из-за занятости: дубликат, номер на другое имя, нет столиков
+// или статус уже изменился. Возвращает false, если err — другая ошибка.
+func writeBookingConflict(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, ErrDuplicateBooking):
+		writeError(w, r, http.StatusConflict, "duplicate_booking", ErrDuplicateBooking.Error())
+	case errors.Is(err, ErrPhoneNameMismatch):
+		writeError(w, r, http.StatusConflict, "phone_name_mismatch", "Этот номер уже зарегистрирован на другое имя")
+	case errors.Is(err, ErrNoTableAvailable):
+		writeError(w, r, http.StatusConflict, "no_table_available", "На выбранное время нет свободных столиков")
+	case errors.Is(err, ErrStatusChanged):
+		writeError(w, r, http.StatusConflict, "status_changed", ErrStatusChanged.Error())
+	default:
+		return false
+	}
+	return true
+}
+
+// handleAPINotFound и handleAPIMethodNotAllowed отвечают на неизвестные адреса и методы:
+// в API v1 — конвертом с ошибкой, в остальных адресах — как net/http по умолчанию
+func handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, "not_found", "Адрес не найден")
+}
+
+func handleAPIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Метод не поддерживается")
+}
+
+// apiBooking — бронирование в ответах API v1: число гостей отдается числом,
+// а ссылка управления — только сразу после создания
+type apiBooking struct {
+	*Booking
+	Guests      int    `json:"guests"`
+	ManageToken string `json:"manage_token,omitempty"`
+	ManageURL   string `json:"manage_url,omitempty"`
+}
+
+func newAPIBooking(b *Booking) apiBooking {
+	guests, _ := strconv.Atoi(b.Guests)
+	view := apiBooking{Booking: b, Guests: guests}
+	if b.ManageToken != "" {
+		view.ManageToken = b.ManageToken
+		view.ManageURL = "/manage/" + b.ManageToken
+	}
+	return view
+}
+
+func newAPIBookings(bookings []Booking) []apiBooking {
+	views := make([]apiBooking, len(bookings))
+	for i := range bookings {
+		views[i] = newAPIBooking(&bookings[i])
+	}
+	return views
+}
+
+// handleAPIRestaurants — рестораны, которые принимают бронирования
+func handleAPIRestaurants(w http.ResponseWriter, r *http.Request) {
+	all, err := db.GetRestaurants()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении ресторанов", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	restaurants := []Restaurant{}
+	for _, rest := range all {
+		if rest.Active {
+			restaurants = append(restaurants, rest)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"restaurants": restaurants})
+}
+
+// apiBookingRequest — заявка на бронирование в API v1: в отличие от формы на сайте, число гостей — число
+type apiBookingRequest struct {
+	Name     string `json:"name" schema:"required"`
+	Phone    string `json:"phone" schema:"required"`
+	Email    string `json:"email"`
+	Date     string `json:"date" schema:"required,format=date"`
+	Time     string `json:"time" schema:"required,format=time"`
+	Guests   int    `json:"guests" schema:"required,min=1"`
+	Comments string `json:"comments"`
+}
+
+// handleAPICreateBooking — бронирование гостем: те же проверки, что и у формы на сайте
+func handleAPICreateBooking(w http.ResponseWriter, r *http.Request) {
+	var data apiBookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+		return
+	}
+	guests := ""
+	if data.Guests != 0 {
+		guests = strconv.Itoa(data.Guests)
+	}
+
+	booking, err := createBooking(r, currentRestaurant(r), BookingRequest{
+		Name: data.Name, Phone: data.Phone, Email: data.Email,
+		Date: data.Date, Time: data.Time, Guests: guests, Comments: data.Comments,
+	}, "api")
+	if err != nil {
+		if !writeBookingError(w, r, err) && !writeBookingConflict(w, r, err) {
+			writeInternalError(w, r)
+		}
+		return
+	}
+	// Перечитываем бронирование, чтобы отдать его так же, как в списке (с временем создания)
+	if stored, err := db.GetBookingByID(booking.ID); err == nil {
+		stored.ManageToken = booking.ManageToken
+		booking = stored
+	}
+	writeCreated(w, r, newAPIBooking(booking))
+}
+
+// apiBookingPage — страница списка бронирований; next_cursor передается в ?cursor= за следующей страницей
+type apiBookingPage struct {
+	Bookings   []apiBooking `json:"bookings"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// handleAPIBookings — бронирования выбранного ресторана с теми же фильтрами, что в админ-панели
+func handleAPIBookings(w http.ResponseWriter, r *http.Request) {
+	q, err := parseBookingQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	page, err := db.SearchBookings(currentRestaurant(r).ID, q)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении бронирований", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiBookingPage{Bookings: newAPIBookings(page.Bookings), NextCursor: page.NextCursor})
+}
+
+// handleAPIBooking — одно бронирование выбранного ресторана
+func handleAPIBooking(w http.ResponseWriter, r *http.Request) {
+	booking, ok := restaurantBooking(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIBooking(booking))
+}
+
+// restaurantBooking загружает бронирование {id} выбранного ресторана или отвечает ошибкой
+func restaurantBooking(w http.ResponseWriter, r *http.Request) (*Booking, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Неверный формат ID")
+		return nil, false
+	}
+	booking, err := db.GetBookingByID(id)
+	if err != nil || booking.RestaurantID != currentRestaurant(r).ID {
+		writeError(w, r, http.StatusNotFound, "not_found", "Бронирование не найдено")
+		return nil, false
+	}
+	return booking, true
+}
+
+// handleAPITables — схема зала выбранного ресторана
+func handleAPITables(w http.ResponseWriter, r *http.Request) {
+	tables, err := db.GetTables(currentRestaurant(r).ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении столиков", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"tables": tables})
+}
+
+// handleAPIUsers — сотрудники, которых видит текущий пользователь
+func handleAPIUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := visibleUsers(currentUser(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении пользователей", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"users": users})
+}
+
+// loginRequest — учетные данные сотрудника
+type loginRequest struct {
+	Username string `json:"username" schema:"required"`
+	Password string `json:"password" schema:"required"`
+}
+
+// apiSession — выданный токен сессии и его владелец
+type apiSession struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      *User     `json:"user"`
+}
+
+// handleAPILogin выдает токен сессии для заголовка Authorization: Bearer <токен>
+func handleAPILogin(w http.ResponseWriter, r *http.Request) {
+	var data loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+		return
+	}
+
+	user, err := db.AuthenticateUser(data.Username, data.Password)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при проверке учетных данных", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if user == nil {
+		slog.WarnContext(r.Context(), "Неверные учетные данные", "username", data.Username)
+		writeError(w, r, http.StatusUnauthorized, "invalid_credentials", "Неверные имя пользователя или пароль")
+		return
+	}
+	if err := db.DeleteExpiredSessions(); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при удалении истекших сессий", "error", err)
+	}
+	token, expiresAt, err := db.CreateSession(user.ID, clientIP(r), r.UserAgent(), config.SessionTTL)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при создании сессии", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Вход через API", "user_id", user.ID, "username", user.Username)
+	writeCreated(w, r, apiSession{Token: token, ExpiresAt: expiresAt, User: user})
+}
+
+// handleAPILogout завершает сессию, с которой пришел запрос
+func handleAPILogout(w http.ResponseWriter, r *http.Request) {
+	if err := db.DeleteSession(sessionToken(r)); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при удалении сессии", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User — учетная запись сотрудника
+type User struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Role      Role      `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Рестораны, в которых работает сотрудник; владельцу доступны все рестораны сети
+	Restaurants []int `json:"restaurants"`
+}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+const sessionCookieName = "session"
+
+// Хэш несуществующего пароля для проверки входа неизвестных пользователей
+var dummyPasswordHash, _ = hashPassword("dinebook-dummy-password")
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("ошибка хэширования пароля: %v", err)
+	}
+	return string(hash), nil
+}
+
+// checkPassword сравнивает пароль с сохраненным хэшем. Второе значение сообщает,
+// что пароль хранился в открытом виде и его нужно перехэшировать.
+func checkPassword(hash, password string) (ok bool, legacy bool) {
+	if strings.HasPrefix(hash, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1, true
+}
+
+// newToken генерирует случайный токен (сессии или ссылки для гостя) и его хэш для хранения в базе
+func newToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("ошибка генерации токена: %v", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashSessionToken — хэш токена сессии для хранения в базе. Если задан SessionSecret,
+// хэш подписывается им (HMAC-SHA256), и утечка таблицы сессий без ключа не позволяет подделать вход.
+func hashSessionToken(token string) string {
+	if config.SessionSecret == "" {
+		return hashToken(token)
+	}
+	mac := hmac.New(sha256.New, []byte(config.SessionSecret))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// clientIP возвращает адрес клиента без порта
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (db *Database) CreateSession(userID int, ip, userAgent string, ttl time.Duration) (string, time.Time, error) {
+	defer observeQuery("CreateSession", time.Now())
+	token, _, err := newToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	hash := hashSessionToken(token)
+	if len(userAgent) > 255 {
+		// Обрезаем по границе символа, чтобы не сохранить половину многобайтового символа UTF-8
+		cut := 255
+		for cut > 0 && !utf8.RuneStart(userAgent[cut]) {
+			cut--
+		}
+		userAgent = userAgent[:cut]
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	_, err = db.Exec(`
+		INSERT INTO sessions (token_hash, user_id, ip, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, hash, userID, ip, userAgent, expiresAt.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("ошибка создания сессии: %v", err)
+	}
+	return token, expiresAt, nil
+}
+
+// GetSessionUser находит пользователя по токену действующей сессии; nil, если сессии нет или она истекла
+func (db *Database) GetSessionUser(token string) (*User, error) {
+	defer observeQuery("GetSessionUser", time.Now())
+	var user User
+	err := db.QueryRow(`
+		SELECT u.id, u.username, u.role, u.disabled, u.created_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > $2 AND u.disabled = false
+	`, hashSessionToken(token), time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&user.ID, &user.Username, &user.Role, &user.Disabled, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки сессии: %v", err)
+	}
+	if err := db.attachUserRestaurants([]*User{&user}); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (db *Database) DeleteSession(token string) error {
+	defer observeQuery("DeleteSession", time.Now())
+	_, err := db.Exec(`DELETE FROM sessions WHERE token_hash = $1`, hashSessionToken(token))
+	return err
+}
+
+// DeleteUserSessions завершает все сессии пользователя
+func (db *Database) DeleteUserSessions(userID int) error {
+	defer observeQuery("DeleteUserSessions", time.Now())
+	_, err := db.Exec(`DELETE FROM sessions WHERE user_id = $1`, userID)
+	return err
+}
+
+func (db *Database) DeleteExpiredSessions() error {
+	defer observeQuery("DeleteExpiredSessions", time.Now())
+	_, err := db.Exec(`DELETE FROM sessions WHERE expires_at <= $1`, time.Now().UTC().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// currentUser возвращает пользователя, которого authMiddleware поместил в контекст запроса
+func currentUser(r *http.Request) *User {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	return user
+}
+
+func withUser(r *http.Request, user *User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+}
+
+func setSessionCookie(w http.ResponseWriter, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   config.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expiresAt,
+		MaxAge:   int(time.Until(expiresAt).Seconds()),
+	})
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   config.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+}
+
+// sessionToken возвращает токен сессии из cookie или, для клиентов API, из заголовка Authorization: Bearer
+func sessionToken(r *http.Request) string {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Slot — время начала визита и возможность его забронировать
+type Slot struct {
+	Time      string `json:"time"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+	// Full — время подходит, но все столики заняты: можно встать в лист ожидания
+	Full bool `json:"full,omitempty"`
+}
+
+// computeAvailability рассчитывает доступность слотов ресторана на дату для компании из guests человек.
+// Каждый слот проходит ту же проверку, что и новое бронирование.
+func computeAvailability(rest *Restaurant, date string, guests int, schedule DaySchedule, tables []Table, occupancies []tableOccupancy) []Slot {
+	duration := rest.DiningDuration()
+
+	slots := []Slot{}
+	for _, timeStr := range schedule.slotTimes(rest.SlotInterval(), duration) {
+		slot := Slot{Time: timeStr}
+		if err := validateBookingSlot(rest, date, timeStr, guests, schedule); err != nil {
+			slot.Reason = err.Error()
+		} else {
+			start, _ := bookingStart(date, timeStr)
+			if assignTables(tables, busyAt(occupancies, start, start.Add(duration)), guests) == nil {
+				slot.Reason = ErrNoTableAvailable.Error()
+				slot.Full = true
+			} else {
+				slot.Available = true
+			}
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// availabilityResponse — слоты на дату; ClosedReason объясняет гостю, почему слотов нет
+type availabilityResponse struct {
+	Date         string `json:"date"`
+	Guests       int    `json:"guests"`
+	Slots        []Slot `json:"slots"`
+	ClosedReason string `json:"closed_reason,omitempty"`
+}
+
+func handleAvailability(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if _, err := parseBookingDate(date); err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	guests, err := parseGuests(r.URL.Query().Get("guests"))
+	if err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+
+	rest := currentRestaurant(r)
+	schedule, err := db.GetDaySchedule(rest.ID, date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении расписания", "date", date, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	tables, err := db.GetTables(rest.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении столиков", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	// При переносе бронирования по ссылке управления его собственные столики считаются свободными
+	excludeID := 0
+	if token := r.URL.Query().Get("token"); token != "" {
+		booking, err := db.GetBookingByToken(token)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при получении бронирования по ссылке", "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		if booking != nil && booking.RestaurantID == rest.ID {
+			excludeID = booking.ID
+		}
+	}
+
+	// Поздние визиты могут закончиться уже на следующие сутки
+	day, _ := parseBookingDate(date)
+	occupancies, err := db.TableOccupancies(rest.ID, day, day.AddDate(0, 0, 2), excludeID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении занятости столиков", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := availabilityResponse{
+		Date:   date,
+		Guests: guests,
+		Slots:  computeAvailability(rest, date, guests, schedule, tables, occupancies),
+	}
+	// Объясняем гостю, почему на дату нет слотов
+	if schedule.Closed {
+		response.ClosedReason = "Ресторан закрыт: " + schedule.Reason
+	} else if len(schedule.Periods) == 0 {
+		response.ClosedReason = "Ресторан не работает в этот день"
+	}
+	json.NewEncoder(w).Encode(response)
+}
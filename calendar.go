@@ -0,0 +1,366 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// Календари в формате iCalendar (RFC 5545). Сотрудник подписывается на ленту своих будущих
+// бронирований по личной ссылке, гость получает событие в письме и может скачать его по ссылке
+// управления. UID события постоянен для бронирования, а SEQUENCE — номер версии бронирования:
+// календарь заменяет событие при переносе, а отмена приходит как STATUS:CANCELLED.
+
+const (
+	// icsMethodPublish — событие для добавления в календарь, без приглашения участников
+	icsMethodPublish = "PUBLISH"
+	icsTimeFormat    = "20060102T150405Z"
+	// calendarRefresh — как часто календарю стоит перечитывать ленту
+	calendarRefresh = "PT15M"
+)
+
+// icsEvent — событие VEVENT
+type icsEvent struct {
+	UID         string
+	Sequence    int
+	Status      string // TENTATIVE, CONFIRMED или CANCELLED
+	Start, End  time.Time
+	Created     time.Time
+	Modified    time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+}
+
+// icsCalendar — календарь VCALENDAR. Method задается для вложений и файлов;
+// у ленты его нет, а Name — ее название в приложении календаря.
+type icsCalendar struct {
+	Method string
+	Name   string
+	Events []icsEvent
+}
+
+// bookingEvent — общие поля события бронирования: время, версия и статус
+func bookingEvent(b *Booking) icsEvent {
+	modified := b.Updated
+	if modified.IsZero() {
+		modified = b.Created
+	}
+	return icsEvent{
+		UID:      fmt.Sprintf("booking-%d@%s", b.ID, calendarDomain()),
+		Sequence: b.Revision,
+		Status:   icsStatus(b.Status),
+		Start:    b.StartsAt,
+		End:      b.EndsAt,
+		Created:  b.Created,
+		Modified: modified,
+	}
+}
+
+// staffCalendarEvent — бронирование в ленте сотрудника: гость, контакты, столики и комментарий
+func staffCalendarEvent(b *Booking, rest *Restaurant) icsEvent {
+	e := bookingEvent(b)
+	e.Summary = fmt.Sprintf("%s, гостей: %s", b.Name, b.Guests)
+	lines := []string{"Статус: " + statusTitle(b.Status)}
+	if b.Phone != "" {
+		lines = append(lines, "Телефон: +"+b.Phone)
+	}
+	if b.Email != "" {
+		lines = append(lines, "Email: "+b.Email)
+	}
+	if len(b.Tables) > 0 {
+		lines = append(lines, "Столики: "+joinInts(b.Tables, ", "))
+	}
+	if b.Comments != "" {
+		lines = append(lines, "Комментарий: "+b.Comments)
+	}
+	e.Description = strings.Join(lines, "\n")
+	e.Location = rest.Name
+	if rest.Address != "" {
+		e.Location += ", " + rest.Address
+	}
+	e.URL = siteURL(fmt.Sprintf("/admin/bookings?restaurant=%d&date=%s", rest.ID, b.Date))
+	return e
+}
+
+// guestCalendarEvent — бронирование в календаре гостя; manageURL пуст, если токен ссылки неизвестен
+func guestCalendarEvent(b *Booking, manageURL string) icsEvent {
+	e := bookingEvent(b)
+	venue := notificationData{Booking: b}.Venue()
+	e.Summary = "Бронирование в " + venue
+	e.Location = venue
+	e.Description = "Гостей: " + b.Guests
+	if manageURL != "" {
+		e.Description += "\nИзменить или отменить бронирование: " + manageURL
+		e.URL = manageURL
+	}
+	return e
+}
+
+// icsStatus — статус события по статусу бронирования: неявка и истекшее бронирование
+// тоже убирают визит из календаря
+func icsStatus(status string) string {
+	switch status {
+	case StatusPending:
+		return "TENTATIVE"
+	case StatusCancelled, StatusNoShow, StatusExpired:
+		return "CANCELLED"
+	default:
+		return "CONFIRMED"
+	}
+}
+
+// calendarDomain — домен сайта в UID событий, чтобы они не пересекались с событиями других систем
+func calendarDomain() string {
+	if u, err := url.Parse(config.BaseURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "dinebook"
+}
+
+// String собирает календарь: строки разделяются CRLF, длинные переносятся по 75 байт
+func (c icsCalendar) String() string {
+	var b strings.Builder
+	line := func(name, value string) {
+		writeICSLine(&b, name+":"+value)
+	}
+	text := func(name, value string) {
+		if value != "" {
+			line(name, icsEscape(value))
+		}
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//DineBook//Bookings//RU")
+	line("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		line("METHOD", c.Method)
+	}
+	if c.Name != "" {
+		text("X-WR-CALNAME", c.Name)
+		line("REFRESH-INTERVAL;VALUE=DURATION", calendarRefresh)
+		line("X-PUBLISHED-TTL", calendarRefresh)
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("SEQUENCE", strconv.Itoa(e.Sequence))
+		line("DTSTAMP", e.Modified.UTC().Format(icsTimeFormat))
+		line("CREATED", e.Created.UTC().Format(icsTimeFormat))
+		line("LAST-MODIFIED", e.Modified.UTC().Format(icsTimeFormat))
+		line("DTSTART", e.Start.UTC().Format(icsTimeFormat))
+		line("DTEND", e.End.UTC().Format(icsTimeFormat))
+		line("STATUS", e.Status)
+		text("SUMMARY", e.Summary)
+		text("DESCRIPTION", e.Description)
+		text("LOCATION", e.Location)
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+// icsEscape экранирует текстовое значение свойства
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// writeICSLine пишет строку календаря, перенося ее по 75 байт без разрыва символов UTF-8:
+// продолжение начинается с пробела
+func writeICSLine(b *strings.Builder, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// Пробел в начале продолжения входит в длину строки
+		limit = 74
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
+
+// joinInts — номера через разделитель: "3, 5"
+func joinInts(values []int, sep string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, sep)
+}
+
+// writeCalendar отдает календарь; filename задается для скачивания файла
+func writeCalendar(w http.ResponseWriter, c icsCalendar, filename string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	w.Write([]byte(c.String()))
+}
+
+// handleCalendarFeed отдает ленту будущих бронирований сотрудника по личной ссылке
+// /calendar/{token}.ics во всех доступных ему ресторанах. Приложения календарей не умеют
+// входить в систему, поэтому доступ дает только токен; ?status=pending,confirmed сужает ленту.
+func handleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	// Токен в адресе не должен уходить на сторонние сайты через Referer
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	user, err := db.GetCalendarUser(mux.Vars(r)["token"])
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при проверке ссылки на календарь", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || !user.Can(PermViewBookings) {
+		http.Error(w, "Календарь не найден. Получите новую ссылку в админ-панели.", http.StatusNotFound)
+		return
+	}
+
+	q, err := parseBookingQuery(url.Values{"status": r.URL.Query()["status"]})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.From = restaurantToday()
+	q.Sort = "starts_at"
+	q.Limit = exportPageSize
+
+	restaurants, err := accessibleRestaurants(user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении ресторанов", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	calendar := icsCalendar{Name: "DineBook: бронирования"}
+	if len(restaurants) == 1 {
+		calendar.Name = restaurants[0].Name + ": бронирования"
+	}
+	for i := range restaurants {
+		rest := &restaurants[i]
+		q.Cursor = nil
+		for {
+			page, err := db.SearchBookings(rest.ID, q)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Ошибка при получении бронирований", "error", err)
+				http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+				return
+			}
+			for j := range page.Bookings {
+				calendar.Events = append(calendar.Events, staffCalendarEvent(&page.Bookings[j], rest))
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			q.Cursor = q.cursorAfter(&page.Bookings[len(page.Bookings)-1])
+		}
+	}
+	sort.SliceStable(calendar.Events, func(i, j int) bool {
+		return calendar.Events[i].Start.Before(calendar.Events[j].Start)
+	})
+
+	w.Header().Set("Cache-Control", "private, no-cache")
+	writeCalendar(w, calendar, "")
+}
+
+// handleManagedBookingCalendar отдает гостю событие бронирования по ссылке управления
+func handleManagedBookingCalendar(w http.ResponseWriter, r *http.Request) {
+	booking, ok := managedBooking(w, r)
+	if !ok {
+		return
+	}
+	manageURL := siteURL("/manage/" + mux.Vars(r)["token"])
+	writeCalendar(w, icsCalendar{
+		Method: icsMethodPublish,
+		Events: []icsEvent{guestCalendarEvent(booking, manageURL)},
+	}, fmt.Sprintf("booking-%d.ics", booking.ID))
+}
+
+// calendarLink — личная ссылка сотрудника на ленту календаря
+type calendarLink struct {
+	URL string `json:"url"`
+}
+
+// handleCreateCalendarLink выдает сотруднику новую ссылку на ленту календаря; прежняя перестает работать.
+// В базе хранится только хэш токена, поэтому показать выданную ссылку повторно нельзя.
+func handleCreateCalendarLink(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	token, err := db.CreateCalendarToken(user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при создании ссылки на календарь", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	slog.InfoContext(r.Context(), "Выдана ссылка на календарь", "user_id", user.ID)
+	writeJSON(w, http.StatusOK, calendarLink{URL: siteURL("/calendar/" + token + ".ics")})
+}
+
+// handleDeleteCalendarLink отключает ссылку сотрудника на ленту календаря
+func handleDeleteCalendarLink(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if err := db.DeleteCalendarToken(user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при отключении ссылки на календарь", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	slog.InfoContext(r.Context(), "Ссылка на календарь отключена", "user_id", user.ID)
+	writeJSON(w, http.StatusOK, apiMessage{Message: "Ссылка на календарь отключена"})
+}
+
+// CreateCalendarToken выдает пользователю новый токен ленты календаря вместо прежнего
+func (db *Database) CreateCalendarToken(userID int) (string, error) {
+	defer observeQuery("CreateCalendarToken", time.Now())
+	token, _, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.Exec(`UPDATE users SET calendar_token_hash = $1 WHERE id = $2`, hashSessionToken(token), userID); err != nil {
+		return "", fmt.Errorf("ошибка создания ссылки на календарь: %v", err)
+	}
+	return token, nil
+}
+
+func (db *Database) DeleteCalendarToken(userID int) error {
+	defer observeQuery("DeleteCalendarToken", time.Now())
+	_, err := db.Exec(`UPDATE users SET calendar_token_hash = NULL WHERE id = $1`, userID)
+	return err
+}
+
+// GetCalendarUser находит включенного пользователя по токену ленты календаря; nil, если токен неизвестен
+func (db *Database) GetCalendarUser(token string) (*User, error) {
+	defer observeQuery("GetCalendarUser", time.Now())
+	var user User
+	err := db.QueryRow(`
+		SELECT id, username, role, disabled, created_at
+		FROM users
+		WHERE calendar_token_hash = $1 AND disabled = false
+	`, hashSessionToken(token)).Scan(&user.ID, &user.Username, &user.Role, &user.Disabled, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки ссылки на календарь: %v", err)
+	}
+	if err := db.attachUserRestaurants([]*User{&user}); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -1,27 +1,491 @@
 package main
 
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// Встроенная база часовых поясов: сервер не зависит от tzdata в системе
+	_ "time/tzdata"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config — настройки сервера. Значения собираются слоями: умолчания из defaultConfig,
+// файл YAML, переменные окружения DINEBOOK_<КЛЮЧ> и флаги командной строки -<ключ>
+// (см. LoadConfig). Ключ файла задается тегом yaml; поля с тегом secret скрываются в config print.
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	DBSSLMode  string
+	// Хранилище данных: postgres, sqlite (файл SQLitePath) или memory (без сохранения между запусками)
+	DBDriver   string `yaml:"db_driver"`
+	SQLitePath string `yaml:"sqlite_path"`
+
+	// Строка подключения к PostgreSQL (postgres://... или key=value). Если задана,
+	// DBHost, DBPort, DBUser, DBPassword, DBName и DBSSLMode не используются.
+	DBDSN      string `yaml:"db_dsn" secret:"dsn"`
+	DBHost     string `yaml:"db_host"`
+	DBPort     string `yaml:"db_port"`
+	DBUser     string `yaml:"db_user"`
+	DBPassword string `yaml:"db_password" secret:"true"`
+	DBName     string `yaml:"db_name"`
+	DBSSLMode  string `yaml:"db_sslmode"`
+	// Применять миграции схемы при запуске сервера
+	AutoMigrate bool `yaml:"auto_migrate"`
+
+	// Адрес, на котором слушает сервер, и сертификат для HTTPS (оба файла или ни одного)
+	ListenAddr  string `yaml:"listen_addr"`
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+	// Таймауты HTTP: чтение запроса, запись ответа и простой keep-alive соединения.
+	// При остановке начатые запросы дорабатывают не дольше ShutdownTimeout.
+	HTTPReadTimeout  time.Duration `yaml:"http_read_timeout"`
+	HTTPWriteTimeout time.Duration `yaml:"http_write_timeout"`
+	HTTPIdleTimeout  time.Duration `yaml:"http_idle_timeout"`
+	ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
+	// Токен для /metrics (заголовок Authorization: Bearer <токен>); пусто — метрики открыты
+	MetricsToken string `yaml:"metrics_token" secret:"true"`
+	// Журнал сервера: уровень (debug, info, warn, error) и формат (text или json)
+	LogLevel  string `yaml:"log_level"`
+	LogFormat string `yaml:"log_format"`
+
+	// Владелец, создаваемый при первом запуске. Если пароль не задан,
+	// он генерируется и один раз выводится в журнал.
+	AdminUsername string `yaml:"admin_username"`
+	AdminPassword string `yaml:"admin_password" secret:"true"`
+	// Время жизни сессии администратора и выдача cookie только по HTTPS
+	SessionTTL    time.Duration `yaml:"session_ttl"`
+	SecureCookies bool          `yaml:"secure_cookies"`
+	// Ключ, которым подписываются хэши токенов сессий. Смена ключа завершает все сессии.
+	SessionSecret string `yaml:"session_secret" secret:"true"`
+
+	// Часовой пояс ресторанов (один на всю сеть): в нем гость выбирает дату и время визита,
+	// в нем же задаются часы работы и блокировки. Location загружается из TimeZone при запуске.
+	TimeZone string         `yaml:"timezone"`
+	Location *time.Location `yaml:"-"`
+
+	// Ресторан по умолчанию: создается при первом запуске, если ресторанов еще нет,
+	// и обслуживает адреса API без /r/{slug}
+	DefaultRestaurant     string `yaml:"default_restaurant"`
+	DefaultRestaurantName string `yaml:"default_restaurant_name"`
+
+	// Часы работы, которыми заполняется недельное расписание нового ресторана,
+	// и шаг слотов бронирования
+	OpeningTime  string        `yaml:"opening_time"`
+	ClosingTime  string        `yaml:"closing_time"`
+	SlotInterval time.Duration `yaml:"slot_interval"`
+	// Ожидаемая продолжительность визита, на которую резервируется столик
+	DiningDuration time.Duration `yaml:"dining_duration"`
+	// Максимальный размер компании для онлайн-бронирования.
+	// Шаг слотов, продолжительность визита и размер компании — значения для нового ресторана,
+	// дальше они меняются в настройках каждого ресторана.
+	MaxGuests int `yaml:"max_guests"`
+	// Схема зала ресторана по умолчанию, создаваемая при первом запуске (задается только в файле)
+	DefaultTables []Table `yaml:"default_tables"`
+
+	// Адрес сайта для ссылок в уведомлениях
+	BaseURL string `yaml:"base_url"`
+	// Каналы уведомлений гостям: письма (smtp, log или пусто — не отправлять)
+	// и SMS (http, log или пусто). Канал log дописывает сообщения в NotifyLogPath.
+	NotifyEmail   string `yaml:"notify_email"`
+	NotifySMS     string `yaml:"notify_sms"`
+	NotifyLogPath string `yaml:"notify_log_path"`
+	// Сколько раз пытаться доставить уведомление и как часто проверять очередь
+	NotifyMaxAttempts  int           `yaml:"notify_max_attempts"`
+	NotifyPollInterval time.Duration `yaml:"notify_poll_interval"`
+
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password" secret:"true"`
+	SMTPFrom     string `yaml:"smtp_from"`
+
+	// HTTP API провайдера SMS
+	SMSGatewayURL   string `yaml:"sms_gateway_url"`
+	SMSGatewayToken string `yaml:"sms_gateway_token" secret:"true"`
+	SMSSender       string `yaml:"sms_sender"`
+
+	// Фоновые задания: как часто запускать, через сколько неподтвержденное бронирование истекает,
+	// через сколько после визита просить отзыв и сколько хранить историю запусков
+	SchedulerInterval   time.Duration `yaml:"scheduler_interval"`
+	PendingTTL          time.Duration `yaml:"pending_ttl"`
+	FeedbackDelay       time.Duration `yaml:"feedback_delay"`
+	JobHistoryRetention time.Duration `yaml:"job_history_retention"`
 
-	AdminUsername string
-	AdminPassword string
+	// Сколько действует ссылка на освободившееся место, предложенное из листа ожидания
+	WaitlistClaimTTL time.Duration `yaml:"waitlist_claim_ttl"`
 }
 
-func GetConfig() *Config {
+// defaultConfig — значения по умолчанию для запуска на ноутбуке разработчика.
+// Пароли здесь не задаются: их нужно передать в файле, окружении или флагах.
+func defaultConfig() *Config {
 	return &Config{
-		DBHost:     "localhost",
-		DBPort:     "5432",
-		DBUser:     "postgres",
-		DBPassword: "postgres",
-		DBName:     "dinebook",
-		DBSSLMode:  "disable",
+		DBDriver:   DriverPostgres,
+		SQLitePath: "dinebook.db",
+
+		DBHost:    "localhost",
+		DBPort:    "5432",
+		DBUser:    "postgres",
+		DBName:    "dinebook",
+		DBSSLMode: "disable",
+
+		AutoMigrate: true,
+
+		ListenAddr:       ":8080",
+		HTTPReadTimeout:  15 * time.Second,
+		HTTPWriteTimeout: 30 * time.Second,
+		HTTPIdleTimeout:  2 * time.Minute,
+		ShutdownTimeout:  30 * time.Second,
+
+		LogLevel:  "info",
+		LogFormat: "text",
 
 		AdminUsername: "admin",
-		AdminPassword: "admin123",
+		SessionTTL:    12 * time.Hour,
+		SecureCookies: false,
+
+		TimeZone: "Europe/Moscow",
+
+		DefaultRestaurant:     "main",
+		DefaultRestaurantName: "La Bella Vita",
+
+		OpeningTime:    "10:00",
+		ClosingTime:    "23:00",
+		SlotInterval:   30 * time.Minute,
+		DiningDuration: 2 * time.Hour,
+		MaxGuests:      8,
+		DefaultTables: []Table{
+			{Number: 1, Seats: 2, MinParty: 1, MaxParty: 2, Zone: "main", Combinable: true, Active: true},
+			{Number: 2, Seats: 2, MinParty: 1, MaxParty: 2, Zone: "main", Combinable: true, Active: true},
+			{Number: 3, Seats: 4, MinParty: 2, MaxParty: 4, Zone: "main", Combinable: true, Active: true},
+			{Number: 4, Seats: 4, MinParty: 2, MaxParty: 4, Zone: "main", Combinable: true, Active: true},
+			{Number: 5, Seats: 4, MinParty: 2, MaxParty: 4, Zone: "window", Combinable: false, Active: true},
+			{Number: 6, Seats: 6, MinParty: 3, MaxParty: 6, Zone: "window", Combinable: false, Active: true},
+			{Number: 7, Seats: 8, MinParty: 5, MaxParty: 8, Zone: "hall", Combinable: false, Active: true},
+		},
+
+		BaseURL: "http://localhost:8080",
+
+		NotifyEmail:        "log",
+		NotifySMS:          "log",
+		NotifyLogPath:      "notifications.log",
+		NotifyMaxAttempts:  5,
+		NotifyPollInterval: 10 * time.Second,
+
+		SMTPHost: "localhost",
+		SMTPPort: "587",
+		SMTPFrom: "DineBook <noreply@dinebook.local>",
+
+		SMSSender: "DineBook",
+
+		SchedulerInterval:   5 * time.Minute,
+		PendingTTL:          24 * time.Hour,
+		FeedbackDelay:       2 * time.Hour,
+		JobHistoryRetention: 14 * 24 * time.Hour,
+
+		WaitlistClaimTTL: 30 * time.Minute,
+	}
+}
+
+// LoadLocation загружает часовой пояс ресторана из TimeZone
+func (c *Config) LoadLocation() error {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return fmt.Errorf("неизвестный часовой пояс %q: %v", c.TimeZone, err)
+	}
+	c.Location = loc
+	return nil
+}
+
+// configEnvPrefix — префикс переменных окружения: ключ db_host читается из DINEBOOK_DB_HOST
+const configEnvPrefix = "DINEBOOK_"
+
+// defaultConfigFile читается, если путь к файлу не передан флагом -config или DINEBOOK_CONFIG
+const defaultConfigFile = "dinebook.yaml"
+
+// configField — скалярное поле Config, которое можно задать переменной окружения или флагом
+type configField struct {
+	key   string
+	value reflect.Value
+}
+
+func (f configField) envName() string {
+	return configEnvPrefix + strings.ToUpper(f.key)
+}
+
+func (f configField) flagName() string {
+	return strings.ReplaceAll(f.key, "_", "-")
+}
+
+// set разбирает строковое значение из окружения или флага по типу поля
+func (f configField) set(raw string) error {
+	switch {
+	case f.value.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: ожидается длительность вида 30m или 12h: %v", f.key, err)
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.String:
+		f.value.SetString(raw)
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: ожидается true или false", f.key)
+		}
+		f.value.SetBool(b)
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: ожидается целое число", f.key)
+		}
+		f.value.SetInt(int64(n))
+	default:
+		return fmt.Errorf("%s: задается только в файле конфигурации", f.key)
+	}
+	return nil
+}
+
+// fields возвращает скалярные поля конфигурации в порядке объявления
+func (c *Config) fields() []configField {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	var fields []configField
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+		switch v.Field(i).Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+			fields = append(fields, configField{key: key, value: v.Field(i)})
+		}
+	}
+	return fields
+}
+
+// LoadConfig собирает конфигурацию: умолчания → файл YAML → переменные окружения → флаги.
+// Возвращает оставшиеся аргументы командной строки (подкоманду) и проверенную конфигурацию.
+func LoadConfig(args []string) (*Config, []string, error) {
+	c := defaultConfig()
+	fields := c.fields()
+
+	// Флаги разбираются первыми, чтобы узнать путь к файлу, но применяются последними
+	fs := flag.NewFlagSet("dinebook-go", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(configEnvPrefix+"CONFIG"), "файл конфигурации YAML (по умолчанию "+defaultConfigFile+", если он есть)")
+	flagValues := make(map[string]*string)
+	for _, f := range fields {
+		flagValues[f.key] = fs.String(f.flagName(), "", "переменная окружения "+f.envName())
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	path := *configPath
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			path = defaultConfigFile
+		}
+	}
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, f := range fields {
+		if raw, ok := os.LookupEnv(f.envName()); ok {
+			if err := f.set(raw); err != nil {
+				return nil, nil, fmt.Errorf("переменная %s: %v", f.envName(), err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if fl.Name == f.flagName() && flagErr == nil {
+				if err := f.set(*flagValues[f.key]); err != nil {
+					flagErr = fmt.Errorf("флаг -%s: %v", fl.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return c, fs.Args(), nil
+}
+
+// loadFile накладывает на конфигурацию значения из файла YAML; неизвестные ключи считаются ошибкой
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла конфигурации: %v", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("ошибка в файле конфигурации %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate проверяет конфигурацию при запуске и загружает часовой пояс.
+// Возвращает все найденные ошибки сразу, чтобы их можно было исправить за один раз.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	switch c.DBDriver {
+	case "", DriverPostgres:
+		check(c.DBDSN != "" || (c.DBHost != "" && c.DBName != ""), "для PostgreSQL нужны db_dsn или db_host и db_name")
+	case DriverSQLite:
+		check(c.SQLitePath != "", "для SQLite нужен sqlite_path")
+	case DriverMemory:
+	default:
+		errs = append(errs, fmt.Errorf("неизвестный драйвер хранилища: %s (ожидается postgres, sqlite или memory)", c.DBDriver))
+	}
+
+	_, _, err := net.SplitHostPort(c.ListenAddr)
+	check(err == nil, "неверный listen_addr %q: ожидается хост:порт, например :8080", c.ListenAddr)
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "для HTTPS нужны оба файла: tls_cert_file и tls_key_file")
+	for _, file := range []string{c.TLSCertFile, c.TLSKeyFile} {
+		if file != "" {
+			_, err := os.Stat(file)
+			check(err == nil, "файл %s недоступен: %v", file, err)
+		}
+	}
+
+	check(c.HTTPReadTimeout > 0 && c.HTTPWriteTimeout > 0 && c.HTTPIdleTimeout > 0,
+		"http_read_timeout, http_write_timeout и http_idle_timeout должны быть больше нуля")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout должен быть больше нуля")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "неверный log_level %q: ожидается debug, info, warn или error", c.LogLevel)
+	check(c.LogFormat == "text" || c.LogFormat == "json", "неверный log_format %q: ожидается text или json", c.LogFormat)
+
+	check(c.AdminUsername != "", "admin_username не может быть пустым")
+	check(c.AdminPassword == "" || len(c.AdminPassword) >= 8, "admin_password должен содержать не менее 8 символов")
+	check(c.SessionTTL > 0, "session_ttl должен быть больше нуля")
+	check(c.SessionSecret == "" || len(c.SessionSecret) >= 16, "session_secret должен содержать не менее 16 символов")
+
+	if err := c.LoadLocation(); err != nil {
+		errs = append(errs, err)
+	}
+
+	check(restaurantSlugPattern.MatchString(c.DefaultRestaurant), "default_restaurant может содержать только латинские буквы, цифры и дефис")
+	check(c.DefaultRestaurantName != "", "default_restaurant_name не может быть пустым")
+	opening, errOpen := time.Parse("15:04", c.OpeningTime)
+	check(errOpen == nil, "неверный opening_time %q: ожидается ЧЧ:ММ", c.OpeningTime)
+	closing, errClose := time.Parse("15:04", c.ClosingTime)
+	check(errClose == nil, "неверный closing_time %q: ожидается ЧЧ:ММ", c.ClosingTime)
+	if errOpen == nil && errClose == nil {
+		check(opening.Before(closing), "opening_time должен быть раньше closing_time")
+	}
+	check(c.SlotInterval >= time.Minute && c.SlotInterval <= 24*time.Hour, "slot_interval должен быть от 1 минуты до 24 часов")
+	check(c.DiningDuration >= time.Minute && c.DiningDuration <= 24*time.Hour, "dining_duration должен быть от 1 минуты до 24 часов")
+	check(c.MaxGuests > 0 && c.MaxGuests <= 100, "max_guests должен быть от 1 до 100")
+	for _, t := range c.DefaultTables {
+		check(t.Number > 0 && t.Seats > 0 && t.MinParty > 0 && t.MinParty <= t.MaxParty,
+			"неверный столик %d в default_tables: номер, места и число гостей должны быть положительными, min_party не больше max_party", t.Number)
+	}
+
+	u, err := url.Parse(c.BaseURL)
+	check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "неверный base_url %q: ожидается адрес http:// или https://", c.BaseURL)
+	// Каналы уведомлений проверяет тот же код, который их создает
+	if _, err := newNotifiers(c); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.NotifyMaxAttempts > 0, "notify_max_attempts должен быть больше нуля")
+	check(c.NotifyPollInterval > 0, "notify_poll_interval должен быть больше нуля")
+
+	check(c.SchedulerInterval > 0, "scheduler_interval должен быть больше нуля")
+	check(c.PendingTTL > 0, "pending_ttl должен быть больше нуля")
+	check(c.FeedbackDelay >= 0, "feedback_delay не может быть отрицательным")
+	check(c.JobHistoryRetention > 0, "job_history_retention должен быть больше нуля")
+	check(c.WaitlistClaimTTL > 0, "waitlist_claim_ttl должен быть больше нуля")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("неверная конфигурация:\n%v", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted возвращает копию конфигурации, в которой пароли, токены и ключи заменены на ***
+func (c *Config) Redacted() *Config {
+	copied := *c
+	v := reflect.ValueOf(&copied).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		switch t.Field(i).Tag.Get("secret") {
+		case "true":
+			if field.String() != "" {
+				field.SetString(redactedValue)
+			}
+		case "dsn":
+			field.SetString(redactDSN(field.String()))
+		}
+	}
+	return &copied
+}
+
+const redactedValue = "***"
+
+// dsnPasswordPattern — пароли в строке подключения вида key=value: password и sslpassword
+var dsnPasswordPattern = regexp.MustCompile(`\b((?:ssl)?password)\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// redactDSN скрывает пароли в строке подключения, оставляя хост и имя базы. В URL скрываются
+// пароль пользователя и параметры password и sslpassword, а пары key=value ищутся шаблоном
+// в любой строке, в том числе в пути URL.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.Opaque == "" {
+		u.Path, u.RawPath = dsnPasswordPattern.ReplaceAllString(u.Path, "$1="+redactedValue), ""
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			key, _, _ := strings.Cut(param, "=")
+			if name, err := url.QueryUnescape(key); err == nil && (name == "password" || name == "sslpassword") {
+				params[i] = key + "=" + redactedValue
+			}
+		}
+		u.RawQuery = strings.Join(params, "&")
+		if _, ok := u.User.Password(); !ok {
+			return u.String()
+		}
+		// url.URL экранирует звездочки в пароле; возвращаем маску в том же виде, что и в остальных местах
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+		escaped := url.UserPassword("", redactedValue).String()
+		return strings.Replace(u.String(), escaped+"@", ":"+redactedValue+"@", 1)
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "$1="+redactedValue)
+}
+
+// runConfigCommand выполняет подкоманду config: print выводит итоговую конфигурацию без секретов
+func runConfigCommand(c *Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("использование: dinebook-go [флаги] config print")
+	}
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
 	}
+	return enc.Close()
 }
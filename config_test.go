@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct{ dsn, want string }{
+		{"postgres://dinebook:secret@db:5432/dinebook?sslmode=require", "postgres://dinebook:***@db:5432/dinebook?sslmode=require"},
+		{"postgres://db/dinebook?user=dinebook&password=secret&sslmode=require", "postgres://db/dinebook?user=dinebook&password=***&sslmode=require"},
+		{"postgres://db/dinebook?sslpassword=key%26phrase", "postgres://db/dinebook?sslpassword=***"},
+		{"postgres://dinebook@db/dinebook", "postgres://dinebook@db/dinebook"},
+		{"postgres://db/dinebook", "postgres://db/dinebook"},
+		{"host=db user=dinebook password=secret dbname=dinebook", "host=db user=dinebook password=*** dbname=dinebook"},
+		{"host=db password='se cr\\'et' sslpassword = key dbname=dinebook", "host=db password=*** sslpassword=*** dbname=dinebook"},
+		{"file:dinebook.db?password=secret", "file:dinebook.db?password=***"},
+		{"dinebook.db", "dinebook.db"},
+	}
+	for _, tt := range tests {
+		if got := redactDSN(tt.dsn); got != tt.want {
+			t.Errorf("redactDSN(%q) = %q, ожидалось %q", tt.dsn, got, tt.want)
+		}
+	}
+}
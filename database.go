@@ -2,20 +2,46 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
+// Database — хранилище в SQL-базе: PostgreSQL или SQLite.
+// Запросы общие; различия диалектов собраны в lockDate, ilike и наборе миграций.
 type Database struct {
 	*sql.DB
+	driver string
+
+	// Соединение, на котором ведущий экземпляр держит блокировку планировщика
+	leaderMu   sync.Mutex
+	leaderConn *sql.Conn
+}
+
+var ErrDuplicateBooking = errors.New("на эту дату уже существует активное бронирование для данного номера телефона")
+
+// ErrPhoneNameMismatch — номер телефона закреплен за другим именем в одном из ресторанов сети
+var ErrPhoneNameMismatch = errors.New("этот номер уже зарегистрирован на другое имя")
+
+// isUniqueViolation сообщает, что запись нарушила уникальный индекс
+func isUniqueViolation(err error) bool {
+	return errors.Is(err, errUniqueViolation) ||
+		strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "UNIQUE constraint")
 }
 
 func NewDatabase(config *Config) (*Database, error) {
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName, config.DBSSLMode)
+	connStr := config.DBDSN
+	if connStr == "" {
+		connStr = postgresDSN(config)
+	}
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
@@ -26,76 +52,155 @@ func NewDatabase(config *Config) (*Database, error) {
 		return nil, fmt.Errorf("ошибка проверки подключения к базе данных: %v", err)
 	}
 
-	// Создаем таблицы, если они не существуют
-	if err := createTables(db); err != nil {
-		return nil, err
-	}
+	return &Database{DB: db, driver: DriverPostgres}, nil
+}
 
-	return &Database{db}, nil
+// postgresDSN собирает строку подключения key=value из отдельных полей конфигурации.
+// Пустые поля пропускаются: драйвер возьмет значения из PGPASSWORD, ~/.pgpass и т.п.
+func postgresDSN(config *Config) string {
+	var parts []string
+	for _, p := range []struct{ key, value string }{
+		{"host", config.DBHost},
+		{"port", config.DBPort},
+		{"user", config.DBUser},
+		{"password", config.DBPassword},
+		{"dbname", config.DBName},
+		{"sslmode", config.DBSSLMode},
+	} {
+		if p.value == "" {
+			continue
+		}
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(p.value)
+		parts = append(parts, p.key+"='"+value+"'")
+	}
+	return strings.Join(parts, " ")
 }
 
-func createTables(db *sql.DB) error {
-	// Создаем таблицу пользователей
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(50) UNIQUE NOT NULL,
-			password_hash VARCHAR(255) NOT NULL,
-			is_admin BOOLEAN DEFAULT false,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+// NewSQLiteDatabase открывает файл базы SQLite (или создает его).
+// Транзакции начинаются с BEGIN IMMEDIATE, поэтому изменения бронирований выполняются по одному,
+// а параллельные запросы ждут освобождения базы до busy_timeout.
+// Параметры $1, $2, ... SQLite связывает по порядку первого появления в запросе,
+// поэтому в общих запросах они должны идти по возрастанию.
+func NewSQLiteDatabase(path string) (*Database, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_txlock=immediate&_busy_timeout=5000&_foreign_keys=1")
 	if err != nil {
-		return fmt.Errorf("ошибка создания таблицы users: %v", err)
+		return nil, fmt.Errorf("ошибка открытия базы SQLite: %v", err)
 	}
 
-	// Удаляем существующую таблицу bookings, если она есть
-	_, err = db.Exec(`DROP TABLE IF EXISTS bookings CASCADE`)
-	if err != nil {
-		return fmt.Errorf("ошибка удаления таблицы bookings: %v", err)
-	}
-
-	// Создаем таблицу бронирований заново
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS bookings (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(100) NOT NULL,
-			phone VARCHAR(20) NOT NULL,
-			booking_date VARCHAR(10) NOT NULL,
-			booking_time VARCHAR(5) NOT NULL,
-			guests INTEGER NOT NULL,
-			comments TEXT,
-			status VARCHAR(20) DEFAULT 'pending',
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(phone, booking_date)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("ошибка создания таблицы bookings: %v", err)
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("ошибка проверки подключения к базе SQLite: %v", err)
+	}
+
+	return &Database{DB: db, driver: DriverSQLite}, nil
+}
+
+// lockDate блокирует дату ресторана до конца транзакции.
+// В SQLite транзакции записи и так выполняются по одной.
+func (db *Database) lockDate(tx *sql.Tx, restaurantID int, date string) error {
+	if db.driver == DriverSQLite {
+		return nil
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, restaurantID, date); err != nil {
+		return fmt.Errorf("ошибка блокировки даты: %v", err)
+	}
+	return nil
+}
+
+// ilike — оператор поиска без учета регистра
+func (db *Database) ilike() string {
+	if db.driver == DriverSQLite {
+		return "LIKE"
+	}
+	return "ILIKE"
+}
+
+// dbTime передает момент времени в запрос: UTC с явной зоной. PostgreSQL читает такую строку
+// в TIMESTAMPTZ без учета часового пояса сессии, а в SQLite строки одного формата сравниваются по времени.
+func dbTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05Z")
+}
+
+// inRestaurantZone переводит необязательную отметку времени в часовой пояс ресторана
+func inRestaurantZone(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
 	}
+	local := t.In(config.Location)
+	return &local
+}
+
+// Колонки бронирования в порядке, который ожидает scanBooking
+const bookingColumns = `id, name, phone, email, starts_at, ends_at, guests, comments, status, duration_minutes, created_at,
+		confirmed_at, seated_at, completed_at, cancelled_at, no_show_at, expired_at,
+		restaurant_id, (SELECT name FROM restaurants WHERE restaurants.id = bookings.restaurant_id), revision, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	// Создаем индексы
-	_, err = db.Exec(`
-		CREATE INDEX IF NOT EXISTS idx_bookings_date ON bookings(booking_date);
-		CREATE INDEX IF NOT EXISTS idx_bookings_status ON bookings(status);
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_bookings_phone_date ON bookings(phone, booking_date);
-	`)
+// scanBooking читает бронирование и выражает все моменты времени в часовом поясе ресторана
+func scanBooking(row rowScanner, b *Booking) error {
+	var updated sql.NullTime
+	err := row.Scan(
+		&b.ID,
+		&b.Name,
+		&b.Phone,
+		&b.Email,
+		&b.StartsAt,
+		&b.EndsAt,
+		&b.Guests,
+		&b.Comments,
+		&b.Status,
+		&b.Duration,
+		&b.Created,
+		&b.ConfirmedAt,
+		&b.SeatedAt,
+		&b.CompletedAt,
+		&b.CancelledAt,
+		&b.NoShowAt,
+		&b.ExpiredAt,
+		&b.RestaurantID,
+		&b.Restaurant,
+		&b.Revision,
+		&updated,
+	)
 	if err != nil {
-		return fmt.Errorf("ошибка создания индексов: %v", err)
+		return err
 	}
 
+	b.StartsAt = b.StartsAt.In(config.Location)
+	b.EndsAt = b.EndsAt.In(config.Location)
+	b.Date = b.StartsAt.Format("2006-01-02")
+	b.Time = b.StartsAt.Format("15:04")
+	b.Created = b.Created.In(config.Location)
+	b.Updated = b.Created
+	if updated.Valid {
+		b.Updated = updated.Time.In(config.Location)
+	}
+	b.ConfirmedAt = inRestaurantZone(b.ConfirmedAt)
+	b.SeatedAt = inRestaurantZone(b.SeatedAt)
+	b.CompletedAt = inRestaurantZone(b.CompletedAt)
+	b.CancelledAt = inRestaurantZone(b.CancelledAt)
+	b.NoShowAt = inRestaurantZone(b.NoShowAt)
+	b.ExpiredAt = inRestaurantZone(b.ExpiredAt)
 	return nil
 }
 
-func (db *Database) CreateBooking(booking *Booking) error {
+func (db *Database) CreateBooking(booking *Booking, actor BookingActor) error {
+	defer observeQuery("CreateBooking", time.Now())
+	return db.createBooking(booking, actor, 0)
+}
+
+// createBooking создает бронирование. Если задан waitlistID, в той же транзакции забирается
+// предложение из листа ожидания: уже принятое или истекшее предложение дает ErrStatusChanged.
+func (db *Database) createBooking(booking *Booking, actor BookingActor, waitlistID int) error {
 	// Проверяем существующее бронирование
-	exists, err := db.CheckExistingBooking(booking.Phone, booking.Date)
+	exists, err := db.CheckExistingBooking(booking.RestaurantID, booking.Phone, booking.Date)
 	if err != nil {
 		return fmt.Errorf("ошибка при проверке существующего бронирования: %v", err)
 	}
 	if exists {
-		return fmt.Errorf("на эту дату уже существует активное бронирование для данного номера телефона")
+		return ErrDuplicateBooking
 	}
 
 	// Преобразуем guests в число
@@ -109,263 +214,529 @@ func (db *Database) CreateBooking(booking *Booking) error {
 		return fmt.Errorf("ошибка проверки уникальности: %v", err)
 	}
 	if !unique {
-		return fmt.Errorf("этот номер уже зарегистрирован на другое имя")
+		return ErrPhoneNameMismatch
+	}
+
+	start, err := bookingStart(booking.Date, booking.Time)
+	if err != nil {
+		return fmt.Errorf("неверный формат даты или времени: %v", err)
+	}
+	end := start.Add(time.Duration(booking.Duration) * time.Minute)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Блокируем дату, чтобы параллельные запросы не заняли один и тот же столик
+	if err := db.lockDate(tx, booking.RestaurantID, booking.Date); err != nil {
+		return err
+	}
+	if waitlistID != 0 {
+		result, err := tx.Exec(`
+			UPDATE waitlist_entries SET status = $1
+			WHERE id = $2 AND status = $3 AND offer_expires_at > $4
+		`, WaitlistClaimed, waitlistID, WaitlistOffered, dbTime(time.Now()))
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrStatusChanged
+		}
+	}
+
+	tables, err := db.GetTables(booking.RestaurantID)
+	if err != nil {
+		return err
+	}
+	occupancies, err := tableOccupancies(tx, booking.RestaurantID, start, end, 0, waitlistID)
+	if err != nil {
+		return err
+	}
+	assigned := assignTables(tables, busyAt(occupancies, start, end), guests)
+	if assigned == nil {
+		return ErrNoTableAvailable
+	}
+
+	// Токен ссылки управления показываем гостю один раз, в базе храним только хэш
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return err
 	}
 
 	query := `
-		INSERT INTO bookings (name, phone, booking_date, booking_time, guests, comments)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO bookings (name, phone, email, booking_date, booking_time, starts_at, ends_at, guests, comments, duration_minutes, manage_token_hash, restaurant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id
 	`
-	return db.QueryRow(
+	err = tx.QueryRow(
 		query,
 		booking.Name,
 		booking.Phone,
+		booking.Email,
 		booking.Date,
 		booking.Time,
+		dbTime(start),
+		dbTime(end),
 		guests,
 		booking.Comments,
+		booking.Duration,
+		tokenHash,
+		booking.RestaurantID,
 	).Scan(&booking.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateBooking
+		}
+		return err
+	}
+	booking.ManageToken = token
+	booking.StartsAt, booking.EndsAt = start, end
+
+	booking.Tables = nil
+	for _, t := range assigned {
+		if _, err := tx.Exec(`INSERT INTO booking_tables (booking_id, table_id) VALUES ($1, $2)`, booking.ID, t.ID); err != nil {
+			return fmt.Errorf("ошибка привязки столика: %v", err)
+		}
+		booking.Tables = append(booking.Tables, t.Number)
+	}
+	if waitlistID != 0 {
+		if _, err := tx.Exec(`UPDATE waitlist_entries SET booking_id = $1 WHERE id = $2`, booking.ID, waitlistID); err != nil {
+			return err
+		}
+	}
+
+	if err := recordBookingEvent(tx, booking.ID, EventCreated, actor, nil, bookingValues(booking)); err != nil {
+		return err
+	}
+	if err := enqueueNotifications(tx, NotifyCreated, booking); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (db *Database) GetBookings() ([]Booking, error) {
-	query := `
-		SELECT id, name, phone, booking_date, booking_time, guests, comments, status, created_at
-		FROM bookings
-		ORDER BY booking_date DESC, booking_time DESC
-	`
-	rows, err := db.Query(query)
+// BookingChanges — новые значения полей, которые гость может изменить в бронировании
+type BookingChanges struct {
+	Date     string
+	Time     string
+	Guests   int
+	Comments string
+}
+
+// UpdateBooking переносит бронирование на новые дату, время и размер компании с тем же ID.
+// Проверка дубликатов и свободных столиков, перепривязка столиков и запись в историю
+// выполняются в одной транзакции под блокировкой затронутых дат.
+func (db *Database) UpdateBooking(booking *Booking, changes BookingChanges, actor BookingActor) error {
+	defer observeQuery("UpdateBooking", time.Now())
+	start, err := bookingStart(changes.Date, changes.Time)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("неверный формат даты или времени: %v", err)
 	}
-	defer rows.Close()
+	end := start.Add(time.Duration(booking.Duration) * time.Minute)
 
-	var bookings []Booking
-	for rows.Next() {
-		var b Booking
-		err := rows.Scan(
-			&b.ID,
-			&b.Name,
-			&b.Phone,
-			&b.Date,
-			&b.Time,
-			&b.Guests,
-			&b.Comments,
-			&b.Status,
-			&b.Created,
-		)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Блокируем старую и новую дату всегда в одном порядке, чтобы встречные переносы не зависли
+	dates := []string{booking.Date, changes.Date}
+	sort.Strings(dates)
+	for i, date := range dates {
+		if i > 0 && date == dates[i-1] {
+			continue
+		}
+		if err := db.lockDate(tx, booking.RestaurantID, date); err != nil {
+			return err
+		}
+	}
+
+	if changes.Date != booking.Date {
+		var exists bool
+		err := tx.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM bookings
+				WHERE restaurant_id = $1 AND phone = $2 AND booking_date = $3 AND id != $4 AND status IN `+activeStatusesSQL+`
+			)
+		`, booking.RestaurantID, booking.Phone, changes.Date, booking.ID).Scan(&exists)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("ошибка при проверке существующего бронирования: %v", err)
+		}
+		if exists {
+			return ErrDuplicateBooking
 		}
-		bookings = append(bookings, b)
 	}
-	return bookings, nil
-}
 
-func (db *Database) UpdateBookingStatus(id int, status string) error {
-	log.Printf("Обновление статуса бронирования: ID=%d, новый статус=%s", id, status)
+	tables, err := db.GetTables(booking.RestaurantID)
+	if err != nil {
+		return err
+	}
+	occupancies, err := tableOccupancies(tx, booking.RestaurantID, start, end, booking.ID, 0)
+	if err != nil {
+		return err
+	}
+	assigned := assignTables(tables, busyAt(occupancies, start, end), changes.Guests)
+	if assigned == nil {
+		return ErrNoTableAvailable
+	}
 
-	// Сначала проверяем существование бронирования
-	_, err := db.GetBookingByID(id)
+	result, err := tx.Exec(`
+		UPDATE bookings
+		SET booking_date = $1, booking_time = $2, starts_at = $3, ends_at = $4, guests = $5, comments = $6,
+			updated_at = CURRENT_TIMESTAMP, revision = revision + 1
+		WHERE id = $7 AND status = $8
+	`, changes.Date, changes.Time, dbTime(start), dbTime(end), changes.Guests, changes.Comments, booking.ID, booking.Status)
 	if err != nil {
-		log.Printf("Ошибка при проверке существования бронирования %d: %v", id, err)
+		if isUniqueViolation(err) {
+			return ErrDuplicateBooking
+		}
 		return err
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrStatusChanged
+	}
+	// Напоминания о прежнем времени уже не относятся к визиту: к новому времени их пришлют заново
+	if !start.Equal(booking.StartsAt) {
+		_, err := tx.Exec(`DELETE FROM booking_notices WHERE booking_id = $1 AND notice IN ($2, $3)`,
+			booking.ID, NoticeReminder24h, NoticeReminder2h)
+		if err != nil {
+			return fmt.Errorf("ошибка сброса напоминаний: %v", err)
+		}
+	}
 
-	query := `
+	updated := *booking
+	updated.Date = changes.Date
+	updated.Time = changes.Time
+	updated.StartsAt, updated.EndsAt = start, end
+	updated.Guests = strconv.Itoa(changes.Guests)
+	updated.Comments = changes.Comments
+	updated.Tables = nil
+	updated.Revision++
+	updated.Updated = time.Now().In(config.Location)
+
+	if _, err := tx.Exec(`DELETE FROM booking_tables WHERE booking_id = $1`, booking.ID); err != nil {
+		return fmt.Errorf("ошибка освобождения столиков: %v", err)
+	}
+	for _, t := range assigned {
+		if _, err := tx.Exec(`INSERT INTO booking_tables (booking_id, table_id) VALUES ($1, $2)`, booking.ID, t.ID); err != nil {
+			return fmt.Errorf("ошибка привязки столика: %v", err)
+		}
+		updated.Tables = append(updated.Tables, t.Number)
+	}
+
+	oldValues, newValues := changedValues(bookingValues(booking), bookingValues(&updated))
+	if len(newValues) > 0 {
+		if err := recordBookingEvent(tx, booking.ID, EventUpdated, actor, oldValues, newValues); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*booking = updated
+	return nil
+}
+
+// UpdateBookingStatus переводит бронирование из статуса from в статус to, отмечает время перехода
+// и записывает смену статуса в историю. О подтверждении и отмене гостю уходит уведомление.
+// Если статус успел измениться с момента чтения, возвращает ErrStatusChanged.
+func (db *Database) UpdateBookingStatus(id int, from, to string, actor BookingActor) error {
+	defer observeQuery("UpdateBookingStatus", time.Now())
+	slog.Debug("Обновление статуса бронирования", "booking_id", id, "from", from, "to", to)
+
+	column, ok := statusTimestampColumns[to]
+	if !ok {
+		return fmt.Errorf("неизвестный статус бронирования: %s", to)
+	}
+
+	query := fmt.Sprintf(`
 		UPDATE bookings
-		SET status = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2
-		RETURNING id
-	`
-	var updatedID int
-	err = db.QueryRow(query, status, id).Scan(&updatedID)
+		SET status = $1, %s = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, revision = revision + 1
+		WHERE id = $2 AND status = $3
+	`, column)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, to, id, from)
+	if err != nil {
+		slog.Error("Ошибка при обновлении статуса бронирования", "booking_id", id, "error", err)
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrStatusChanged
+	}
+
+	err = recordBookingEvent(tx, id, EventStatusChanged, actor, map[string]string{"status": from}, map[string]string{"status": to})
 	if err != nil {
-		log.Printf("Ошибка при обновлении статуса бронирования %d: %v", id, err)
+		return err
+	}
+	if kind, ok := statusNotifications[to]; ok {
+		var booking Booking
+		row := tx.QueryRow(`SELECT `+bookingColumns+` FROM bookings WHERE id = $1`, id)
+		if err := scanBooking(row, &booking); err != nil {
+			return err
+		}
+		if err := enqueueNotifications(tx, kind, &booking); err != nil {
+			return err
+		}
+		if releasesSlot(to) {
+			if err := db.offerSlot(tx, booking.RestaurantID, booking.Date, booking.StartsAt); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 
-	log.Printf("Статус бронирования успешно обновлен: ID=%d, Status=%s", updatedID, status)
+	slog.Debug("Статус бронирования обновлен", "booking_id", id, "status", to)
 	return nil
 }
 
 func (db *Database) CreateAdminUser(username, password string) error {
-	// В реальном приложении пароль должен быть хэширован
+	defer observeQuery("CreateAdminUser", time.Now())
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO users (username, password_hash, is_admin)
-		VALUES ($1, $2, true)
+		INSERT INTO users (username, password_hash, is_admin, role)
+		VALUES ($1, $2, true, $3)
 		ON CONFLICT (username) DO NOTHING
 	`
-	_, err := db.Exec(query, username, password)
+	_, err = db.Exec(query, username, hash, RoleOwner)
 	return err
 }
 
-func (db *Database) ValidateAdmin(username, password string) (bool, error) {
-	var exists bool
+// AuthenticateUser проверяет учетные данные сотрудника и возвращает пользователя,
+// либо nil, если имя или пароль неверны или учетная запись отключена
+func (db *Database) AuthenticateUser(username, password string) (*User, error) {
+	defer observeQuery("AuthenticateUser", time.Now())
+	var user User
+	var hash string
 	query := `
-		SELECT EXISTS(
-			SELECT 1 FROM users
-			WHERE username = $1 AND password_hash = $2 AND is_admin = true
-		)
-	`
-	err := db.QueryRow(query, username, password).Scan(&exists)
-	return exists, err
-}
-
-func (db *Database) GetBookingsByPhone(phone string) ([]Booking, error) {
-	query := `
-		SELECT id, name, phone, booking_date, booking_time, guests, comments, status, created_at
-		FROM bookings
-		WHERE phone = $1
-		ORDER BY booking_date DESC, booking_time DESC
+		SELECT id, username, role, disabled, created_at, password_hash
+		FROM users
+		WHERE username = $1 AND disabled = false
 	`
-	rows, err := db.Query(query, phone)
+	err := db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Role, &user.Disabled, &user.CreatedAt, &hash)
+	if err == sql.ErrNoRows {
+		// Сравниваем с фиктивным хэшем, чтобы время ответа не выдавало существование пользователя
+		checkPassword(dummyPasswordHash, password)
+		return nil, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при поиске бронирований: %v", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	var bookings []Booking
-	for rows.Next() {
-		var b Booking
-		err := rows.Scan(
-			&b.ID,
-			&b.Name,
-			&b.Phone,
-			&b.Date,
-			&b.Time,
-			&b.Guests,
-			&b.Comments,
-			&b.Status,
-			&b.Created,
-		)
+	ok, legacy := checkPassword(hash, password)
+	if !ok {
+		return nil, nil
+	}
+
+	// Пароли, сохраненные до появления хэширования, перехэшируем при успешном входе
+	if legacy {
+		newHash, err := hashPassword(password)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при чтении бронирования: %v", err)
+			return nil, err
 		}
-		bookings = append(bookings, b)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по результатам: %v", err)
+		if _, err := db.Exec(`UPDATE users SET password_hash = $1 WHERE id = $2`, newHash, user.ID); err != nil {
+			return nil, fmt.Errorf("ошибка обновления хэша пароля: %v", err)
+		}
+		slog.Info("Пароль пользователя перехэширован", "username", user.Username)
 	}
-	return bookings, nil
+
+	return &user, nil
 }
 
 func (db *Database) GetBookingByID(id int) (*Booking, error) {
+	defer observeQuery("GetBookingByID", time.Now())
 	var booking Booking
-	log.Printf("Получение бронирования по ID: %d", id)
+	slog.Debug("Получение бронирования", "booking_id", id)
 
-	err := db.QueryRow(`
-		SELECT id, name, phone, booking_date, booking_time, guests, comments, status, created_at 
-		FROM bookings 
+	row := db.QueryRow(`
+		SELECT `+bookingColumns+`
+		FROM bookings
 		WHERE id = $1
-	`, id).Scan(
-		&booking.ID,
-		&booking.Name,
-		&booking.Phone,
-		&booking.Date,
-		&booking.Time,
-		&booking.Guests,
-		&booking.Comments,
-		&booking.Status,
-		&booking.Created,
-	)
-	if err != nil {
+	`, id)
+	if err := scanBooking(row, &booking); err != nil {
 		if err == sql.ErrNoRows {
-			log.Printf("Бронирование с ID %d не найдено", id)
+			slog.Debug("Бронирование не найдено", "booking_id", id)
 			return nil, fmt.Errorf("бронирование не найдено")
 		}
-		log.Printf("Ошибка при получении бронирования %d: %v", id, err)
+		slog.Error("Ошибка при получении бронирования", "booking_id", id, "error", err)
 		return nil, err
 	}
 
-	log.Printf("Успешно получено бронирование: ID=%d, Status=%s", booking.ID, booking.Status)
+	slog.Debug("Бронирование получено", "booking_id", booking.ID, "status", booking.Status)
+	single := []Booking{booking}
+	if err := db.attachTables(single); err != nil {
+		return nil, err
+	}
+	booking = single[0]
 	return &booking, nil
 }
 
-func (db *Database) GetFilteredBookings(filters map[string]string) ([]Booking, error) {
-	// Базовый запрос
+// SearchBookings возвращает страницу бронирований ресторана по фильтрам q в порядке q.Sort.
+// При равных значениях поля сортировки порядок задает ID, поэтому курсор однозначен.
+func (db *Database) SearchBookings(restaurantID int, q BookingQuery) (*BookingPage, error) {
+	defer observeQuery("SearchBookings", time.Now())
 	query := `
-		SELECT id, name, phone, booking_date, booking_time, guests, comments, status, created_at
+		SELECT ` + bookingColumns + `
 		FROM bookings
-		WHERE 1=1
+		WHERE restaurant_id = $1
 	`
-	args := []interface{}{}
-	argCount := 1
+	args := []interface{}{restaurantID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
 
-	// Добавляем фильтры
-	if date := filters["date"]; date != "" {
-		query += fmt.Sprintf(" AND booking_date = $%d", argCount)
-		args = append(args, date)
-		argCount++
+	// Время визита хранится в starts_at, время создания — в created_at
+	if !q.From.IsZero() {
+		query += " AND starts_at >= " + arg(dbTime(q.From))
 	}
-	if status := filters["status"]; status != "" {
-		query += fmt.Sprintf(" AND status = $%d", argCount)
-		args = append(args, status)
-		argCount++
+	if !q.To.IsZero() {
+		query += " AND starts_at < " + arg(dbTime(q.To))
 	}
-	if phone := filters["phone"]; phone != "" {
-		query += fmt.Sprintf(" AND phone LIKE $%d", argCount)
-		args = append(args, "%"+phone+"%")
-		argCount++
+	if !q.CreatedFrom.IsZero() {
+		query += " AND created_at >= " + arg(db.createdAtArg(q.CreatedFrom))
+	}
+	if !q.CreatedTo.IsZero() {
+		query += " AND created_at < " + arg(db.createdAtArg(q.CreatedTo))
+	}
+	if len(q.Statuses) > 0 {
+		placeholders := make([]string, len(q.Statuses))
+		for i, status := range q.Statuses {
+			placeholders[i] = arg(status)
+		}
+		query += " AND status IN (" + strings.Join(placeholders, ", ") + ")"
 	}
-	if name := filters["name"]; name != "" {
-		query += fmt.Sprintf(" AND name ILIKE $%d", argCount)
-		args = append(args, "%"+name+"%")
-		argCount++
+	if q.GuestsMin > 0 {
+		query += " AND guests >= " + arg(q.GuestsMin)
+	}
+	if q.GuestsMax > 0 {
+		query += " AND guests <= " + arg(q.GuestsMax)
+	}
+	if q.Phone != "" {
+		query += " AND phone LIKE " + arg("%"+q.Phone+"%")
+	}
+	if q.Name != "" {
+		query += fmt.Sprintf(" AND name %s %s", db.ilike(), arg("%"+q.Name+"%"))
+	}
+	if q.Search != "" {
+		pattern := arg("%" + q.Search + "%")
+		search := fmt.Sprintf("name %[1]s %[2]s OR comments %[1]s %[2]s", db.ilike(), pattern)
+		if digits := q.searchDigits(); digits != "" {
+			search += " OR phone LIKE " + arg("%"+digits+"%")
+		}
+		query += " AND (" + search + ")"
 	}
 
-	// Добавляем сортировку
-	query += " ORDER BY booking_date DESC, booking_time DESC"
+	// Сортировка по полю и ID; курсор продолжает список строго после последней строки страницы
+	field, desc := q.sortField()
+	order, cmp := "ASC", ">"
+	if desc {
+		order, cmp = "DESC", "<"
+	}
+	if q.Cursor != nil {
+		value, err := db.sortArg(field, q.Cursor.Value)
+		if err != nil {
+			return nil, err
+		}
+		v, id := arg(value), arg(q.Cursor.ID)
+		query += fmt.Sprintf(" AND (%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND id %[2]s %[4]s))", field, cmp, v, id)
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", field, order, order)
+	if q.Limit > 0 {
+		// Лишняя строка показывает, есть ли следующая страница
+		query += " LIMIT " + arg(q.Limit+1)
+	}
 
-	// Выполняем запрос
 	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении отфильтрованных бронирований: %v", err)
+		return nil, fmt.Errorf("ошибка при получении бронирований: %v", err)
 	}
 	defer rows.Close()
 
 	var bookings []Booking
 	for rows.Next() {
 		var b Booking
-		err := rows.Scan(
-			&b.ID,
-			&b.Name,
-			&b.Phone,
-			&b.Date,
-			&b.Time,
-			&b.Guests,
-			&b.Comments,
-			&b.Status,
-			&b.Created,
-		)
-		if err != nil {
+		if err := scanBooking(rows, &b); err != nil {
 			return nil, fmt.Errorf("ошибка при чтении бронирования: %v", err)
 		}
 		bookings = append(bookings, b)
 	}
-
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("ошибка при итерации по результатам: %v", err)
 	}
 
-	return bookings, nil
+	page := &BookingPage{Bookings: bookings}
+	if q.Limit > 0 && len(bookings) > q.Limit {
+		page.Bookings = bookings[:q.Limit]
+		page.NextCursor = q.nextCursor(&page.Bookings[q.Limit-1])
+	}
+	if err := db.attachTables(page.Bookings); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// sortArg переводит значение поля сортировки из курсора в параметр запроса
+func (db *Database) sortArg(field, value string) (interface{}, error) {
+	switch field {
+	case "starts_at", "created_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, fmt.Errorf("неверный курсор: %v", err)
+		}
+		if field == "created_at" {
+			return db.createdAtArg(t), nil
+		}
+		return dbTime(t), nil
+	case "guests":
+		return strconv.Atoi(value)
+	}
+	return value, nil
+}
+
+// createdAtArg передает момент времени для сравнения с created_at. В PostgreSQL колонка хранит
+// микросекунды, а в SQLite ее заполняет CURRENT_TIMESTAMP строкой без зоны с точностью до секунды.
+func (db *Database) createdAtArg(t time.Time) string {
+	if db.driver == DriverSQLite {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return t.UTC().Format(time.RFC3339Nano)
 }
 
-func (db *Database) CheckExistingBooking(phone, date string) (bool, error) {
+// CheckExistingBooking проверяет, есть ли у телефона активное бронирование на дату в ресторане
+func (db *Database) CheckExistingBooking(restaurantID int, phone, date string) (bool, error) {
+	defer observeQuery("CheckExistingBooking", time.Now())
 	var exists bool
 	query := `
 		SELECT EXISTS(
 			SELECT 1 FROM bookings
-			WHERE phone = $1 AND booking_date = $2 AND status != 'cancelled'
+			WHERE restaurant_id = $1 AND phone = $2 AND booking_date = $3 AND status IN ` + activeStatusesSQL + `
 		)
 	`
-	err := db.QueryRow(query, phone, date).Scan(&exists)
+	err := db.QueryRow(query, restaurantID, phone, date).Scan(&exists)
 	return exists, err
 }
 
+// CheckPhoneNameUnique проверяет, что номер не закреплен за другим именем ни в одном ресторане сети
 func (db *Database) CheckPhoneNameUnique(phone, name string) (bool, error) {
+	defer observeQuery("CheckPhoneNameUnique", time.Now())
 	var existingName string
-	query := `SELECT name FROM bookings WHERE phone = $1 LIMIT 1`
+	// Номер закреплен за именем из первого бронирования по всей сети, как в MemoryStore
+	query := `SELECT name FROM bookings WHERE phone = $1 ORDER BY id LIMIT 1`
 	err := db.QueryRow(query, phone).Scan(&existingName)
 	if err == sql.ErrNoRows {
 		return true, nil // Нет такого номера — можно добавлять
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Типы событий в истории бронирования
+const (
+	EventCreated       = "created"
+	EventStatusChanged = "status_changed"
+	EventUpdated       = "updated"
+)
+
+// Каналы, через которые меняется бронирование
+const (
+	ChannelWeb   = "web"
+	ChannelAdmin = "admin"
+	ChannelAPI   = "api"
+	// Фоновые задания планировщика
+	ChannelSystem = "system"
+)
+
+// BookingActor — кто и откуда меняет бронирование. UserID не задан, если это гость или планировщик.
+type BookingActor struct {
+	UserID  *int
+	Channel string
+	IP      string
+}
+
+// systemActor — автор изменений, которые делает планировщик
+var systemActor = BookingActor{Channel: ChannelSystem}
+
+func (a BookingActor) kind() string {
+	if a.UserID != nil {
+		return "staff"
+	}
+	if a.Channel == ChannelSystem {
+		return "system"
+	}
+	return "guest"
+}
+
+// requestActor определяет автора изменения: сотрудника из сессии или гостя, и канал по адресу запроса
+func requestActor(r *http.Request) BookingActor {
+	actor := BookingActor{Channel: ChannelWeb, IP: clientIP(r)}
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/admin/"):
+		actor.Channel = ChannelAdmin
+	case isAPIRequest(r):
+		actor.Channel = ChannelAPI
+	}
+	if user := currentUser(r); user != nil {
+		actor.UserID = &user.ID
+	}
+	return actor
+}
+
+// BookingEvent — запись в истории бронирования
+type BookingEvent struct {
+	ID        int               `json:"id"`
+	BookingID int               `json:"booking_id"`
+	Type      string            `json:"type"`
+	Actor     string            `json:"actor"`
+	UserID    *int              `json:"user_id,omitempty"`
+	Username  string            `json:"username,omitempty"`
+	Channel   string            `json:"channel" schema:"enum=channel"`
+	IP        string            `json:"ip"`
+	OldValues map[string]string `json:"old_values,omitempty"`
+	NewValues map[string]string `json:"new_values,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+var eventTitles = map[string]string{
+	EventCreated:       "Создано",
+	EventStatusChanged: "Смена статуса",
+	EventUpdated:       "Изменено",
+}
+
+var fieldTitles = map[string]string{
+	"name":     "Имя",
+	"phone":    "Телефон",
+	"email":    "Email",
+	"date":     "Дата",
+	"time":     "Время",
+	"guests":   "Гости",
+	"comments": "Комментарий",
+	"status":   "Статус",
+	"tables":   "Столики",
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// bookingValues — снимок полей бронирования для истории
+func bookingValues(b *Booking) map[string]string {
+	tables := make([]string, len(b.Tables))
+	for i, number := range b.Tables {
+		tables[i] = strconv.Itoa(number)
+	}
+	return map[string]string{
+		"name":     b.Name,
+		"phone":    b.Phone,
+		"email":    b.Email,
+		"date":     b.Date,
+		"time":     b.Time,
+		"guests":   b.Guests,
+		"comments": b.Comments,
+		"status":   b.Status,
+		"tables":   strings.Join(tables, ", "),
+	}
+}
+
+// changedValues оставляет в снимках до и после только изменившиеся поля
+func changedValues(before, after map[string]string) (map[string]string, map[string]string) {
+	oldValues := make(map[string]string)
+	newValues := make(map[string]string)
+	for field, value := range after {
+		if before[field] != value {
+			oldValues[field] = before[field]
+			newValues[field] = value
+		}
+	}
+	return oldValues, newValues
+}
+
+func encodeEventValues(values map[string]string) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+func decodeEventValues(raw sql.NullString) map[string]string {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var values map[string]string
+	if err := json.Unmarshal([]byte(raw.String), &values); err != nil {
+		slog.Error("Ошибка при разборе значений события", "error", err)
+		return nil
+	}
+	return values
+}
+
+// recordBookingEvent добавляет запись в историю; вызывается в той же транзакции, что и само изменение
+func recordBookingEvent(ex execer, bookingID int, eventType string, actor BookingActor, oldValues, newValues map[string]string) error {
+	_, err := ex.Exec(`
+		INSERT INTO booking_events (booking_id, event_type, actor, user_id, channel, ip, old_values, new_values)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, bookingID, eventType, actor.kind(), actor.UserID, actor.Channel, actor.IP, encodeEventValues(oldValues), encodeEventValues(newValues))
+	if err != nil {
+		return fmt.Errorf("ошибка записи истории бронирования: %v", err)
+	}
+	return nil
+}
+
+func (db *Database) GetBookingEvents(bookingID int) ([]BookingEvent, error) {
+	defer observeQuery("GetBookingEvents", time.Now())
+	rows, err := db.Query(`
+		SELECT e.id, e.booking_id, e.event_type, e.actor, e.user_id, COALESCE(u.username, ''),
+			e.channel, COALESCE(e.ip, ''), e.old_values, e.new_values, e.created_at
+		FROM booking_events e
+		LEFT JOIN users u ON u.id = e.user_id
+		WHERE e.booking_id = $1
+		ORDER BY e.created_at, e.id
+	`, bookingID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении истории бронирования: %v", err)
+	}
+	defer rows.Close()
+
+	events := []BookingEvent{}
+	for rows.Next() {
+		var e BookingEvent
+		var oldValues, newValues sql.NullString
+		if err := rows.Scan(&e.ID, &e.BookingID, &e.Type, &e.Actor, &e.UserID, &e.Username,
+			&e.Channel, &e.IP, &oldValues, &newValues, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении истории бронирования: %v", err)
+		}
+		e.CreatedAt = e.CreatedAt.In(config.Location)
+		e.OldValues = decodeEventValues(oldValues)
+		e.NewValues = decodeEventValues(newValues)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func handleBookingHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+
+	booking, err := db.GetBookingByID(id)
+	if err != nil || booking.RestaurantID != currentRestaurant(r).ID {
+		http.Error(w, "Бронирование не найдено", http.StatusNotFound)
+		return
+	}
+	events, err := db.GetBookingEvents(id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении истории бронирования", "booking_id", id, "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(r, "templates/admin/history.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона history.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Booking *Booking
+		Events  []BookingEvent
+	}{booking, events}
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона history.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	}
+}
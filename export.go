@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// exportPageSize — сколько строк выгрузка читает из хранилища за один запрос
+	exportPageSize = 500
+
+	// Загрузка читается в память целиком, поэтому файл и число строк ограничены
+	importMaxBytes = 2 << 20
+	importMaxRows  = 2000
+)
+
+// exportColumn — столбец выгрузки. Заголовки совпадают с теми, что понимает загрузка,
+// поэтому выгруженный файл можно загрузить обратно (лишние столбцы пропускаются).
+type exportColumn struct {
+	Title string
+	Value func(b *Booking) interface{}
+}
+
+var exportColumns = []exportColumn{
+	{"ID", func(b *Booking) interface{} { return b.ID }},
+	{"Дата", func(b *Booking) interface{} { return b.Date }},
+	{"Время", func(b *Booking) interface{} { return b.Time }},
+	{"Гостей", func(b *Booking) interface{} {
+		if n, err := strconv.Atoi(b.Guests); err == nil {
+			return n
+		}
+		return b.Guests
+	}},
+	{"Имя", func(b *Booking) interface{} { return b.Name }},
+	{"Телефон", func(b *Booking) interface{} { return b.Phone }},
+	{"Email", func(b *Booking) interface{} { return b.Email }},
+	{"Комментарий", func(b *Booking) interface{} { return b.Comments }},
+	{"Статус", func(b *Booking) interface{} { return statusTitle(b.Status) }},
+	{"Столики", func(b *Booking) interface{} { return joinInts(b.Tables, ", ") }},
+	{"Создано", func(b *Booking) interface{} { return b.Created.In(config.Location).Format("2006-01-02 15:04") }},
+}
+
+// bookingRowWriter — формат файла выгрузки: строки пишутся по одной, Close завершает файл
+type bookingRowWriter interface {
+	WriteRow(cells []interface{}) error
+	Close() error
+}
+
+// csvRowWriter пишет CSV в UTF-8 с BOM, чтобы Excel не путал кодировку
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func newCSVRowWriter(w io.Writer) (*csvRowWriter, error) {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	return &csvRowWriter{w: csv.NewWriter(w)}, nil
+}
+
+func (c *csvRowWriter) WriteRow(cells []interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = csvSafe(fmt.Sprint(cell))
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvRowWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvSafe не дает табличному редактору принять текст гостя за формулу: «=HYPERLINK(...)»
+// в имени или комментарии выгружается с апострофом в начале
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// handleExportBookings выгружает в CSV или XLSX все бронирования, которые попадают под фильтры
+// списка (parseBookingQuery), в его порядке; limit и cursor не учитываются. Файл не собирается
+// в памяти: бронирования читаются страницами по курсору и сразу отправляются клиенту.
+func handleExportBookings(w http.ResponseWriter, r *http.Request) {
+	format := "csv"
+	if strings.HasSuffix(r.URL.Path, ".xlsx") {
+		format = "xlsx"
+	}
+
+	values := r.URL.Query()
+	values.Del("limit")
+	values.Del("cursor")
+	q, err := parseBookingQuery(values)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	q.Limit = exportPageSize
+
+	rest := currentRestaurant(r)
+	page, err := db.SearchBookings(rest.ID, q)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении бронирований", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	filename := fmt.Sprintf("bookings-%s-%s.%s", rest.Slug, time.Now().In(config.Location).Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	var out bookingRowWriter
+	if format == "xlsx" {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		out, err = newXLSXWriter(w, "Бронирования")
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		out, err = newCSVRowWriter(w)
+	}
+
+	// После начала ответа сообщить об ошибке уже нельзя: соединение обрывается,
+	// чтобы клиент получил ошибку загрузки, а не молча обрезанный файл
+	abort := func(err error) {
+		slog.ErrorContext(r.Context(), "Выгрузка бронирований прервана", "format", format, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+	if err != nil {
+		abort(err)
+	}
+
+	header := make([]interface{}, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column.Title
+	}
+	if err := out.WriteRow(header); err != nil {
+		abort(err)
+	}
+
+	// Каждая страница продлевает срок записи ответа: большая выгрузка не упирается
+	// в http_write_timeout, а зависший клиент по-прежнему отключается
+	rc := http.NewResponseController(w)
+	rows := 0
+	for {
+		for i := range page.Bookings {
+			cells := make([]interface{}, len(exportColumns))
+			for j, column := range exportColumns {
+				cells[j] = column.Value(&page.Bookings[i])
+			}
+			if err := out.WriteRow(cells); err != nil {
+				abort(err)
+			}
+		}
+		rows += len(page.Bookings)
+		if page.NextCursor == "" {
+			break
+		}
+
+		rc.Flush()
+		rc.SetWriteDeadline(time.Now().Add(config.HTTPWriteTimeout))
+		q.Cursor = q.cursorAfter(&page.Bookings[len(page.Bookings)-1])
+		if page, err = db.SearchBookings(rest.ID, q); err != nil {
+			abort(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		abort(err)
+	}
+	slog.InfoContext(r.Context(), "Бронирования выгружены", "format", format, "rows", rows)
+}
+
+// importColumns — столбцы загрузки и их допустимые заголовки (без учета регистра)
+var importColumns = map[string][]string{
+	"name":     {"name", "имя", "гость"},
+	"phone":    {"phone", "телефон"},
+	"email":    {"email", "e-mail", "почта"},
+	"date":     {"date", "дата"},
+	"time":     {"time", "время"},
+	"guests":   {"guests", "гостей", "гости"},
+	"comments": {"comments", "comment", "комментарий", "комментарии"},
+}
+
+var importRequiredColumns = []string{"name", "phone", "date", "time", "guests"}
+
+// bookingImportRow — результат по строке файла. Row — номер строки в файле, заголовок — строка 1.
+type bookingImportRow struct {
+	Row       int    `json:"row"`
+	Name      string `json:"name"`
+	Date      string `json:"date"`
+	Time      string `json:"time"`
+	Guests    string `json:"guests"`
+	OK        bool   `json:"ok"`
+	Code      string `json:"code,omitempty"`
+	Error     string `json:"error,omitempty"`
+	BookingID int    `json:"booking_id,omitempty"`
+	Tables    []int  `json:"tables,omitempty"`
+}
+
+// bookingImportReport — отчет о загрузке. При пробной загрузке (DryRun) ничего не сохраняется,
+// а OK — число строк, которые были бы созданы.
+type bookingImportReport struct {
+	DryRun bool               `json:"dry_run"`
+	Total  int                `json:"total"`
+	OK     int                `json:"ok"`
+	Failed int                `json:"failed"`
+	Rows   []bookingImportRow `json:"rows"`
+}
+
+// handleImportBookings создает бронирования из CSV: файл в поле file формы multipart/form-data
+// или тело запроса целиком. Каждая строка проверяется по тем же правилам, что заявка гостя
+// (handleCreateBooking), и создается отдельно: ошибка в строке не отменяет остальные.
+// С параметром dry_run=1 ничего не сохраняется — отчет показывает, какие строки не пройдут.
+func handleImportBookings(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "1" || r.URL.Query().Get("dry_run") == "true"
+
+	data, err := readImportFile(w, r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, "request_too_large",
+				fmt.Sprintf("Файл больше %d МБ", importMaxBytes>>20))
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	records, err := parseImportCSV(data)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+
+	rest := currentRestaurant(r)
+	report := bookingImportReport{DryRun: dryRun, Rows: []bookingImportRow{}}
+	plan := &importPlan{restaurant: rest}
+	for _, record := range records {
+		row := bookingImportRow{Row: record.line, Name: record.data.Name, Date: record.data.Date, Time: record.data.Time, Guests: record.data.Guests}
+
+		var booking *Booking
+		if dryRun {
+			booking, err = validateBookingRequest(rest, record.data)
+			if err == nil {
+				err = plan.reserve(booking)
+			}
+		} else {
+			booking, err = createBooking(r, rest, record.data, "import")
+		}
+
+		var bookingErr *BookingError
+		switch {
+		case err == nil:
+			row.OK, row.BookingID, row.Tables = true, booking.ID, booking.Tables
+			report.OK++
+		case errors.As(err, &bookingErr):
+			row.Code, row.Error = bookingErr.code(), bookingErr.Message
+		case errors.Is(err, ErrDuplicateBooking):
+			row.Code, row.Error = "duplicate_booking", err.Error()
+		case errors.Is(err, ErrPhoneNameMismatch):
+			row.Code, row.Error = "phone_name_mismatch", "Этот номер уже зарегистрирован на другое имя"
+		case errors.Is(err, ErrNoTableAvailable):
+			row.Code, row.Error = "no_table_available", "На выбранное время нет свободных столиков"
+		default:
+			row.Code, row.Error = "internal_error", fmt.Sprintf("Ошибка при создании бронирования: %v", err)
+		}
+		if !row.OK {
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	report.Total = len(report.Rows)
+
+	slog.InfoContext(r.Context(), "Загрузка бронирований", "restaurant", rest.Slug, "dry_run", dryRun,
+		"total", report.Total, "ok", report.OK, "failed", report.Failed)
+	writeJSON(w, http.StatusOK, report)
+}
+
+// readImportFile читает CSV из поля file формы или из тела запроса
+func readImportFile(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(r.Body)
+	}
+
+	if err := r.ParseMultipartForm(importMaxBytes); err != nil {
+		return nil, err
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("файл не выбран (поле file)")
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// importRecord — строка файла с заявкой на бронирование
+type importRecord struct {
+	line int
+	data BookingRequest
+}
+
+// parseImportCSV разбирает CSV с заголовком. Разделитель — запятая, точка с запятой
+// (так сохраняет Excel с русскими настройками) или табуляция — определяется по заголовку.
+// Дата принимается как YYYY-MM-DD или DD.MM.YYYY.
+func parseImportCSV(data []byte) ([]importRecord, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	firstLine, _, _ := bufio.NewReader(bytes.NewReader(data)).ReadLine()
+	comma := ','
+	for _, sep := range []rune{';', '\t'} {
+		if strings.Count(string(firstLine), string(sep)) > strings.Count(string(firstLine), string(comma)) {
+			comma = sep
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("файл пуст")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка в CSV: %v", err)
+	}
+	index := map[string]int{}
+	for i, title := range header {
+		title = strings.ToLower(strings.TrimSpace(title))
+		for column, aliases := range importColumns {
+			if _, seen := index[column]; !seen && slices.Contains(aliases, title) {
+				index[column] = i
+			}
+		}
+	}
+	var missing []string
+	for _, column := range importRequiredColumns {
+		if _, ok := index[column]; !ok {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("в заголовке нет столбцов: %s", strings.Join(missing, ", "))
+	}
+
+	var records []importRecord
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка в CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(column string) string {
+			if i, ok := index[column]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(fields, "")) == "" {
+			continue
+		}
+		if len(records) == importMaxRows {
+			return nil, fmt.Errorf("в файле больше %d строк, разделите его на части", importMaxRows)
+		}
+		records = append(records, importRecord{line: line, data: BookingRequest{
+			Name:     field("name"),
+			Phone:    field("phone"),
+			Email:    field("email"),
+			Date:     importDate(field("date")),
+			Time:     field("time"),
+			Guests:   field("guests"),
+			Comments: field("comments"),
+		}})
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("в файле нет бронирований")
+	}
+	return records, nil
+}
+
+// importDate переводит DD.MM.YYYY в YYYY-MM-DD; остальное возвращает как есть для обычной проверки
+func importDate(date string) string {
+	if d, err := time.Parse("02.01.2006", date); err == nil {
+		return d.Format("2006-01-02")
+	}
+	return date
+}
+
+// importPlan повторяет при пробной загрузке проверки занятости из CreateBooking, ничего не сохраняя:
+// дубликат по телефону на дату, номер на другое имя и свободные столики. Строки файла, прошедшие проверку, считаются
+// уже созданными, чтобы две строки не получили один и тот же последний столик.
+type importPlan struct {
+	restaurant *Restaurant
+	tables     []Table
+	reserved   []tableOccupancy
+	phones     map[string]bool   // телефон|дата из прошедших строк
+	names      map[string]string // телефон → имя из прошедших строк
+}
+
+func (p *importPlan) reserve(booking *Booking) error {
+	if p.tables == nil {
+		tables, err := db.GetTables(p.restaurant.ID)
+		if err != nil {
+			return err
+		}
+		p.tables = tables
+		p.phones = map[string]bool{}
+		p.names = map[string]string{}
+	}
+
+	// Те же проверки, что и при создании бронирования, плюс строки, прошедшие раньше в этом файле
+	key := booking.Phone + "|" + booking.Date
+	if p.phones[key] {
+		return ErrDuplicateBooking
+	}
+	exists, err := db.CheckExistingBooking(p.restaurant.ID, booking.Phone, booking.Date)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicateBooking
+	}
+	if name, ok := p.names[booking.Phone]; ok && name != booking.Name {
+		return ErrPhoneNameMismatch
+	}
+	unique, err := db.CheckPhoneNameUnique(booking.Phone, booking.Name)
+	if err != nil {
+		return err
+	}
+	if !unique {
+		return ErrPhoneNameMismatch
+	}
+
+	start, _ := bookingStart(booking.Date, booking.Time)
+	end := start.Add(time.Duration(booking.Duration) * time.Minute)
+	occupancies, err := db.TableOccupancies(p.restaurant.ID, start, end, 0)
+	if err != nil {
+		return err
+	}
+	occupancies = append(occupancies, p.reserved...)
+	guests, _ := strconv.Atoi(booking.Guests)
+	assigned := assignTables(p.tables, busyAt(occupancies, start, end), guests)
+	if assigned == nil {
+		return ErrNoTableAvailable
+	}
+
+	p.phones[key] = true
+	p.names[booking.Phone] = booking.Name
+	for _, t := range assigned {
+		booking.Tables = append(booking.Tables, t.Number)
+		p.reserved = append(p.reserved, tableOccupancy{TableID: t.ID, Start: start, End: end})
+	}
+	return nil
+}
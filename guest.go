@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// GetBookingByToken находит бронирование по токену ссылки управления; nil, если ссылка неверна
+func (db *Database) GetBookingByToken(token string) (*Booking, error) {
+	defer observeQuery("GetBookingByToken", time.Now())
+	if token == "" {
+		return nil, nil
+	}
+
+	var booking Booking
+	row := db.QueryRow(`
+		SELECT `+bookingColumns+`
+		FROM bookings
+		WHERE manage_token_hash = $1
+	`, hashToken(token))
+	if err := scanBooking(row, &booking); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	single := []Booking{booking}
+	if err := db.attachTables(single); err != nil {
+		return nil, err
+	}
+	return &single[0], nil
+}
+
+// CheckBookingToken проверяет, что токен относится к бронированию id
+func (db *Database) CheckBookingToken(id int, token string) (bool, error) {
+	defer observeQuery("CheckBookingToken", time.Now())
+	if token == "" {
+		return false, nil
+	}
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM bookings WHERE id = $1 AND manage_token_hash = $2)
+	`, id, hashToken(token)).Scan(&exists)
+	return exists, err
+}
+
+// managedBooking загружает бронирование по токену из адреса; при ошибке сам отвечает клиенту
+func managedBooking(w http.ResponseWriter, r *http.Request) (*Booking, bool) {
+	// Токен в адресе не должен уходить на сторонние сайты через Referer
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	booking, err := db.GetBookingByToken(mux.Vars(r)["token"])
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении бронирования по ссылке", "error", err)
+		writeInternalError(w, r)
+		return nil, false
+	}
+	if booking == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Бронирование не найдено. Проверьте ссылку.")
+		return nil, false
+	}
+	return booking, true
+}
+
+// managedBookingView — бронирование на странице управления с подписью статуса и доступными гостю действиями
+type managedBookingView struct {
+	*Booking
+	StatusTitle string `json:"status_title"`
+	CanCancel   bool   `json:"can_cancel"`
+	CanModify   bool   `json:"can_modify"`
+}
+
+func handleGetManagedBooking(w http.ResponseWriter, r *http.Request) {
+	booking, ok := managedBooking(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(managedBookingView{booking, statusTitle(booking.Status), canTransition(booking.Status, StatusCancelled), canModify(booking.Status)})
+}
+
+// bookingUpdated — ответ о переносе бронирования с новыми столиками
+type bookingUpdated struct {
+	Message string `json:"message"`
+	Tables  []int  `json:"tables"`
+}
+
+// manageUpdateRequest — перенос бронирования гостем по ссылке управления
+type manageUpdateRequest struct {
+	Date     string `json:"date" schema:"required,format=date"`
+	Time     string `json:"time" schema:"required,format=time"`
+	Guests   string `json:"guests" schema:"required,format=integer"`
+	Comments string `json:"comments"`
+}
+
+// handleUpdateManagedBooking переносит бронирование по ссылке управления на новые дату, время
+// и количество гостей с теми же проверками, что и при создании
+func handleUpdateManagedBooking(w http.ResponseWriter, r *http.Request) {
+	booking, ok := managedBooking(w, r)
+	if !ok {
+		return
+	}
+
+	var data manageUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+		return
+	}
+
+	if !canModify(booking.Status) {
+		writeBookingError(w, r, &BookingError{
+			Status:  http.StatusConflict,
+			Message: "Бронирование в статусе «" + statusTitle(booking.Status) + "» изменить нельзя",
+			Reason:  "not_modifiable",
+		})
+		return
+	}
+
+	if _, err := parseBookingDate(data.Date); err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	timeStr, err := parseBookingTime(data.Time)
+	if err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	guests, err := parseGuests(data.Guests)
+	if err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+
+	// Перенос проверяется по правилам ресторана, в котором сделано бронирование
+	rest, err := db.GetRestaurantByID(booking.RestaurantID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении ресторана", "restaurant_id", booking.RestaurantID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	schedule, err := db.GetDaySchedule(rest.ID, data.Date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении расписания", "date", data.Date, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if err := validateBookingSlot(rest, data.Date, timeStr, guests, schedule); err != nil {
+		slog.InfoContext(r.Context(), "Перенос бронирования отклонен", "booking_id", booking.ID, "date", data.Date, "time", timeStr, "reason", err)
+		writeBookingError(w, r, err)
+		return
+	}
+
+	changes := BookingChanges{Date: data.Date, Time: timeStr, Guests: guests, Comments: data.Comments}
+	if err := db.UpdateBooking(booking, changes, requestActor(r)); err != nil {
+		if writeBookingConflict(w, r, err) {
+			slog.InfoContext(r.Context(), "Перенос бронирования отклонен", "booking_id", booking.ID, "date", data.Date, "time", timeStr, "reason", err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Ошибка при изменении бронирования", "booking_id", booking.ID, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при изменении бронирования")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Бронирование изменено",
+		"booking_id", booking.ID, "date", booking.Date, "time", booking.Time, "guests", guests, "tables", booking.Tables)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookingUpdated{Message: "Бронирование успешно изменено", Tables: booking.Tables})
+}
+
+func handleManagePage(w http.ResponseWriter, r *http.Request) {
+	booking, ok := managedBooking(w, r)
+	if !ok {
+		return
+	}
+
+	rest, err := db.GetRestaurantByID(booking.RestaurantID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении ресторана", "restaurant_id", booking.RestaurantID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(withRestaurant(r, rest), "templates/manage.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона manage.html", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	data := struct {
+		Booking    *Booking
+		Restaurant *Restaurant
+		Token      string
+	}{booking, rest, mux.Vars(r)["token"]}
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона manage.html", "error", err)
+		writeInternalError(w, r)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Статусы бронирования
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+	StatusSeated    = "seated"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusNoShow    = "no_show"
+	// Не подтверждено вовремя; в этот статус бронирование переводит только планировщик
+	StatusExpired = "expired"
+)
+
+// bookingTransitions — допустимые переходы между статусами бронирования.
+// Завершенные, отмененные, неявки и истекшие больше не меняются.
+var bookingTransitions = map[string][]string{
+	StatusPending:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusSeated, StatusNoShow, StatusCancelled},
+	StatusSeated:    {StatusCompleted},
+	StatusCompleted: {},
+	StatusCancelled: {},
+	StatusNoShow:    {},
+	StatusExpired:   {},
+}
+
+// Статусы, которые гость может выставить сам по ссылке управления
+var guestStatuses = []string{StatusCancelled}
+
+// Активные бронирования занимают столики и не допускают второго бронирования
+// на тот же телефон и дату. Список должен совпадать с условием индекса idx_bookings_phone_date_active.
+const activeStatusesSQL = "('pending', 'confirmed', 'seated')"
+
+var activeStatuses = []string{StatusPending, StatusConfirmed, StatusSeated}
+
+// Статусы, в которых гость может изменить дату, время и состав брони
+var modifiableStatuses = []string{StatusPending, StatusConfirmed}
+
+// Переходы, после которых столик освобождается и предлагается листу ожидания
+var releasingStatuses = []string{StatusCancelled, StatusExpired}
+
+// Колонки, в которых хранится время перехода в статус
+var statusTimestampColumns = map[string]string{
+	StatusConfirmed: "confirmed_at",
+	StatusSeated:    "seated_at",
+	StatusCompleted: "completed_at",
+	StatusCancelled: "cancelled_at",
+	StatusNoShow:    "no_show_at",
+	StatusExpired:   "expired_at",
+}
+
+// statusView — подпись и оформление статуса, а также кнопки перехода в него в админке
+type statusView struct {
+	Title  string
+	Badge  string
+	Action string
+	Button string
+}
+
+var statusViews = map[string]statusView{
+	StatusPending:   {Title: "Ожидает", Badge: "bg-warning text-dark"},
+	StatusConfirmed: {Title: "Подтверждено", Badge: "bg-success", Action: "Подтвердить", Button: "btn-success"},
+	StatusSeated:    {Title: "Гости за столом", Badge: "bg-primary", Action: "Посадить", Button: "btn-primary"},
+	StatusCompleted: {Title: "Завершено", Badge: "bg-secondary", Action: "Завершить", Button: "btn-outline-secondary"},
+	StatusCancelled: {Title: "Отменено", Badge: "bg-danger", Action: "Отменить", Button: "btn-danger"},
+	StatusNoShow:    {Title: "Не пришли", Badge: "bg-dark", Action: "Не пришли", Button: "btn-outline-dark"},
+	StatusExpired:   {Title: "Истекло", Badge: "bg-light text-dark border"},
+}
+
+var ErrStatusChanged = errors.New("статус бронирования уже изменился, обновите страницу")
+
+func validStatus(status string) bool {
+	_, ok := bookingTransitions[status]
+	return ok
+}
+
+// nextStatuses возвращает статусы, в которые можно перевести бронирование из статуса from
+func nextStatuses(from string) []string {
+	return bookingTransitions[from]
+}
+
+func canTransition(from, to string) bool {
+	return containsStatus(bookingTransitions[from], to)
+}
+
+func guestCanSetStatus(status string) bool {
+	return containsStatus(guestStatuses, status)
+}
+
+func canModify(status string) bool {
+	return containsStatus(modifiableStatuses, status)
+}
+
+func releasesSlot(status string) bool {
+	return containsStatus(releasingStatuses, status)
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func statusTitle(status string) string {
+	if view, ok := statusViews[status]; ok {
+		return view.Title
+	}
+	return status
+}
+
+// transitionError — отказ в недопустимой смене статуса
+func transitionError(from, to string) *BookingError {
+	return &BookingError{
+		Status:  http.StatusConflict,
+		Message: fmt.Sprintf("Нельзя перевести бронирование из статуса «%s» в «%s»", statusTitle(from), statusTitle(to)),
+		Reason:  "invalid_transition",
+	}
+}
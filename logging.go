@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Журнал сервера пишется через log/slog: уровень и формат (text или json) задаются в конфигурации,
+// к записям запроса добавляется request_id, а телефоны, имена и email гостей маскируются
+// до записи, чтобы персональные данные не попадали в журнал.
+
+type requestIDContextKey struct{}
+
+// setupLogging настраивает журнал по умолчанию. Сообщения пакета log тоже проходят через него.
+func setupLogging(c *Config) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if c.LogFormat == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(&maskingHandler{next: handler}))
+}
+
+// fatal записывает ошибку и завершает процесс
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// requestID возвращает идентификатор запроса из контекста
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestIDMiddleware присваивает запросу идентификатор: берет его из заголовка X-Request-ID
+// (если его выставил балансировщик) или генерирует новый, и возвращает клиенту в ответе
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			buf := make([]byte, 8)
+			rand.Read(buf)
+			id = hex.EncodeToString(buf)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id)))
+	})
+}
+
+// accessLogMiddleware записывает каждый запрос с шаблоном маршрута вместо пути:
+// в путях бывают токены ссылок гостей. Статика, проверки состояния и метрики пишутся на уровне debug.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := routeTemplate(r)
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case route == "/healthz" || route == "/readyz" || route == "/metrics" || route == "/static/":
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(r.Context(), level, "HTTP-запрос",
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.Int("status", rec.status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	})
+}
+
+// maskingHandler добавляет request_id и маскирует персональные данные перед записью в журнал
+type maskingHandler struct {
+	next slog.Handler
+}
+
+func (h *maskingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *maskingHandler) Handle(ctx context.Context, r slog.Record) error {
+	masked := slog.NewRecord(r.Time, r.Level, maskPhones(r.Message), r.PC)
+	if id := requestID(ctx); id != "" {
+		masked.AddAttrs(slog.String("request_id", id))
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		masked.AddAttrs(maskAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, masked)
+}
+
+func (h *maskingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = maskAttr(a)
+	}
+	return &maskingHandler{next: h.next.WithAttrs(masked)}
+}
+
+func (h *maskingHandler) WithGroup(name string) slog.Handler {
+	return &maskingHandler{next: h.next.WithGroup(name)}
+}
+
+// maskAttr маскирует значение по ключу (phone, name, email) и телефоны в любых строках и ошибках
+func maskAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		masked := make([]any, len(group))
+		for i, ga := range group {
+			masked[i] = maskAttr(ga)
+		}
+		return slog.Group(a.Key, masked...)
+	case slog.KindString:
+		return slog.String(a.Key, maskValue(a.Key, a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, maskPhones(err.Error()))
+		}
+	}
+	return a
+}
+
+func maskValue(key, value string) string {
+	switch strings.ToLower(key) {
+	case "phone":
+		return maskPhone(value)
+	case "name":
+		return maskName(value)
+	case "email":
+		return maskEmail(value)
+	}
+	return maskPhones(value)
+}
+
+// Российские номера в любом написании: 79991234567, +7 (999) 123-45-67, 8-999-123-45-67
+var phonePattern = regexp.MustCompile(`(?:\+7|\b[78])[\s(-]*\d{3}[\s)-]*\d{3}[\s-]*\d{2}[\s-]*\d{2}\b`)
+
+// maskPhones заменяет номера телефонов в произвольном тексте
+func maskPhones(s string) string {
+	return phonePattern.ReplaceAllStringFunc(s, maskPhone)
+}
+
+// maskPhone оставляет код оператора и две последние цифры: 7999*****67
+func maskPhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) < 6 {
+		return "***"
+	}
+	return digits[:4] + strings.Repeat("*", len(digits)-6) + digits[len(digits)-2:]
+}
+
+// maskName оставляет первую букву каждого слова: «Иван Петров» → «И*** П***»
+func maskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		r, _ := utf8.DecodeRuneInString(word)
+		words[i] = string(r) + "***"
+	}
+	return strings.Join(words, " ")
+}
+
+// maskEmail оставляет первую букву адреса и домен: i***@example.com
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return maskName(email)
+	}
+	r, _ := utf8.DecodeRuneInString(email)
+	return string(r) + "***" + email[at:]
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestMaskPhone(t *testing.T) {
+	tests := []struct{ phone, want string }{
+		{"79991234567", "7999*****67"},
+		{"+7 (999) 123-45-67", "7999*****67"},
+		{"8-999-123-45-67", "8999*****67"},
+		{"123456", "123456"},
+		{"12345", "***"},
+		{"", "***"},
+	}
+	for _, tt := range tests {
+		if got := maskPhone(tt.phone); got != tt.want {
+			t.Errorf("maskPhone(%q) = %q, ожидалось %q", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestMaskPhones(t *testing.T) {
+	got := maskPhones("гость +7 (999) 123-45-67, заказ 12345")
+	if want := "гость 7999*****67, заказ 12345"; got != want {
+		t.Errorf("maskPhones = %q, ожидалось %q", got, want)
+	}
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -16,58 +26,256 @@ type Booking struct {
 	ID       int       `json:"id"`
 	Name     string    `json:"name"`
 	Phone    string    `json:"phone"`
-	Date     string    `json:"date"`
+	Email    string    `json:"email"`
+	Date     string    `json:"date"` // Дата и время визита по часовому поясу ресторана
 	Time     string    `json:"time"`
 	Guests   string    `json:"guests"`
 	Comments string    `json:"comments"`
 	Status   string    `json:"status"`
+	Duration int       `json:"duration"`
+	Tables   []int     `json:"tables"`
 	Created  time.Time `json:"created"`
+
+	// Ресторан бронирования и его название
+	RestaurantID int    `json:"restaurant_id"`
+	Restaurant   string `json:"restaurant"`
+
+	// Начало визита и расчетное окончание (начало + Duration)
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+
+	// Токен ссылки управления; известен только сразу после создания
+	ManageToken string `json:"-"`
+
+	// Номер версии (растет при каждом изменении) и время последнего изменения — для календарей
+	Revision int       `json:"-"`
+	Updated  time.Time `json:"-"`
+
+	// Время переходов между статусами
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	SeatedAt    *time.Time `json:"seated_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	NoShowAt    *time.Time `json:"no_show_at,omitempty"`
+	ExpiredAt   *time.Time `json:"expired_at,omitempty"`
 }
 
-var db *Database
+var (
+	db     Store
+	config *Config
+)
 
 func main() {
-	config := GetConfig()
+	// Конфигурация: умолчания → файл → окружение → флаги; после флагов идет подкоманда
+	cfg, args, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// Журнал еще не настроен, а список ошибок многострочный — выводим как есть
+		fmt.Fprintf(os.Stderr, "Ошибка конфигурации: %v\n", err)
+		os.Exit(1)
+	}
+	config = cfg
+	setupLogging(config)
 
-	// Инициализация базы данных
-	var err error
-	db, err = NewDatabase(config)
+	// Подкоманда просмотра конфигурации: dinebook-go [флаги] config print
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfigCommand(config, args[1:]); err != nil {
+			fatal("Ошибка", "error", err)
+		}
+		return
+	}
+
+	// Инициализация хранилища
+	db, err = NewStore(config)
 	if err != nil {
-		log.Fatalf("Ошибка инициализации базы данных: %v", err)
+		fatal("Ошибка инициализации базы данных", "error", err)
 	}
 	defer db.Close()
 
+	// Миграции нужны только SQL-базам; хранилище в памяти создается пустым
+	sqlDB, isSQL := db.(*Database)
+
+	// Подкоманда управления миграциями: dinebook-go migrate up|down [N]|status
+	if len(args) > 0 && args[0] == "migrate" {
+		if !isSQL {
+			fatal("Хранилище не использует миграции", "driver", config.DBDriver)
+		}
+		if err := runMigrateCommand(sqlDB, args[1:]); err != nil {
+			fatal("Ошибка миграции", "error", err)
+		}
+		return
+	}
+
+	// Применение миграций схемы при запуске
+	if config.AutoMigrate && isSQL {
+		if _, err := sqlDB.MigrateUp(); err != nil {
+			fatal("Ошибка применения миграций", "error", err)
+		}
+	}
+
 	// Создание администратора по умолчанию
-	if err := db.CreateAdminUser(config.AdminUsername, config.AdminPassword); err != nil {
-		log.Printf("Ошибка создания администратора: %v", err)
+	if err := ensureAdminUser(); err != nil {
+		slog.Error("Ошибка создания администратора", "error", err)
 	}
 
+	// Первый ресторан сети создается с правилами бронирования из конфигурации
+	initial := defaultRestaurantSettings()
+	if err := db.EnsureDefaultRestaurant(&initial); err != nil {
+		fatal("Ошибка создания ресторана", "error", err)
+	}
+	if rest, err := defaultRestaurant(); err != nil {
+		slog.Error("Ошибка получения ресторана по умолчанию", "error", err)
+	} else {
+		// Заполнение часов работы по умолчанию
+		if err := db.EnsureDefaultOpeningHours(rest.ID, config.OpeningTime, config.ClosingTime); err != nil {
+			slog.Error("Ошибка создания часов работы", "error", err)
+		}
+
+		// Заполнение схемы зала по умолчанию
+		if err := db.EnsureDefaultTables(rest.ID, config.DefaultTables); err != nil {
+			slog.Error("Ошибка создания столиков", "error", err)
+		}
+	}
+
+	// Уведомления гостям отправляются в фоне из очереди
+	notifiers, err = newNotifiers(config)
+	if err != nil {
+		fatal("Ошибка настройки уведомлений", "error", err)
+	}
+
+	// SIGINT/SIGTERM отменяют ctx: сервер перестает принимать соединения, фоновые задания
+	// заканчивают текущий проход, после чего закрывается хранилище
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		runNotificationOutbox(ctx)
+	}()
+
+	// Напоминания, истечение неподтвержденных бронирований и просьбы об отзыве
+	go func() {
+		defer background.Done()
+		runScheduler(ctx)
+	}()
+
+	registerMetrics(db)
 	router := mux.NewRouter()
+	router.Use(metricsMiddleware, accessLogMiddleware, openAPIValidationMiddleware)
+	router.NotFoundHandler = http.HandlerFunc(handleAPINotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(handleAPIMethodNotAllowed)
 
 	// Статические файлы
 	fs := http.FileServer(http.Dir("static"))
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", fs))
 
+	// Проверки для оркестратора контейнеров
+	router.HandleFunc("/healthz", handleHealthz).Methods("GET", "HEAD")
+	router.HandleFunc("/readyz", handleReadyz).Methods("GET", "HEAD")
+	router.Handle("/metrics", handleMetrics()).Methods("GET")
+
 	// Публичные маршруты
-	router.HandleFunc("/", handleHome).Methods("GET")
-	router.HandleFunc("/api/book", handleCreateBooking).Methods("POST")
-	router.HandleFunc("/api/bookings", handleGetBookingsByPhone).Methods("GET")
+	router.HandleFunc("/", handleRestaurants).Methods("GET")
+	router.HandleFunc("/api/book", withDefaultRestaurant(handleCreateBooking)).Methods("POST")
+	router.HandleFunc("/api/availability", withDefaultRestaurant(handleAvailability)).Methods("GET")
+	router.HandleFunc("/api/manage/{token}", handleGetManagedBooking).Methods("GET")
+	router.HandleFunc("/api/manage/{token}", handleUpdateManagedBooking).Methods("PUT")
+	router.HandleFunc("/api/manage/{token}/calendar.ics", handleManagedBookingCalendar).Methods("GET")
+	router.HandleFunc("/manage/{token}", handleManagePage).Methods("GET")
+	router.HandleFunc("/calendar/{token}.ics", handleCalendarFeed).Methods("GET")
 	router.HandleFunc("/api/bookings/{id}/status", handleUpdateBookingStatus).Methods("PUT")
+	router.HandleFunc("/api/waitlist", withDefaultRestaurant(handleJoinWaitlist)).Methods("POST")
+	router.HandleFunc("/api/waitlist/claim/{token}", handleClaimWaitlist).Methods("POST")
+	router.HandleFunc("/waitlist/claim/{token}", handleWaitlistClaimPage).Methods("GET")
+
+	// Страница и API бронирования отдельного ресторана
+	restaurantRouter := router.PathPrefix("/r/{slug}").Subrouter()
+	restaurantRouter.Use(restaurantBySlugMiddleware)
+	restaurantRouter.HandleFunc("", handleHome).Methods("GET")
+	restaurantRouter.HandleFunc("/", handleHome).Methods("GET")
+	restaurantRouter.HandleFunc("/api/book", handleCreateBooking).Methods("POST")
+	restaurantRouter.HandleFunc("/api/availability", handleAvailability).Methods("GET")
+	restaurantRouter.HandleFunc("/api/waitlist", handleJoinWaitlist).Methods("POST")
+
+	// Описание API в формате OpenAPI 3 и страница для его просмотра
+	router.HandleFunc("/api/openapi.json", handleOpenAPI).Methods("GET")
+	router.HandleFunc("/api/docs", handleAPIDocs).Methods("GET")
+
+	// API v1: стабильные JSON-ответы и коды ошибок
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/restaurants", handleAPIRestaurants).Methods("GET")
+	api.HandleFunc("/session", handleAPILogin).Methods("POST")
+	restaurantAPI := api.PathPrefix("/restaurants/{slug}").Subrouter()
+	restaurantAPI.Use(restaurantBySlugMiddleware)
+	restaurantAPI.HandleFunc("/availability", handleAvailability).Methods("GET")
+	restaurantAPI.HandleFunc("/bookings", handleAPICreateBooking).Methods("POST")
+
+	// API v1 для сотрудников: сессия из cookie или Authorization: Bearer, ресторан — ?restaurant=ID
+	staffAPI := api.PathPrefix("").Subrouter()
+	staffAPI.Use(authMiddleware, adminRestaurantMiddleware)
+	staffAPI.HandleFunc("/session", handleAPILogout).Methods("DELETE")
+	staffAPI.HandleFunc("/bookings", requirePermission(PermViewBookings, handleAPIBookings)).Methods("GET")
+	staffAPI.HandleFunc("/bookings/{id}", requirePermission(PermViewBookings, handleAPIBooking)).Methods("GET")
+	staffAPI.HandleFunc("/bookings/{id}/status", requirePermission(PermUpdateBookings, handleUpdateBookingStatus)).Methods("PUT")
+	staffAPI.HandleFunc("/tables", requirePermission(PermViewSettings, handleAPITables)).Methods("GET")
+	staffAPI.HandleFunc("/tables", requirePermission(PermManageSettings, handleCreateTable)).Methods("POST")
+	staffAPI.HandleFunc("/tables/{id}", requirePermission(PermManageSettings, handleUpdateTable)).Methods("PUT")
+	staffAPI.HandleFunc("/tables/{id}", requirePermission(PermManageSettings, handleDeleteTable)).Methods("DELETE")
+	staffAPI.HandleFunc("/users", requirePermission(PermManageUsers, handleAPIUsers)).Methods("GET")
+	staffAPI.HandleFunc("/users", requirePermission(PermManageUsers, handleCreateUser)).Methods("POST")
+	staffAPI.HandleFunc("/users/{id}", requirePermission(PermManageUsers, handleUpdateUser)).Methods("PUT")
 
 	// Административные маршруты
 	adminRouter := router.PathPrefix("/admin").Subrouter()
 	adminRouter.HandleFunc("/login", handleAdminLogin).Methods("GET", "POST")
+	adminRouter.HandleFunc("/logout", handleAdminLogout).Methods("POST")
 
 	// Защищенные админ-маршруты
 	protectedAdmin := adminRouter.PathPrefix("").Subrouter()
-	protectedAdmin.Use(authMiddleware)
-	protectedAdmin.HandleFunc("", handleAdminHome).Methods("GET")
-	protectedAdmin.HandleFunc("/", handleAdminHome).Methods("GET")
-	protectedAdmin.HandleFunc("/bookings", handleAdminBookings).Methods("GET")
-	protectedAdmin.HandleFunc("/bookings/{id}/status", handleUpdateBookingStatus).Methods("PUT")
-
-	log.Println("Сервер запущен на http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	protectedAdmin.Use(authMiddleware, adminRestaurantMiddleware)
+	protectedAdmin.HandleFunc("", requirePermission(PermViewBookings, handleAdminBookings)).Methods("GET")
+	protectedAdmin.HandleFunc("/", requirePermission(PermViewBookings, handleAdminBookings)).Methods("GET")
+	protectedAdmin.HandleFunc("/bookings", requirePermission(PermViewBookings, handleAdminBookings)).Methods("GET")
+	protectedAdmin.HandleFunc("/bookings/export.csv", requirePermission(PermViewBookings, handleExportBookings)).Methods("GET")
+	protectedAdmin.HandleFunc("/bookings/export.xlsx", requirePermission(PermViewBookings, handleExportBookings)).Methods("GET")
+	protectedAdmin.HandleFunc("/bookings/import", requirePermission(PermImportBookings, handleImportBookings)).Methods("POST")
+	protectedAdmin.HandleFunc("/calendar", requirePermission(PermViewBookings, handleCreateCalendarLink)).Methods("POST")
+	protectedAdmin.HandleFunc("/calendar", requirePermission(PermViewBookings, handleDeleteCalendarLink)).Methods("DELETE")
+	protectedAdmin.HandleFunc("/bookings/{id}/history", requirePermission(PermViewBookings, handleBookingHistory)).Methods("GET")
+	protectedAdmin.HandleFunc("/bookings/{id}/status", requirePermission(PermUpdateBookings, handleUpdateBookingStatus)).Methods("PUT")
+	protectedAdmin.HandleFunc("/waitlist", requirePermission(PermViewBookings, handleAdminWaitlist)).Methods("GET")
+	protectedAdmin.HandleFunc("/waitlist/{id}", requirePermission(PermUpdateBookings, handleCancelWaitlistEntry)).Methods("DELETE")
+	protectedAdmin.HandleFunc("/tables", requirePermission(PermViewSettings, handleAdminTables)).Methods("GET")
+	protectedAdmin.HandleFunc("/tables", requirePermission(PermManageSettings, handleCreateTable)).Methods("POST")
+	protectedAdmin.HandleFunc("/tables/{id}", requirePermission(PermManageSettings, handleUpdateTable)).Methods("PUT")
+	protectedAdmin.HandleFunc("/tables/{id}", requirePermission(PermManageSettings, handleDeleteTable)).Methods("DELETE")
+	protectedAdmin.HandleFunc("/hours", requirePermission(PermViewSettings, handleAdminHours)).Methods("GET")
+	protectedAdmin.HandleFunc("/hours/{kind}", requirePermission(PermManageSettings, handleCreateScheduleItem)).Methods("POST")
+	protectedAdmin.HandleFunc("/hours/{kind}/{id}", requirePermission(PermManageSettings, handleDeleteScheduleItem)).Methods("DELETE")
+	protectedAdmin.HandleFunc("/restaurants", requirePermission(PermViewSettings, handleAdminRestaurants)).Methods("GET")
+	protectedAdmin.HandleFunc("/restaurants", requirePermission(PermManageRestaurants, handleCreateRestaurant)).Methods("POST")
+	protectedAdmin.HandleFunc("/restaurants/{id}", requirePermission(PermManageSettings, handleUpdateRestaurant)).Methods("PUT")
+	protectedAdmin.HandleFunc("/jobs", requirePermission(PermViewSettings, handleAdminJobs)).Methods("GET")
+	protectedAdmin.HandleFunc("/users", requirePermission(PermManageUsers, handleAdminUsers)).Methods("GET")
+	protectedAdmin.HandleFunc("/users", requirePermission(PermManageUsers, handleCreateUser)).Methods("POST")
+	protectedAdmin.HandleFunc("/users/{id}", requirePermission(PermManageUsers, handleUpdateUser)).Methods("PUT")
+
+	// Описание API должно совпадать с маршрутами; расхождение — ошибка разработчика, но не повод не запускаться
+	for _, problem := range checkOpenAPIRoutes(router) {
+		slog.Warn("Описание API расходится с маршрутами", "problem", problem)
+	}
+
+	serveErr := serve(ctx, newServer(router))
+	stop()
+	waitBackground(&background, config.ShutdownTimeout)
+	if serveErr != nil {
+		db.Close()
+		fatal("Ошибка сервера", "error", serveErr)
+	}
+	slog.Info("Сервер остановлен")
 }
 
 func handleHome(w http.ResponseWriter, r *http.Request) {
@@ -77,120 +285,145 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := tmpl.Execute(w, nil); err != nil {
+	// Сегодняшняя дата по часовому поясу ресторана, а не браузера гостя
+	data := struct {
+		Restaurant *Restaurant
+		Today      string
+	}{currentRestaurant(r), restaurantToday().Format("2006-01-02")}
+	if err := tmpl.Execute(w, data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
 func handleCreateBooking(w http.ResponseWriter, r *http.Request) {
-	var bookingData struct {
-		Name     string `json:"name"`
-		Phone    string `json:"phone"`
-		Date     string `json:"date"`
-		Time     string `json:"time"`
-		Guests   string `json:"guests"`
-		Comments string `json:"comments"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&bookingData); err != nil {
-		log.Printf("Ошибка при разборе данных: %v", err)
-		http.Error(w, "Ошибка при разборе данных", http.StatusBadRequest)
+	var data BookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		slog.WarnContext(r.Context(), "Ошибка при разборе данных", "error", err)
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
 		return
 	}
 
-	// Валидация данных
-	if bookingData.Name == "" || bookingData.Phone == "" || bookingData.Date == "" || bookingData.Time == "" || bookingData.Guests == "" {
-		log.Printf("Не заполнены обязательные поля: name=%s, phone=%s, date=%s, time=%s, guests=%s",
-			bookingData.Name, bookingData.Phone, bookingData.Date, bookingData.Time, bookingData.Guests)
-		http.Error(w, "Все обязательные поля должны быть заполнены", http.StatusBadRequest)
+	booking, err := createBooking(r, currentRestaurant(r), data, "web")
+	if err != nil {
+		if !writeBookingError(w, r, err) && !writeBookingConflict(w, r, err) {
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при создании бронирования")
+		}
 		return
 	}
 
-	// Форматируем телефон
-	phone := strings.Map(func(r rune) rune {
-		if r >= '0' && r <= '9' {
-			return r
-		}
-		return -1
-	}, bookingData.Phone)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newBookingCreated(booking))
+}
 
-	// Проверяем длину телефона
-	if len(phone) != 11 {
-		log.Printf("Неверный формат телефона: %s", bookingData.Phone)
-		http.Error(w, "Неверный формат телефона (должно быть 11 цифр)", http.StatusBadRequest)
-		return
+// bookingCreated — ответ формы на сайте о новом бронировании со ссылкой управления
+// и ссылкой на событие для календаря
+type bookingCreated struct {
+	Message     string `json:"message"`
+	Tables      []int  `json:"tables"`
+	Token       string `json:"token"`
+	ManageURL   string `json:"manage_url"`
+	CalendarURL string `json:"calendar_url"`
+}
+
+func newBookingCreated(booking *Booking) bookingCreated {
+	return bookingCreated{
+		Message:     "Бронирование успешно создано",
+		Tables:      booking.Tables,
+		Token:       booking.ManageToken,
+		ManageURL:   "/manage/" + booking.ManageToken,
+		CalendarURL: "/api/manage/" + booking.ManageToken + "/calendar.ics",
 	}
+}
 
-	// Проверяем, что телефон начинается с 7 или 8
-	if phone[0] != '7' && phone[0] != '8' {
-		log.Printf("Телефон должен начинаться с 7 или 8: %s", phone)
-		http.Error(w, "Телефон должен начинаться с 7 или 8", http.StatusBadRequest)
-		return
+// BookingRequest — заявка гостя на бронирование: форма на сайте и POST /api/v1/restaurants/{slug}/bookings
+type BookingRequest struct {
+	Name     string `json:"name" schema:"required"`
+	Phone    string `json:"phone" schema:"required"`
+	Email    string `json:"email"`
+	Date     string `json:"date" schema:"required,format=date"`
+	Time     string `json:"time" schema:"required,format=time"`
+	Guests   string `json:"guests" schema:"required,format=integer"`
+	Comments string `json:"comments"`
+}
+
+// createBooking проверяет заявку по правилам ресторана rest и сохраняет бронирование.
+// Ошибки проверки возвращаются как *BookingError, занятость — ErrDuplicateBooking, ErrPhoneNameMismatch
+// и ErrNoTableAvailable.
+// source — откуда пришла заявка, для метрик (web, api).
+func createBooking(r *http.Request, rest *Restaurant, data BookingRequest, source string) (*Booking, error) {
+	booking, err := validateBookingRequest(rest, data)
+	if err == nil {
+		err = db.CreateBooking(booking, requestActor(r))
 	}
 
-	// Если телефон начинается с 8, заменяем на 7
-	if phone[0] == '8' {
-		phone = "7" + phone[1:]
+	var bookingErr *BookingError
+	switch {
+	case err == nil:
+		slog.InfoContext(r.Context(), "Бронирование создано", "booking_id", booking.ID, "restaurant", rest.Slug, "source", source, "tables", booking.Tables)
+		recordBookingCreated(booking, source)
+		return booking, nil
+	case errors.As(err, &bookingErr), errors.Is(err, ErrDuplicateBooking), errors.Is(err, ErrPhoneNameMismatch), errors.Is(err, ErrNoTableAvailable):
+		slog.InfoContext(r.Context(), "Бронирование отклонено", "restaurant", rest.Slug, "date", data.Date, "time", data.Time, "phone", data.Phone, "reason", err)
+		recordBookingRejected(err)
+	default:
+		slog.ErrorContext(r.Context(), "Ошибка при создании бронирования", "error", err)
 	}
+	return nil, err
+}
 
-	// Проверяем формат даты
-	_, err := time.Parse("2006-01-02", bookingData.Date)
-	if err != nil {
-		log.Printf("Ошибка при проверке формата даты %s: %v", bookingData.Date, err)
-		http.Error(w, "Неверный формат даты (должен быть YYYY-MM-DD)", http.StatusBadRequest)
-		return
+// validateBookingRequest проверяет формат полей, время работы и размер компании так же,
+// как при расчете свободных слотов, и собирает бронирование
+func validateBookingRequest(rest *Restaurant, data BookingRequest) (*Booking, error) {
+	if data.Name == "" || data.Phone == "" || data.Date == "" || data.Time == "" || data.Guests == "" {
+		return nil, newBookingError(http.StatusBadRequest, "Все обязательные поля должны быть заполнены").withCause("missing_fields")
 	}
 
-	// Проверяем формат времени
-	timeStr := bookingData.Time
-	if len(timeStr) > 5 {
-		timeStr = timeStr[:5] // Берем только часы и минуты
+	// Форматируем и проверяем телефон и email
+	phone, err := normalizePhone(data.Phone)
+	if err != nil {
+		return nil, err
 	}
-	_, err = time.Parse("15:04", timeStr)
+	email, err := normalizeEmail(data.Email)
 	if err != nil {
-		log.Printf("Ошибка при проверке формата времени %s: %v", bookingData.Time, err)
-		http.Error(w, "Неверный формат времени (должен быть HH:MM)", http.StatusBadRequest)
-		return
+		return nil, err
 	}
 
-	// Создаем объект бронирования
-	booking := Booking{
-		Name:     bookingData.Name,
-		Phone:    phone, // Используем отформатированный телефон
-		Date:     bookingData.Date,
-		Time:     timeStr,
-		Guests:   bookingData.Guests,
-		Comments: bookingData.Comments,
-		Status:   "pending",
+	// Проверяем формат даты, времени и количества гостей
+	if _, err := parseBookingDate(data.Date); err != nil {
+		return nil, err
 	}
-
-	// Проверяем, что дата не в прошлом
-	bookingDate, _ := time.Parse("2006-01-02", booking.Date)
-	if bookingDate.Before(time.Now().Truncate(24 * time.Hour)) {
-		log.Printf("Попытка бронирования на прошедшую дату: %s", booking.Date)
-		http.Error(w, "Дата бронирования не может быть в прошлом", http.StatusBadRequest)
-		return
+	timeStr, err := parseBookingTime(data.Time)
+	if err != nil {
+		return nil, err
 	}
-
-	// Сохранение бронирования
-	err = db.CreateBooking(&booking)
+	guests, err := parseGuests(data.Guests)
 	if err != nil {
-		log.Printf("Ошибка при создании бронирования: %v", err)
-		if err.Error() == "на эту дату уже существует активное бронирование для данного номера телефона" {
-			http.Error(w, err.Error(), http.StatusConflict)
-		} else {
-			http.Error(w, fmt.Sprintf("Ошибка при создании бронирования: %v", err), http.StatusInternalServerError)
-		}
-		return
+		return nil, err
 	}
 
-	log.Printf("Бронирование успешно создано: ID=%d", booking.ID)
+	schedule, err := db.GetDaySchedule(rest.ID, data.Date)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении расписания на %s: %v", data.Date, err)
+	}
+	if err := validateBookingSlot(rest, data.Date, timeStr, guests, schedule); err != nil {
+		return nil, err
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Бронирование успешно создано",
-	})
+	return &Booking{
+		Name:     data.Name,
+		Phone:    phone, // Используем отформатированный телефон
+		Email:    email,
+		Date:     data.Date,
+		Time:     timeStr,
+		Guests:   strconv.Itoa(guests),
+		Comments: data.Comments,
+		Status:   StatusPending,
+		Duration: rest.DiningMinutes,
+
+		RestaurantID: rest.ID,
+		Restaurant:   rest.Name,
+	}, nil
 }
 
 func authMiddleware(next http.Handler) http.Handler {
@@ -201,24 +434,38 @@ func authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Проверяем сессию
-		session, err := r.Cookie("session")
-		if err != nil || session.Value == "" {
+		// Проверяем сессию: cookie админ-панели или токен API
+		var user *User
+		if token := sessionToken(r); token != "" {
+			var err error
+			user, err = db.GetSessionUser(token)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Ошибка при проверке сессии", "error", err)
+				writeInternalError(w, r)
+				return
+			}
+		}
+
+		if user == nil {
+			clearSessionCookie(w)
+			// Запросы из скриптов и API получают 401, страницы — перенаправление на вход
+			if r.Method != http.MethodGet || wantsJSON(r) {
+				writeError(w, r, http.StatusUnauthorized, "unauthorized", "Требуется авторизация")
+				return
+			}
 			http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withUser(r, user))
 	})
 }
 
 func handleAdminLogin(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Обработка запроса к /admin/login: метод=%s", r.Method)
-
 	if r.Method == "GET" {
 		tmpl, err := template.ParseFiles("templates/admin/login.html")
 		if err != nil {
-			log.Printf("Ошибка при загрузке шаблона login.html: %v", err)
+			slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона", "template", "login.html", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -226,7 +473,7 @@ func handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 			Error string
 		}{}
 		if err := tmpl.Execute(w, data); err != nil {
-			log.Printf("Ошибка при рендеринге шаблона login.html: %v", err)
+			slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона", "template", "login.html", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -235,37 +482,112 @@ func handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 
 	username := r.FormValue("username")
 	password := r.FormValue("password")
-	log.Printf("Попытка входа: username=%s", username)
 
-	valid, err := db.ValidateAdmin(username, password)
+	user, err := db.AuthenticateUser(username, password)
 	if err != nil {
-		log.Printf("Ошибка при валидации админа: %v", err)
+		slog.ErrorContext(r.Context(), "Ошибка при проверке учетных данных", "error", err)
 		http.Error(w, "Ошибка сервера при проверке учетных данных", http.StatusInternalServerError)
 		return
 	}
-	if !valid {
-		log.Printf("Неверные учетные данные для пользователя: %s", username)
+	if user == nil {
+		slog.WarnContext(r.Context(), "Неверные учетные данные", "username", username)
 		tmpl, _ := template.ParseFiles("templates/admin/login.html")
+		w.WriteHeader(http.StatusUnauthorized)
 		tmpl.Execute(w, struct{ Error string }{"Неверные имя пользователя или пароль"})
 		return
 	}
 
+	// При входе всегда выдаем новую сессию, а прежнюю (если была) удаляем
+	if old, err := r.Cookie(sessionCookieName); err == nil && old.Value != "" {
+		if err := db.DeleteSession(old.Value); err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при удалении прежней сессии", "error", err)
+		}
+	}
+	if err := db.DeleteExpiredSessions(); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при удалении истекших сессий", "error", err)
+	}
+
+	token, expiresAt, err := db.CreateSession(user.ID, clientIP(r), r.UserAgent(), config.SessionTTL)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при создании сессии", "error", err)
+		http.Error(w, "Ошибка сервера при входе", http.StatusInternalServerError)
+		return
+	}
+
 	// Устанавливаем куки сессии
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    "admin_session",
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   3600,
-	})
+	setSessionCookie(w, token, expiresAt)
 
-	log.Printf("Успешный вход пользователя: %s", username)
+	slog.InfoContext(r.Context(), "Вход в админку", "user_id", user.ID, "username", user.Username)
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
-// Добавляем общую функцию для создания шаблона с функциями форматирования
-func createTemplateWithFuncs(filename string) (*template.Template, error) {
+func handleAdminLogout(w http.ResponseWriter, r *http.Request) {
+	if session, err := r.Cookie(sessionCookieName); err == nil && session.Value != "" {
+		if err := db.DeleteSession(session.Value); err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при удалении сессии", "error", err)
+			http.Error(w, "Ошибка сервера при выходе", http.StatusInternalServerError)
+			return
+		}
+	}
+	clearSessionCookie(w)
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Выход выполнен",
+		})
+		return
+	}
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+// Добавляем общую функцию для создания шаблона с функциями форматирования.
+// Вместе с шаблоном подключается общее меню админки, которому нужен текущий пользователь.
+func createTemplateWithFuncs(r *http.Request, filename string) (*template.Template, error) {
+	user := currentUser(r)
+	restaurant := currentRestaurant(r)
 	funcMap := template.FuncMap{
+		"currentUser": func() *User {
+			return user
+		},
+		"currentRestaurant": func() *Restaurant {
+			return restaurant
+		},
+		// Рестораны для переключателя в меню
+		"userRestaurants": func() ([]Restaurant, error) {
+			return accessibleRestaurants(user)
+		},
+		"can": func(p string) bool {
+			return user.Can(Permission(p))
+		},
+		"statusView": func(status string) *statusView {
+			if view, ok := statusViews[status]; ok {
+				return &view
+			}
+			return nil
+		},
+		"nextStatuses":  nextStatuses,
+		"canTransition": canTransition,
+		"canModify":     canModify,
+		"statusTitle":   statusTitle,
+		"eventTitle": func(eventType string) string {
+			if title, ok := eventTitles[eventType]; ok {
+				return title
+			}
+			return eventType
+		},
+		"waitlistStatus": func(status string) string {
+			if title, ok := waitlistStatusTitles[status]; ok {
+				return title
+			}
+			return status
+		},
+		"fieldTitle": func(field string) string {
+			if title, ok := fieldTitles[field]; ok {
+				return title
+			}
+			return field
+		},
 		"formatPhone": func(phone string) string {
 			// Убираем все нецифровые символы
 			digits := strings.Map(func(r rune) rune {
@@ -303,158 +625,202 @@ func createTemplateWithFuncs(filename string) (*template.Template, error) {
 		},
 	}
 
-	return template.New("home.html").Funcs(funcMap).ParseFiles(filename)
+	return template.New(filepath.Base(filename)).Funcs(funcMap).ParseFiles(filename, "templates/admin/nav.html")
 }
 
-func handleAdminHome(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Обработка запроса к /admin: метод=%s", r.Method)
+// bookingOption — пункт списка в форме фильтров бронирований
+type bookingOption struct {
+	Value    string
+	Title    string
+	Selected bool
+}
 
-	tmpl, err := createTemplateWithFuncs("templates/admin/home.html")
-	if err != nil {
-		log.Printf("Ошибка при загрузке шаблона home.html: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// bookingListView — страница списка бронирований: строки, значения фильтров, ссылки на следующую страницу
+// и на выгрузку с теми же фильтрами
+type bookingListView struct {
+	Bookings   []Booking
+	Filter     url.Values
+	Statuses   []bookingOption
+	Sorts      []bookingOption
+	NextURL    string
+	ExportCSV  string
+	ExportXLSX string
+	Error      string
+}
 
-	bookings, err := db.GetBookings()
-	if err != nil {
-		log.Printf("Ошибка при получении бронирований: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// Статусы в порядке жизненного цикла для формы фильтров
+var bookingStatusOrder = []string{StatusPending, StatusConfirmed, StatusSeated, StatusCompleted, StatusCancelled, StatusNoShow, StatusExpired}
+
+func newBookingListView(r *http.Request, q BookingQuery, page *BookingPage) bookingListView {
+	view := bookingListView{Filter: r.URL.Query()}
+	if page != nil {
+		view.Bookings = page.Bookings
+		if page.NextCursor != "" {
+			next := r.URL.Query()
+			next.Set("cursor", page.NextCursor)
+			view.NextURL = "/admin/bookings?" + next.Encode()
+		}
 	}
-
-	if err := tmpl.Execute(w, bookings); err != nil {
-		log.Printf("Ошибка при рендеринге шаблона home.html: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	export := r.URL.Query()
+	export.Del("cursor")
+	export.Del("limit")
+	view.ExportCSV = "/admin/bookings/export.csv?" + export.Encode()
+	view.ExportXLSX = "/admin/bookings/export.xlsx?" + export.Encode()
+	for _, status := range bookingStatusOrder {
+		view.Statuses = append(view.Statuses, bookingOption{status, statusTitle(status), containsStatus(q.Statuses, status)})
+	}
+	for _, f := range bookingSortFields {
+		view.Sorts = append(view.Sorts,
+			bookingOption{"-" + f.Field, f.Title + " ↓", q.Sort == "-"+f.Field},
+			bookingOption{f.Field, f.Title + " ↑", q.Sort == f.Field})
 	}
+	return view
 }
 
+// handleAdminBookings — список бронирований с фильтрами и постраничным выводом (параметры — в parseBookingQuery).
+// JSON-клиенты получают массив, а ссылку на следующую страницу — в заголовке Link.
 func handleAdminBookings(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "GET" {
-		// Получаем параметры фильтрации
-		filters := make(map[string]string)
-		if date := r.URL.Query().Get("date"); date != "" {
-			filters["date"] = date
-		}
-		if status := r.URL.Query().Get("status"); status != "" {
-			filters["status"] = status
-		}
-		if phone := r.URL.Query().Get("phone"); phone != "" {
-			filters["phone"] = phone
-		}
-		if name := r.URL.Query().Get("name"); name != "" {
-			filters["name"] = name
-		}
+	q, err := parseBookingQuery(r.URL.Query())
+	if err != nil && wantsJSON(r) {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
 
-		// Получаем отфильтрованные бронирования
-		bookings, err := db.GetFilteredBookings(filters)
+	var page *BookingPage
+	if err == nil {
+		page, err = db.SearchBookings(currentRestaurant(r).ID, q)
 		if err != nil {
-			log.Printf("Ошибка при получении бронирований: %v", err)
-			http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Ошибка при получении бронирований", "error", err)
+			writeInternalError(w, r)
 			return
 		}
+	}
+	view := newBookingListView(r, q, page)
+	if err != nil {
+		view.Error = err.Error()
+	}
 
-		// Логируем данные для отладки
-		for _, booking := range bookings {
-			log.Printf("Booking ID %d: Date='%s', Time='%s'",
-				booking.ID, booking.Date, booking.Time)
-		}
-
-		// Если это AJAX-запрос, возвращаем JSON
-		if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(bookings)
-			return
-		}
-
-		// Парсим шаблон с функциями
-		tmpl, err := createTemplateWithFuncs("templates/admin/home.html")
-		if err != nil {
-			log.Printf("Ошибка при парсинге шаблона: %v", err)
-			http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
-			return
+	if wantsJSON(r) {
+		if view.NextURL != "" {
+			w.Header().Set("Link", "<"+view.NextURL+`>; rel="next"`)
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page.Bookings)
+		return
+	}
 
-		// Передаем только список бронирований в шаблон
-		if err := tmpl.Execute(w, bookings); err != nil {
-			log.Printf("Ошибка при рендеринге шаблона: %v", err)
-			http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
-		}
+	tmpl, err := createTemplateWithFuncs(r, "templates/admin/home.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона", "template", "home.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, view); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона", "template", "home.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
 	}
 }
 
+// bookingStatusRequest — смена статуса бронирования; гость подтверждает право токеном ссылки управления
+type bookingStatusRequest struct {
+	Status string `json:"status" schema:"required,enum=status"`
+	Token  string `json:"token"`
+}
+
 func handleUpdateBookingStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
-	log.Printf("Обновление статуса бронирования: id=%s, путь=%s", idStr, r.URL.Path)
 
 	var id int
 	if _, err := fmt.Sscanf(idStr, "%d", &id); err != nil {
-		log.Printf("Неверный формат ID: %s", idStr)
-		http.Error(w, "Неверный формат ID", http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "Неверный формат ID", "id", idStr)
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Неверный формат ID")
 		return
 	}
 
-	var data struct {
-		Status string `json:"status"`
-	}
+	var data bookingStatusRequest
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		log.Printf("Ошибка при разборе JSON: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		slog.WarnContext(r.Context(), "Ошибка при разборе JSON", "error", err)
+		writeError(w, r, http.StatusBadRequest, "invalid_json", err.Error())
 		return
 	}
 
-	// Проверяем, существует ли бронирование
-	_, err := db.GetBookingByID(id)
-	if err != nil {
-		log.Printf("Ошибка при получении бронирования %d: %v", id, err)
-		http.Error(w, "Бронирование не найдено", http.StatusNotFound)
+	if !validStatus(data.Status) {
+		slog.WarnContext(r.Context(), "Неизвестный статус бронирования", "status", data.Status)
+		writeError(w, r, http.StatusBadRequest, "invalid_status", "Неизвестный статус бронирования")
 		return
 	}
 
-	log.Printf("Обновление статуса бронирования %d на %s", id, data.Status)
-
-	// Если статус "cancelled", помечаем бронирование как отмененное
-	if data.Status == "cancelled" {
-		if err := db.UpdateBookingStatus(id, "cancelled"); err != nil {
-			log.Printf("Ошибка при отмене бронирования: %v", err)
-			http.Error(w, "Ошибка при отмене бронирования", http.StatusInternalServerError)
+	// Без входа в админку статус меняют только по ссылке управления и только на разрешенный гостю
+	if currentUser(r) == nil {
+		if !guestCanSetStatus(data.Status) {
+			writeError(w, r, http.StatusForbidden, "forbidden", "Недостаточно прав для выполнения действия")
 			return
 		}
-	} else {
-		// Для других статусов просто обновляем статус
-		if err := db.UpdateBookingStatus(id, data.Status); err != nil {
-			log.Printf("Ошибка при обновлении статуса бронирования: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		ok, err := db.CheckBookingToken(id, data.Token)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при проверке ссылки управления бронированием", "booking_id", id, "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		if !ok {
+			slog.WarnContext(r.Context(), "Отказ в смене статуса бронирования: неверный токен", "booking_id", id)
+			writeError(w, r, http.StatusForbidden, "invalid_token", "Неверная ссылка управления бронированием")
 			return
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Статус бронирования успешно обновлен",
-	})
-}
+	// Проверяем, существует ли бронирование; сотрудник меняет только бронирования выбранного ресторана
+	booking, err := db.GetBookingByID(id)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Ошибка при получении бронирования", "booking_id", id, "error", err)
+		writeError(w, r, http.StatusNotFound, "not_found", "Бронирование не найдено")
+		return
+	}
+	if currentUser(r) != nil && booking.RestaurantID != currentRestaurant(r).ID {
+		writeError(w, r, http.StatusNotFound, "not_found", "Бронирование не найдено")
+		return
+	}
 
-func handleGetBookingsByPhone(w http.ResponseWriter, r *http.Request) {
-	phone := r.URL.Query().Get("phone")
-	if phone == "" {
-		http.Error(w, "Не указан номер телефона", http.StatusBadRequest)
+	if !canTransition(booking.Status, data.Status) {
+		slog.InfoContext(r.Context(), "Смена статуса бронирования отклонена", "booking_id", id, "from", booking.Status, "to", data.Status)
+		writeBookingError(w, r, transitionError(booking.Status, data.Status))
 		return
 	}
 
-	log.Printf("Поиск бронирований для телефона: %s", phone)
+	// Подтвердить бронирование можно только на время, когда ресторан работает
+	if data.Status == StatusConfirmed {
+		schedule, err := db.GetDaySchedule(booking.RestaurantID, booking.Date)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при получении расписания", "date", booking.Date, "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		if err := schedule.checkSlot(booking.Time, time.Duration(booking.Duration)*time.Minute); err != nil {
+			slog.InfoContext(r.Context(), "Смена статуса бронирования отклонена", "booking_id", id, "reason", err)
+			writeBookingError(w, r, err)
+			return
+		}
+	}
 
-	bookings, err := db.GetBookingsByPhone(phone)
-	if err != nil {
-		log.Printf("Ошибка при поиске бронирований: %v", err)
-		http.Error(w, fmt.Sprintf("Ошибка при поиске бронирований: %v", err), http.StatusInternalServerError)
+	if err := db.UpdateBookingStatus(id, booking.Status, data.Status, requestActor(r)); err != nil {
+		if !writeBookingConflict(w, r, err) {
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при обновлении статуса бронирования")
+		}
 		return
 	}
+	slog.InfoContext(r.Context(), "Статус бронирования изменен", "booking_id", id, "from", booking.Status, "to", data.Status)
+	recordBookingStatus(data.Status)
 
-	log.Printf("Найдено бронирований: %d", len(bookings))
-
+	// API v1 возвращает бронирование с новым статусом
+	if isAPIRequest(r) {
+		if updated, err := db.GetBookingByID(id); err == nil {
+			writeJSON(w, http.StatusOK, newAPIBooking(updated))
+			return
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(bookings)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Статус бронирования успешно обновлен",
+	})
 }
@@ -0,0 +1,1511 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore хранит все данные в памяти процесса. Подходит для демонстраций и локального запуска
+// без базы данных: данные пропадают при перезапуске. Правила те же, что и у Database:
+// один телефон — одно активное бронирование на дату, столики назначаются под общей блокировкой.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	lastID       int
+	restaurants  map[int]*Restaurant
+	bookings     map[int]*memoryBooking
+	events       []BookingEvent
+	users        map[int]*memoryUser
+	sessions     map[string]memorySession
+	tables       map[int]*Table
+	openingHours map[int]*OpeningPeriod
+	overrides    map[int]*ScheduleOverride
+	holidays     map[int]*Holiday
+	blackouts    map[int]*Blackout
+	outbox       map[int]*memoryNotification
+	notices      map[memoryNotice]bool
+	jobRuns      []JobRun
+	waitlist     map[int]*memoryWaitlistEntry
+}
+
+type memoryBooking struct {
+	Booking
+	tableIDs  []int
+	tokenHash string
+}
+
+type memoryUser struct {
+	User
+	passwordHash      string
+	calendarTokenHash string
+}
+
+type memoryNotification struct {
+	Notification
+	status      string
+	lastError   string
+	sendAfter   time.Time
+	lockedUntil time.Time
+	sentAt      time.Time
+}
+
+type memoryNotice struct {
+	bookingID int
+	notice    string
+}
+
+type memoryWaitlistEntry struct {
+	WaitlistEntry
+	tokenHash string
+}
+
+type memorySession struct {
+	userID    int
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		restaurants:  make(map[int]*Restaurant),
+		bookings:     make(map[int]*memoryBooking),
+		users:        make(map[int]*memoryUser),
+		sessions:     make(map[string]memorySession),
+		tables:       make(map[int]*Table),
+		openingHours: make(map[int]*OpeningPeriod),
+		overrides:    make(map[int]*ScheduleOverride),
+		holidays:     make(map[int]*Holiday),
+		blackouts:    make(map[int]*Blackout),
+		outbox:       make(map[int]*memoryNotification),
+		notices:      make(map[memoryNotice]bool),
+		waitlist:     make(map[int]*memoryWaitlistEntry),
+	}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// Ready всегда успешна: хранилищу в памяти не нужны соединение и миграции
+func (m *MemoryStore) Ready(ctx context.Context) error {
+	return nil
+}
+
+// nextID выдает идентификаторы из общей последовательности для всех сущностей
+func (m *MemoryStore) nextID() int {
+	m.lastID++
+	return m.lastID
+}
+
+// restaurantName возвращает название ресторана; пустую строку, если ресторана нет
+func (m *MemoryStore) restaurantName(id int) string {
+	if rest, ok := m.restaurants[id]; ok {
+		return rest.Name
+	}
+	return ""
+}
+
+func (m *MemoryStore) GetRestaurants() ([]Restaurant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var restaurants []Restaurant
+	for _, rest := range m.restaurants {
+		restaurants = append(restaurants, *rest)
+	}
+	sort.Slice(restaurants, func(i, j int) bool { return restaurants[i].ID < restaurants[j].ID })
+	return restaurants, nil
+}
+
+func (m *MemoryStore) GetRestaurantByID(id int) (*Restaurant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.restaurants[id]
+	if !ok {
+		return nil, errRestaurantNotFound
+	}
+	rest := *stored
+	return &rest, nil
+}
+
+func (m *MemoryStore) GetRestaurantBySlug(slug string) (*Restaurant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.restaurants {
+		if stored.Slug == slug {
+			rest := *stored
+			return &rest, nil
+		}
+	}
+	return nil, errRestaurantNotFound
+}
+
+// restaurantSlugTaken проверяет, занят ли адрес другим рестораном
+func (m *MemoryStore) restaurantSlugTaken(slug string, excludeID int) bool {
+	for _, rest := range m.restaurants {
+		if rest.Slug == slug && rest.ID != excludeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) CreateRestaurant(rest *Restaurant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createRestaurant(rest)
+}
+
+func (m *MemoryStore) createRestaurant(rest *Restaurant) error {
+	if m.restaurantSlugTaken(rest.Slug, 0) {
+		return errUniqueViolation
+	}
+	rest.ID = m.nextID()
+	rest.Created = time.Now().In(config.Location)
+	stored := *rest
+	m.restaurants[rest.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) UpdateRestaurant(rest *Restaurant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.restaurants[rest.ID]
+	if !ok {
+		return errRestaurantNotFound
+	}
+	if m.restaurantSlugTaken(rest.Slug, rest.ID) {
+		return errUniqueViolation
+	}
+	rest.Created = stored.Created
+	updated := *rest
+	m.restaurants[rest.ID] = &updated
+	return nil
+}
+
+func (m *MemoryStore) EnsureDefaultRestaurant(rest *Restaurant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.restaurants) > 0 {
+		return nil
+	}
+	return m.createRestaurant(rest)
+}
+
+// booking возвращает копию бронирования с номерами назначенных столиков и названием ресторана
+func (m *MemoryStore) booking(mb *memoryBooking) Booking {
+	b := mb.Booking
+	b.Restaurant = m.restaurantName(b.RestaurantID)
+	b.Tables = nil
+	for _, id := range mb.tableIDs {
+		if t, ok := m.tables[id]; ok {
+			b.Tables = append(b.Tables, t.Number)
+		}
+	}
+	sort.Ints(b.Tables)
+	return b
+}
+
+// sortedBookings возвращает копии бронирований, прошедших фильтр, от поздних к ранним
+func (m *MemoryStore) sortedBookings(keep func(b *Booking) bool) []Booking {
+	var bookings []Booking
+	for _, mb := range m.bookings {
+		if keep(&mb.Booking) {
+			bookings = append(bookings, m.booking(mb))
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool {
+		if !bookings[i].StartsAt.Equal(bookings[j].StartsAt) {
+			return bookings[i].StartsAt.After(bookings[j].StartsAt)
+		}
+		return bookings[i].ID < bookings[j].ID
+	})
+	return bookings
+}
+
+// hasActiveBooking проверяет, есть ли у телефона другое активное бронирование на дату в ресторане
+func (m *MemoryStore) hasActiveBooking(restaurantID int, phone, date string, excludeID int) bool {
+	for _, mb := range m.bookings {
+		if mb.ID != excludeID && mb.RestaurantID == restaurantID && mb.Phone == phone && mb.Date == date && containsStatus(activeStatuses, mb.Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// phoneNameUnique — номер телефона закрепляется за именем из первого бронирования
+func (m *MemoryStore) phoneNameUnique(phone, name string) bool {
+	firstID := 0
+	for _, mb := range m.bookings {
+		if mb.Phone == phone && (firstID == 0 || mb.ID < firstID) {
+			firstID = mb.ID
+		}
+	}
+	return firstID == 0 || m.bookings[firstID].Name == name
+}
+
+func (m *MemoryStore) tableList(restaurantID int) []Table {
+	tables := []Table{}
+	for _, t := range m.tables {
+		if t.RestaurantID == restaurantID {
+			tables = append(tables, *t)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Number < tables[j].Number })
+	return tables
+}
+
+// occupancies возвращает занятость столиков ресторана бронированиями и действующими предложениями
+// из листа ожидания, кроме бронирования excludeID и предложения заявки claimID; вызывается под m.mu
+func (m *MemoryStore) occupancies(restaurantID int, from, to time.Time, excludeID, claimID int) []tableOccupancy {
+	var duration time.Duration
+	if rest, ok := m.restaurants[restaurantID]; ok {
+		duration = rest.DiningDuration()
+	}
+	now := time.Now()
+	offers := m.sortedWaitlist(func(e *WaitlistEntry) bool {
+		return e.ID != claimID && e.RestaurantID == restaurantID && e.offerActive(now) &&
+			overlaps(from, to, *e.OfferedStart, e.OfferedStart.Add(duration))
+	})
+	sort.SliceStable(offers, func(i, j int) bool { return offers[i].OfferedStart.Before(*offers[j].OfferedStart) })
+	// Столики под предложение подбираются по занятости на все время его визита
+	for _, o := range offers {
+		if o.OfferedStart.Before(from) {
+			from = *o.OfferedStart
+		}
+		if end := o.OfferedStart.Add(duration); end.After(to) {
+			to = end
+		}
+	}
+
+	var occupancies []tableOccupancy
+	for _, mb := range m.bookings {
+		if mb.ID == excludeID || mb.RestaurantID != restaurantID || !containsStatus(activeStatuses, mb.Status) || !overlaps(from, to, mb.StartsAt, mb.EndsAt) {
+			continue
+		}
+		for _, id := range mb.tableIDs {
+			occupancies = append(occupancies, tableOccupancy{TableID: id, Start: mb.StartsAt, End: mb.EndsAt})
+		}
+	}
+	if len(offers) == 0 {
+		return occupancies
+	}
+	return append(occupancies, offerHolds(offers, m.tableList(restaurantID), occupancies, duration)...)
+}
+
+func (m *MemoryStore) recordEvent(bookingID int, eventType string, actor BookingActor, oldValues, newValues map[string]string) {
+	m.events = append(m.events, BookingEvent{
+		ID:        m.nextID(),
+		BookingID: bookingID,
+		Type:      eventType,
+		Actor:     actor.kind(),
+		UserID:    actor.UserID,
+		Channel:   actor.Channel,
+		IP:        actor.IP,
+		OldValues: oldValues,
+		NewValues: newValues,
+		CreatedAt: time.Now().In(config.Location),
+	})
+}
+
+func (m *MemoryStore) CreateBooking(booking *Booking, actor BookingActor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createBooking(booking, actor, 0)
+}
+
+// createBooking создает бронирование; место под предложение заявки claimID свободно для него. Вызывается под m.mu
+func (m *MemoryStore) createBooking(booking *Booking, actor BookingActor, claimID int) error {
+	guests, err := strconv.Atoi(booking.Guests)
+	if err != nil {
+		return fmt.Errorf("неверное количество гостей: %v", err)
+	}
+	start, err := bookingStart(booking.Date, booking.Time)
+	if err != nil {
+		return fmt.Errorf("неверный формат даты или времени: %v", err)
+	}
+	end := start.Add(time.Duration(booking.Duration) * time.Minute)
+
+	if m.hasActiveBooking(booking.RestaurantID, booking.Phone, booking.Date, 0) {
+		return ErrDuplicateBooking
+	}
+	if !m.phoneNameUnique(booking.Phone, booking.Name) {
+		return ErrPhoneNameMismatch
+	}
+
+	assigned := assignTables(m.tableList(booking.RestaurantID), busyAt(m.occupancies(booking.RestaurantID, start, end, 0, claimID), start, end), guests)
+	if assigned == nil {
+		return ErrNoTableAvailable
+	}
+
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	booking.StartsAt, booking.EndsAt = start, end
+	stored := &memoryBooking{Booking: *booking, tokenHash: tokenHash}
+	stored.ID = m.nextID()
+	stored.Guests = strconv.Itoa(guests)
+	stored.Status = StatusPending
+	stored.Created = time.Now().In(config.Location)
+	stored.Updated = stored.Created
+	for _, t := range assigned {
+		stored.tableIDs = append(stored.tableIDs, t.ID)
+	}
+	m.bookings[stored.ID] = stored
+
+	booking.ID = stored.ID
+	booking.Created, booking.Updated = stored.Created, stored.Updated
+	booking.Restaurant = m.restaurantName(booking.RestaurantID)
+	booking.ManageToken = token
+	booking.Tables = nil
+	for _, t := range assigned {
+		booking.Tables = append(booking.Tables, t.Number)
+	}
+
+	m.recordEvent(booking.ID, EventCreated, actor, nil, bookingValues(booking))
+	m.enqueueNotifications(NotifyCreated, booking)
+	return nil
+}
+
+func (m *MemoryStore) UpdateBooking(booking *Booking, changes BookingChanges, actor BookingActor) error {
+	start, err := bookingStart(changes.Date, changes.Time)
+	if err != nil {
+		return fmt.Errorf("неверный формат даты или времени: %v", err)
+	}
+	end := start.Add(time.Duration(booking.Duration) * time.Minute)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.bookings[booking.ID]
+	if !ok || stored.Status != booking.Status {
+		return ErrStatusChanged
+	}
+	if changes.Date != booking.Date && m.hasActiveBooking(stored.RestaurantID, booking.Phone, changes.Date, booking.ID) {
+		return ErrDuplicateBooking
+	}
+
+	assigned := assignTables(m.tableList(stored.RestaurantID), busyAt(m.occupancies(stored.RestaurantID, start, end, booking.ID, 0), start, end), changes.Guests)
+	if assigned == nil {
+		return ErrNoTableAvailable
+	}
+
+	if !start.Equal(stored.StartsAt) {
+		delete(m.notices, memoryNotice{bookingID: booking.ID, notice: NoticeReminder24h})
+		delete(m.notices, memoryNotice{bookingID: booking.ID, notice: NoticeReminder2h})
+	}
+
+	stored.Date = changes.Date
+	stored.Time = changes.Time
+	stored.StartsAt, stored.EndsAt = start, end
+	stored.Guests = strconv.Itoa(changes.Guests)
+	stored.Comments = changes.Comments
+	stored.Revision++
+	stored.Updated = time.Now().In(config.Location)
+	stored.tableIDs = nil
+	for _, t := range assigned {
+		stored.tableIDs = append(stored.tableIDs, t.ID)
+	}
+
+	updated := m.booking(stored)
+	oldValues, newValues := changedValues(bookingValues(booking), bookingValues(&updated))
+	if len(newValues) > 0 {
+		m.recordEvent(booking.ID, EventUpdated, actor, oldValues, newValues)
+	}
+	*booking = updated
+	return nil
+}
+
+func (m *MemoryStore) UpdateBookingStatus(id int, from, to string, actor BookingActor) error {
+	if _, ok := statusTimestampColumns[to]; !ok {
+		return fmt.Errorf("неизвестный статус бронирования: %s", to)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.bookings[id]
+	if !ok || stored.Status != from {
+		return ErrStatusChanged
+	}
+
+	now := time.Now().In(config.Location)
+	stored.Status = to
+	stored.Revision++
+	stored.Updated = now
+	switch to {
+	case StatusConfirmed:
+		stored.ConfirmedAt = &now
+	case StatusSeated:
+		stored.SeatedAt = &now
+	case StatusCompleted:
+		stored.CompletedAt = &now
+	case StatusCancelled:
+		stored.CancelledAt = &now
+	case StatusNoShow:
+		stored.NoShowAt = &now
+	case StatusExpired:
+		stored.ExpiredAt = &now
+	}
+
+	m.recordEvent(id, EventStatusChanged, actor, map[string]string{"status": from}, map[string]string{"status": to})
+	if kind, ok := statusNotifications[to]; ok {
+		booking := m.booking(stored)
+		m.enqueueNotifications(kind, &booking)
+	}
+	if releasesSlot(to) {
+		m.offerSlot(stored.RestaurantID, stored.Date, stored.StartsAt)
+	}
+	return nil
+}
+
+// enqueueNotifications ставит уведомления в очередь; вызывается под m.mu
+func (m *MemoryStore) enqueueNotifications(kind string, booking *Booking) {
+	batch, err := notificationsFor(kind, booking)
+	if err != nil {
+		slog.Error("Уведомление о бронировании не отправлено", "booking_id", booking.ID, "error", err)
+		return
+	}
+	m.addNotifications(batch)
+}
+
+func (m *MemoryStore) addNotifications(batch []Notification) {
+	for _, n := range batch {
+		n.ID = m.nextID()
+		m.outbox[n.ID] = &memoryNotification{Notification: n, status: NotificationPending, sendAfter: time.Now()}
+	}
+}
+
+func (m *MemoryStore) ClaimNotifications(limit int, lease time.Duration) ([]Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var ready []*memoryNotification
+	for _, mn := range m.outbox {
+		if mn.status == NotificationPending && !mn.sendAfter.After(now) && !mn.lockedUntil.After(now) {
+			ready = append(ready, mn)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		if !ready[i].sendAfter.Equal(ready[j].sendAfter) {
+			return ready[i].sendAfter.Before(ready[j].sendAfter)
+		}
+		return ready[i].ID < ready[j].ID
+	})
+	if len(ready) > limit {
+		ready = ready[:limit]
+	}
+
+	claimed := make([]Notification, 0, len(ready))
+	for _, mn := range ready {
+		mn.lockedUntil = now.Add(lease)
+		claimed = append(claimed, mn.Notification)
+	}
+	return claimed, nil
+}
+
+func (m *MemoryStore) MarkNotificationSent(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mn, ok := m.outbox[id]; ok {
+		mn.status = NotificationSent
+		mn.Attempts++
+		mn.lastError = ""
+		mn.lockedUntil = time.Time{}
+		mn.sentAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MemoryStore) MarkNotificationFailed(id int, errMsg string, retryAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mn, ok := m.outbox[id]; ok {
+		mn.Attempts++
+		mn.lastError = errMsg
+		mn.lockedUntil = time.Time{}
+		if retryAt != nil {
+			mn.sendAfter = *retryAt
+		} else {
+			mn.status = NotificationFailed
+		}
+	}
+	return nil
+}
+
+// Хранилище в памяти живет в одном процессе, поэтому он всегда ведущий
+func (m *MemoryStore) AcquireJobLeadership(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (m *MemoryStore) ReleaseJobLeadership() {}
+
+// enqueueNotices ставит плановое уведомление по подходящим бронированиям, о которых его еще не ставили
+func (m *MemoryStore) enqueueNotices(notice, kind string, match func(b *Booking) bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, b := range m.sortedBookings(match) {
+		key := memoryNotice{bookingID: b.ID, notice: notice}
+		if m.notices[key] {
+			continue
+		}
+		m.notices[key] = true
+		m.enqueueNotifications(kind, &b)
+		count++
+	}
+	return count
+}
+
+func (m *MemoryStore) EnqueueReminders(notice string, from, to time.Time) (int, error) {
+	return m.enqueueNotices(notice, NotifyReminder, func(b *Booking) bool {
+		return b.Status == StatusConfirmed && b.StartsAt.After(from) && !b.StartsAt.After(to)
+	}), nil
+}
+
+func (m *MemoryStore) EnqueueFeedback(from, to time.Time) (int, error) {
+	return m.enqueueNotices(NoticeFeedback, NotifyFeedback, func(b *Booking) bool {
+		return b.Status == StatusCompleted && b.CompletedAt != nil &&
+			b.CompletedAt.After(from) && !b.CompletedAt.After(to)
+	}), nil
+}
+
+func (m *MemoryStore) StalePendingBookings(createdBefore, startsBefore time.Time) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []int
+	for id, mb := range m.bookings {
+		if mb.Status == StatusPending && (!mb.Created.After(createdBefore) || !mb.StartsAt.After(startsBefore)) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (m *MemoryStore) RecordJobRun(run *JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run.ID = m.nextID()
+	m.jobRuns = append(m.jobRuns, *run)
+	return nil
+}
+
+func (m *MemoryStore) GetJobRuns(limit int) ([]JobRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	runs := []JobRun{}
+	for i := len(m.jobRuns) - 1; i >= 0 && len(runs) < limit; i-- {
+		run := m.jobRuns[i]
+		run.StartedAt = run.StartedAt.In(config.Location)
+		run.FinishedAt = run.FinishedAt.In(config.Location)
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func (m *MemoryStore) DeleteJobRuns(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.jobRuns[:0]
+	for _, run := range m.jobRuns {
+		if !run.StartedAt.Before(before) {
+			kept = append(kept, run)
+		}
+	}
+	m.jobRuns = kept
+	return nil
+}
+
+func (m *MemoryStore) SearchBookings(restaurantID int, q BookingQuery) (*BookingPage, error) {
+	search, digits := strings.ToLower(q.Search), q.searchDigits()
+	name := strings.ToLower(q.Name)
+	field, desc := q.sortField()
+
+	m.mu.Lock()
+	bookings := m.sortedBookings(func(b *Booking) bool {
+		guests, _ := strconv.Atoi(b.Guests)
+		return b.RestaurantID == restaurantID &&
+			(q.From.IsZero() || !b.StartsAt.Before(q.From)) &&
+			(q.To.IsZero() || b.StartsAt.Before(q.To)) &&
+			(q.CreatedFrom.IsZero() || !b.Created.Before(q.CreatedFrom)) &&
+			(q.CreatedTo.IsZero() || b.Created.Before(q.CreatedTo)) &&
+			(len(q.Statuses) == 0 || containsStatus(q.Statuses, b.Status)) &&
+			(q.GuestsMin == 0 || guests >= q.GuestsMin) &&
+			(q.GuestsMax == 0 || guests <= q.GuestsMax) &&
+			(q.Phone == "" || strings.Contains(b.Phone, q.Phone)) &&
+			(name == "" || strings.Contains(strings.ToLower(b.Name), name)) &&
+			(search == "" || strings.Contains(strings.ToLower(b.Name), search) ||
+				strings.Contains(strings.ToLower(b.Comments), search) ||
+				(digits != "" && strings.Contains(b.Phone, digits)))
+	})
+	m.mu.Unlock()
+
+	// Тот же порядок, что и в SQL: поле сортировки, затем ID
+	compare := func(a *Booking, value string, id int) int {
+		var c int
+		switch field {
+		case "guests":
+			x, _ := strconv.Atoi(a.Guests)
+			y, _ := strconv.Atoi(value)
+			c = x - y
+		case "name":
+			c = strings.Compare(a.Name, value)
+		default:
+			x := bookingSortValue(a, field)
+			tx, _ := time.Parse(time.RFC3339Nano, x)
+			ty, _ := time.Parse(time.RFC3339Nano, value)
+			c = tx.Compare(ty)
+		}
+		if c == 0 {
+			c = a.ID - id
+		}
+		if desc {
+			c = -c
+		}
+		return c
+	}
+	sort.SliceStable(bookings, func(i, j int) bool {
+		return compare(&bookings[i], bookingSortValue(&bookings[j], field), bookings[j].ID) < 0
+	})
+	if q.Cursor != nil {
+		start := sort.Search(len(bookings), func(i int) bool {
+			return compare(&bookings[i], q.Cursor.Value, q.Cursor.ID) > 0
+		})
+		bookings = bookings[start:]
+	}
+
+	page := &BookingPage{Bookings: bookings}
+	if q.Limit > 0 && len(bookings) > q.Limit {
+		page.Bookings = bookings[:q.Limit]
+		page.NextCursor = q.nextCursor(&page.Bookings[q.Limit-1])
+	}
+	return page, nil
+}
+
+func (m *MemoryStore) GetBookingByID(id int) (*Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.bookings[id]
+	if !ok {
+		return nil, fmt.Errorf("бронирование не найдено")
+	}
+	booking := m.booking(stored)
+	return &booking, nil
+}
+
+func (m *MemoryStore) GetBookingByToken(token string) (*Booking, error) {
+	if token == "" {
+		return nil, nil
+	}
+	hash := hashToken(token)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.bookings {
+		if stored.tokenHash == hash {
+			booking := m.booking(stored)
+			return &booking, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) CheckBookingToken(id int, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.bookings[id]
+	return ok && stored.tokenHash == hashToken(token), nil
+}
+
+func (m *MemoryStore) GetBookingEvents(bookingID int) ([]BookingEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []BookingEvent{}
+	for _, e := range m.events {
+		if e.BookingID != bookingID {
+			continue
+		}
+		if e.UserID != nil {
+			if u, ok := m.users[*e.UserID]; ok {
+				e.Username = u.Username
+			}
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) CheckExistingBooking(restaurantID int, phone, date string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hasActiveBooking(restaurantID, phone, date, 0), nil
+}
+
+func (m *MemoryStore) CheckPhoneNameUnique(phone, name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.phoneNameUnique(phone, name), nil
+}
+
+func (m *MemoryStore) TableOccupancies(restaurantID int, from, to time.Time, excludeID int) ([]tableOccupancy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.occupancies(restaurantID, from, to, excludeID, 0), nil
+}
+
+// user возвращает копию пользователя со своим списком ресторанов
+func (m *MemoryStore) user(stored *memoryUser) User {
+	u := stored.User
+	u.Restaurants = append([]int{}, stored.Restaurants...)
+	return u
+}
+
+// userByName ищет пользователя по имени; nil, если такого нет
+func (m *MemoryStore) userByName(username string) *memoryUser {
+	for _, u := range m.users {
+		if u.Username == username {
+			return u
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateAdminUser(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userByName(username) != nil {
+		return nil
+	}
+	id := m.nextID()
+	m.users[id] = &memoryUser{
+		User:         User{ID: id, Username: username, Role: RoleOwner, CreatedAt: time.Now().In(config.Location)},
+		passwordHash: hash,
+	}
+	return nil
+}
+
+func (m *MemoryStore) AuthenticateUser(username, password string) (*User, error) {
+	m.mu.Lock()
+	stored := m.userByName(username)
+	var user User
+	var hash string
+	if stored != nil && !stored.Disabled {
+		user, hash = m.user(stored), stored.passwordHash
+	}
+	m.mu.Unlock()
+
+	if hash == "" {
+		// Сравниваем с фиктивным хэшем, чтобы время ответа не выдавало существование пользователя
+		checkPassword(dummyPasswordHash, password)
+		return nil, nil
+	}
+	if ok, _ := checkPassword(hash, password); !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
+
+func (m *MemoryStore) GetUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []User
+	for _, u := range m.users {
+		users = append(users, m.user(u))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (m *MemoryStore) GetUserByID(id int) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[id]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	user := m.user(stored)
+	return &user, nil
+}
+
+func (m *MemoryStore) CreateUser(username, password string, role Role) (*User, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userByName(username) != nil {
+		return nil, errUniqueViolation
+	}
+	id := m.nextID()
+	stored := &memoryUser{
+		User:         User{ID: id, Username: username, Role: role, CreatedAt: time.Now().In(config.Location), Restaurants: []int{}},
+		passwordHash: hash,
+	}
+	m.users[id] = stored
+	user := m.user(stored)
+	return &user, nil
+}
+
+func (m *MemoryStore) UpdateUser(u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return errUserNotFound
+	}
+	stored.Role = u.Role
+	stored.Disabled = u.Disabled
+	if u.Disabled {
+		m.deleteUserSessions(u.ID)
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetUserRestaurants(userID int, restaurantIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[userID]
+	if !ok {
+		return errUserNotFound
+	}
+	stored.Restaurants = append([]int{}, restaurantIDs...)
+	sort.Ints(stored.Restaurants)
+	return nil
+}
+
+func (m *MemoryStore) SetUserPassword(id int, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.users[id]; ok {
+		stored.passwordHash = hash
+	}
+	m.deleteUserSessions(id)
+	return nil
+}
+
+func (m *MemoryStore) CountActiveOwners() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, u := range m.users {
+		if u.Role == RoleOwner && !u.Disabled {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) CreateSession(userID int, ip, userAgent string, ttl time.Duration) (string, time.Time, error) {
+	token, _, err := newToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[hashSessionToken(token)] = memorySession{userID: userID, expiresAt: expiresAt}
+	return token, expiresAt, nil
+}
+
+func (m *MemoryStore) GetSessionUser(token string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[hashSessionToken(token)]
+	if !ok || !session.expiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	stored, ok := m.users[session.userID]
+	if !ok || stored.Disabled {
+		return nil, nil
+	}
+	user := m.user(stored)
+	return &user, nil
+}
+
+func (m *MemoryStore) CreateCalendarToken(userID int) (string, error) {
+	token, _, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.users[userID]; ok {
+		stored.calendarTokenHash = hashSessionToken(token)
+	}
+	return token, nil
+}
+
+func (m *MemoryStore) DeleteCalendarToken(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.users[userID]; ok {
+		stored.calendarTokenHash = ""
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetCalendarUser(token string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := hashSessionToken(token)
+	for _, stored := range m.users {
+		if stored.calendarTokenHash == hash && !stored.Disabled {
+			user := m.user(stored)
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) DeleteSession(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, hashSessionToken(token))
+	return nil
+}
+
+func (m *MemoryStore) DeleteUserSessions(userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteUserSessions(userID)
+	return nil
+}
+
+func (m *MemoryStore) deleteUserSessions(userID int) {
+	for hash, session := range m.sessions {
+		if session.userID == userID {
+			delete(m.sessions, hash)
+		}
+	}
+}
+
+func (m *MemoryStore) DeleteExpiredSessions() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for hash, session := range m.sessions {
+		if !session.expiresAt.After(now) {
+			delete(m.sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetTables(restaurantID int) ([]Table, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tableList(restaurantID), nil
+}
+
+// tableNumberTaken проверяет, занят ли номер другим столиком того же ресторана
+func (m *MemoryStore) tableNumberTaken(restaurantID, number, excludeID int) bool {
+	for _, t := range m.tables {
+		if t.RestaurantID == restaurantID && t.Number == number && t.ID != excludeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) CreateTable(t *Table) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tableNumberTaken(t.RestaurantID, t.Number, 0) {
+		return errUniqueViolation
+	}
+	t.ID = m.nextID()
+	stored := *t
+	m.tables[t.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) UpdateTable(t *Table) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.tables[t.ID]; !ok || stored.RestaurantID != t.RestaurantID {
+		return errTableNotFound
+	}
+	if m.tableNumberTaken(t.RestaurantID, t.Number, t.ID) {
+		return errUniqueViolation
+	}
+	stored := *t
+	m.tables[t.ID] = &stored
+	return nil
+}
+
+// DeleteTable удаляет столик ресторана; если к нему уже привязаны бронирования, столик только деактивируется
+func (m *MemoryStore) DeleteTable(restaurantID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.tables[id]
+	if !ok || t.RestaurantID != restaurantID {
+		return errTableNotFound
+	}
+	for _, mb := range m.bookings {
+		for _, tableID := range mb.tableIDs {
+			if tableID == id {
+				t.Active = false
+				return nil
+			}
+		}
+	}
+	delete(m.tables, id)
+	return nil
+}
+
+func (m *MemoryStore) EnsureDefaultTables(restaurantID int, tables []Table) error {
+	m.mu.Lock()
+	empty := len(m.tableList(restaurantID)) == 0
+	m.mu.Unlock()
+	if !empty {
+		return nil
+	}
+	for i := range tables {
+		tables[i].RestaurantID = restaurantID
+		if err := m.CreateTable(&tables[i]); err != nil {
+			return fmt.Errorf("ошибка создания столика %d: %v", tables[i].Number, err)
+		}
+	}
+	return nil
+}
+
+// GetDaySchedule собирает расписание на дату по тем же правилам, что и Database.GetDaySchedule
+func (m *MemoryStore) GetDaySchedule(restaurantID int, date string) (DaySchedule, error) {
+	schedule := DaySchedule{Date: date, Periods: []ServicePeriod{}, Blackouts: []Blackout{}}
+
+	day, err := time.ParseInLocation("2006-01-02", date, config.Location)
+	if err != nil {
+		return schedule, fmt.Errorf("неверный формат даты: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedule = m.dayPeriods(restaurantID, day)
+	if schedule.Closed {
+		return schedule, nil
+	}
+	schedule.Periods = append(overnightTails(m.dayPeriods(restaurantID, day.AddDate(0, 0, -1))), schedule.Periods...)
+
+	// Блокировки, пересекающиеся с этими сутками (визит может закончиться после полуночи)
+	windowEnd := day.AddDate(0, 0, 2)
+	for _, b := range m.blackouts {
+		if b.RestaurantID == restaurantID && b.Start.Before(windowEnd) && b.End.After(day) {
+			schedule.Blackouts = append(schedule.Blackouts, *b)
+		}
+	}
+	sort.Slice(schedule.Blackouts, func(i, j int) bool { return schedule.Blackouts[i].Start.Before(schedule.Blackouts[j].Start) })
+	return schedule, nil
+}
+
+// dayPeriods возвращает собственные периоды дня без блокировок; вызывается под m.mu
+func (m *MemoryStore) dayPeriods(restaurantID int, day time.Time) DaySchedule {
+	date := day.Format("2006-01-02")
+	schedule := DaySchedule{Date: date, Periods: []ServicePeriod{}, Blackouts: []Blackout{}}
+
+	// Праздники закрывают ресторан на весь день
+	holidayID := 0
+	for _, h := range m.holidays {
+		if h.RestaurantID == restaurantID && (h.Date == date || (h.Recurring && len(h.Date) == 10 && h.Date[5:] == date[5:])) && (holidayID == 0 || h.ID < holidayID) {
+			holidayID = h.ID
+		}
+	}
+	if holidayID != 0 {
+		schedule.Closed = true
+		schedule.Reason = m.holidays[holidayID].Name
+		return schedule
+	}
+
+	// Особые часы на дату заменяют недельное расписание
+	for _, o := range m.overrides {
+		if o.RestaurantID == restaurantID && o.Date == date {
+			schedule.Periods = append(schedule.Periods, ServicePeriod{Name: o.Name, Open: o.Open, Close: o.Close})
+		}
+	}
+	if len(schedule.Periods) == 0 {
+		for _, p := range m.openingHours {
+			if p.RestaurantID == restaurantID && p.Weekday == int(day.Weekday()) {
+				schedule.Periods = append(schedule.Periods, ServicePeriod{Name: p.Name, Open: p.Open, Close: p.Close})
+			}
+		}
+	}
+	sort.Slice(schedule.Periods, func(i, j int) bool { return schedule.Periods[i].Open < schedule.Periods[j].Open })
+	return schedule
+}
+
+func (m *MemoryStore) GetOpeningHours(restaurantID int) ([]OpeningPeriod, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var periods []OpeningPeriod
+	for _, p := range m.openingHours {
+		if p.RestaurantID == restaurantID {
+			periods = append(periods, *p)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		if periods[i].Weekday != periods[j].Weekday {
+			return periods[i].Weekday < periods[j].Weekday
+		}
+		return periods[i].Open < periods[j].Open
+	})
+	return periods, nil
+}
+
+func (m *MemoryStore) CreateOpeningPeriod(p *OpeningPeriod) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.ID = m.nextID()
+	stored := *p
+	m.openingHours[p.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) EnsureDefaultOpeningHours(restaurantID int, open, close string) error {
+	m.mu.Lock()
+	empty := true
+	for _, p := range m.openingHours {
+		if p.RestaurantID == restaurantID {
+			empty = false
+			break
+		}
+	}
+	m.mu.Unlock()
+	if !empty {
+		return nil
+	}
+	for weekday := 0; weekday < 7; weekday++ {
+		p := OpeningPeriod{RestaurantID: restaurantID, Weekday: weekday, Name: "Основное время", Open: open, Close: close}
+		if err := m.CreateOpeningPeriod(&p); err != nil {
+			return fmt.Errorf("ошибка создания часов работы: %v", err)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetScheduleOverrides(restaurantID int, from string) ([]ScheduleOverride, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var overrides []ScheduleOverride
+	for _, o := range m.overrides {
+		if o.RestaurantID == restaurantID && o.Date >= from {
+			overrides = append(overrides, *o)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].Date != overrides[j].Date {
+			return overrides[i].Date < overrides[j].Date
+		}
+		return overrides[i].Open < overrides[j].Open
+	})
+	return overrides, nil
+}
+
+func (m *MemoryStore) CreateScheduleOverride(o *ScheduleOverride) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o.ID = m.nextID()
+	stored := *o
+	m.overrides[o.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) GetHolidays(restaurantID int) ([]Holiday, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var holidays []Holiday
+	for _, h := range m.holidays {
+		if h.RestaurantID == restaurantID {
+			holidays = append(holidays, *h)
+		}
+	}
+	sort.Slice(holidays, func(i, j int) bool { return holidays[i].Date < holidays[j].Date })
+	return holidays, nil
+}
+
+func (m *MemoryStore) CreateHoliday(h *Holiday) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h.ID = m.nextID()
+	stored := *h
+	m.holidays[h.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) GetBlackouts(restaurantID int, after time.Time) ([]Blackout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var blackouts []Blackout
+	for _, b := range m.blackouts {
+		if b.RestaurantID == restaurantID && b.End.After(after) {
+			blackouts = append(blackouts, *b)
+		}
+	}
+	sort.Slice(blackouts, func(i, j int) bool { return blackouts[i].Start.Before(blackouts[j].Start) })
+	return blackouts, nil
+}
+
+func (m *MemoryStore) CreateBlackout(b *Blackout) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b.ID = m.nextID()
+	stored := *b
+	m.blackouts[b.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) DeleteScheduleItem(restaurantID int, kind string, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found bool
+	switch kind {
+	case "weekly":
+		if p, ok := m.openingHours[id]; ok && p.RestaurantID == restaurantID {
+			found = true
+			delete(m.openingHours, id)
+		}
+	case "overrides":
+		if o, ok := m.overrides[id]; ok && o.RestaurantID == restaurantID {
+			found = true
+			delete(m.overrides, id)
+		}
+	case "holidays":
+		if h, ok := m.holidays[id]; ok && h.RestaurantID == restaurantID {
+			found = true
+			delete(m.holidays, id)
+		}
+	case "blackouts":
+		if b, ok := m.blackouts[id]; ok && b.RestaurantID == restaurantID {
+			found = true
+			delete(m.blackouts, id)
+		}
+	default:
+		return fmt.Errorf("неизвестный раздел расписания: %s", kind)
+	}
+	if !found {
+		return errScheduleItemNotFound
+	}
+	return nil
+}
+
+// sortedWaitlist возвращает копии заявок, прошедших фильтр, в порядке очереди
+func (m *MemoryStore) sortedWaitlist(keep func(e *WaitlistEntry) bool) []WaitlistEntry {
+	entries := []WaitlistEntry{}
+	for _, me := range m.waitlist {
+		if keep(&me.WaitlistEntry) {
+			e := me.WaitlistEntry
+			e.Restaurant = m.restaurantName(e.RestaurantID)
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Created.Equal(entries[j].Created) {
+			return entries[i].Created.Before(entries[j].Created)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+func (m *MemoryStore) CreateWaitlistEntry(e *WaitlistEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, me := range m.waitlist {
+		if me.RestaurantID == e.RestaurantID && me.Phone == e.Phone && me.Date == e.Date && (me.Status == WaitlistWaiting || me.Status == WaitlistOffered) {
+			return ErrDuplicateWaitlist
+		}
+	}
+	e.ID = m.nextID()
+	e.Status = WaitlistWaiting
+	e.Created = time.Now().In(config.Location)
+	m.waitlist[e.ID] = &memoryWaitlistEntry{WaitlistEntry: *e}
+	return nil
+}
+
+func (m *MemoryStore) GetWaitlist(restaurantID int, date string) ([]WaitlistEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sortedWaitlist(func(e *WaitlistEntry) bool { return e.RestaurantID == restaurantID && e.Date == date }), nil
+}
+
+func (m *MemoryStore) GetWaitlistOffer(token string) (*WaitlistEntry, error) {
+	if token == "" {
+		return nil, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := hashToken(token)
+	for _, me := range m.waitlist {
+		if me.tokenHash == hash {
+			e := me.WaitlistEntry
+			e.Restaurant = m.restaurantName(e.RestaurantID)
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) ClaimWaitlistOffer(id int, booking *Booking, actor BookingActor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.waitlist[id]
+	if !ok || !me.offerActive(time.Now()) {
+		return ErrStatusChanged
+	}
+	if err := m.createBooking(booking, actor, id); err != nil {
+		return err
+	}
+	bookingID := booking.ID
+	me.Status = WaitlistClaimed
+	me.BookingID = &bookingID
+	return nil
+}
+
+func (m *MemoryStore) CancelWaitlistEntry(restaurantID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	me, ok := m.waitlist[id]
+	if !ok || me.RestaurantID != restaurantID {
+		return errWaitlistEntryNotFound
+	}
+	if me.Status != WaitlistWaiting && me.Status != WaitlistOffered {
+		return ErrStatusChanged
+	}
+	wasOffered := me.Status == WaitlistOffered
+	me.Status = WaitlistCancelled
+	if wasOffered && me.OfferedStart != nil {
+		m.offerSlot(me.RestaurantID, me.Date, *me.OfferedStart)
+	}
+	return nil
+}
+
+func (m *MemoryStore) ExpireWaitlist(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for _, me := range m.waitlist {
+		if me.Status == WaitlistWaiting && me.WindowEnd.Before(now) {
+			me.Status = WaitlistExpired
+			expired++
+		}
+	}
+	offers := m.sortedWaitlist(func(e *WaitlistEntry) bool {
+		return e.Status == WaitlistOffered && !e.OfferExpiresAt.After(now)
+	})
+	for _, e := range offers {
+		m.waitlist[e.ID].Status = WaitlistExpired
+		expired++
+		m.offerSlot(e.RestaurantID, e.Date, *e.OfferedStart)
+	}
+	return expired, nil
+}
+
+// offerSlot предлагает освободившееся место ресторана первой подходящей заявке; вызывается под m.mu
+func (m *MemoryStore) offerSlot(restaurantID int, date string, start time.Time) {
+	now := time.Now()
+	rest, ok := m.restaurants[restaurantID]
+	if !start.After(now) || !ok {
+		return
+	}
+	duration := rest.DiningDuration()
+	end := start.Add(duration)
+
+	candidates := m.sortedWaitlist(func(e *WaitlistEntry) bool {
+		return e.Status == WaitlistWaiting && e.RestaurantID == restaurantID && e.Date == date &&
+			!start.Before(e.WindowStart) && !start.After(e.WindowEnd)
+	})
+	if len(candidates) == 0 {
+		return
+	}
+	entry := pickWaitlistEntry(candidates, m.tableList(restaurantID), m.occupancies(restaurantID, start, end, 0, 0), start, end)
+	if entry == nil {
+		return
+	}
+
+	token, tokenHash, err := newToken()
+	if err != nil {
+		slog.Error("Место не предложено заявке", "waitlist_id", entry.ID, "error", err)
+		return
+	}
+	offered := start.In(config.Location)
+	expires := offerDeadline(start, now).In(config.Location)
+	stored := m.waitlist[entry.ID]
+	stored.Status = WaitlistOffered
+	stored.OfferedStart, stored.OfferExpiresAt = &offered, &expires
+	stored.tokenHash = tokenHash
+
+	slog.Info("Место предложено заявке из листа ожидания", "waitlist_id", entry.ID, "slot", offered.Format("2006-01-02 15:04"))
+	offer := stored.WaitlistEntry
+	offer.Restaurant = rest.Name
+	batch, err := waitlistOfferNotifications(&offer, token)
+	if err != nil {
+		slog.Error("Уведомление по заявке не отправлено", "waitlist_id", entry.ID, "error", err)
+		return
+	}
+	m.addNotifications(batch)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Метрики Prometheus, которые отдаются на /metrics
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dinebook_http_requests_total",
+		Help: "HTTP-запросы по шаблону маршрута, методу и коду ответа.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dinebook_http_request_duration_seconds",
+		Help:    "Время обработки HTTP-запроса по шаблону маршрута и методу.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dinebook_db_query_duration_seconds",
+		Help:    "Время выполнения методов хранилища Database.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	bookingsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dinebook_bookings_created_total",
+		Help: "Созданные бронирования по ресторану и источнику (web — форма на сайте, api — API v1, waitlist — из листа ожидания, import — загрузка из файла).",
+	}, []string{"restaurant_id", "source"})
+
+	coversBooked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dinebook_covers_booked_total",
+		Help: "Гости в созданных бронированиях по ресторану.",
+	}, []string{"restaurant_id"})
+
+	bookingStatusChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dinebook_booking_status_changes_total",
+		Help: "Смены статуса бронирований по новому статусу (confirmed, cancelled, expired и т.д.).",
+	}, []string{"status"})
+
+	bookingsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dinebook_bookings_rejected_total",
+		Help: "Отклоненные заявки на бронирование по причине.",
+	}, []string{"reason"})
+)
+
+// metricsRegistry — собственный реестр, чтобы на /metrics попадали только метрики сервера
+var metricsRegistry = prometheus.NewRegistry()
+
+// registerMetrics регистрирует метрики сервера, среды выполнения и пула соединений с базой
+func registerMetrics(store Store) {
+	metricsRegistry.MustRegister(
+		httpRequests, httpDuration, dbQueryDuration,
+		bookingsCreated, coversBooked, bookingStatusChanges, bookingsRejected,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		newCoversCollector(),
+	)
+	if sqlDB, ok := store.(*Database); ok {
+		metricsRegistry.MustRegister(collectors.NewDBStatsCollector(sqlDB.DB, config.DBDriver))
+	}
+}
+
+// handleMetrics отдает метрики; если задан MetricsToken, требуется заголовок Authorization: Bearer <токен>
+func handleMetrics() http.Handler {
+	metrics := promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.MetricsToken != "" {
+			expected := "Bearer " + config.MetricsToken
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+				http.Error(w, "Требуется авторизация", http.StatusUnauthorized)
+				return
+			}
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder запоминает код ответа для метрик
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap дает http.ResponseController добраться до исходного ответа (Flush при выгрузке)
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// metricsMiddleware считает запросы и время ответа по шаблону маршрута (/r/{slug}/api/book),
+// а не по фактическому пути, чтобы число временных рядов не зависело от ID и токенов в адресах
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routeTemplate возвращает шаблон маршрута, которым обработан запрос
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if tmpl, err := current.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unknown"
+}
+
+// observeQuery записывает время выполнения метода хранилища: defer observeQuery("GetBookings", time.Now())
+func observeQuery(method string, start time.Time) {
+	dbQueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// recordBookingCreated учитывает новое бронирование и число гостей в нем
+func recordBookingCreated(booking *Booking, source string) {
+	restaurant := strconv.Itoa(booking.RestaurantID)
+	bookingsCreated.WithLabelValues(restaurant, source).Inc()
+	if guests, err := strconv.Atoi(booking.Guests); err == nil {
+		coversBooked.WithLabelValues(restaurant).Add(float64(guests))
+	}
+}
+
+func recordBookingStatus(status string) {
+	bookingStatusChanges.WithLabelValues(status).Inc()
+}
+
+// recordBookingRejected учитывает отказ в бронировании. Причина берется из ошибки:
+// проверки бронирования помечают ее в BookingError.Cause.
+func recordBookingRejected(err error) {
+	reason := "other"
+	var bookingErr *BookingError
+	switch {
+	case errors.Is(err, ErrDuplicateBooking):
+		reason = "duplicate"
+	case errors.Is(err, ErrPhoneNameMismatch):
+		reason = "phone_name_mismatch"
+	case errors.Is(err, ErrNoTableAvailable):
+		reason = "no_table"
+	case errors.As(err, &bookingErr) && bookingErr.Cause != "":
+		reason = bookingErr.Cause
+	case errors.As(err, &bookingErr) && bookingErr.Reason != "":
+		reason = bookingErr.Reason
+	}
+	bookingsRejected.WithLabelValues(reason).Inc()
+}
+
+// coversCollector при каждом опросе считает гостей, ожидаемых сегодня в каждом ресторане:
+// бронирования, которые не отменены, не истекли и не закончились неявкой
+type coversCollector struct {
+	desc *prometheus.Desc
+}
+
+func newCoversCollector() *coversCollector {
+	return &coversCollector{desc: prometheus.NewDesc(
+		"dinebook_covers_today",
+		"Гости в сегодняшних бронированиях (ожидают, подтверждены, за столом, завершены) по ресторану.",
+		[]string{"restaurant_id"}, nil,
+	)}
+}
+
+func (c *coversCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *coversCollector) Collect(ch chan<- prometheus.Metric) {
+	restaurants, err := db.GetRestaurants()
+	if err != nil {
+		slog.Error("Ошибка при подсчете гостей для метрик", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	today := BookingQuery{From: restaurantToday(), To: restaurantToday().AddDate(0, 0, 1)}
+	for _, rest := range restaurants {
+		page, err := db.SearchBookings(rest.ID, today)
+		if err != nil {
+			slog.Error("Ошибка при подсчете гостей для метрик", "error", err)
+			ch <- prometheus.NewInvalidMetric(c.desc, err)
+			return
+		}
+		covers := 0
+		for _, b := range page.Bookings {
+			if containsStatus(activeStatuses, b.Status) || b.Status == StatusCompleted {
+				guests, _ := strconv.Atoi(b.Guests)
+				covers += guests
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(covers), strconv.Itoa(rest.ID))
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// Ключ advisory-блокировки, под которой выполняются миграции
+const migrationLockKey = 4701202
+
+// Migration — пронумерованная миграция схемы с SQL для применения и отката.
+// Step — необязательный шаг на Go, который выполняется после Up в той же транзакции.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	Step    migrationStep
+}
+
+// migrationStep — часть миграции, которую нельзя записать в SQL: она зависит от конфигурации
+// сервера (например, от часового пояса ресторана), а SQL встроен в бинарный файл
+type migrationStep func(ctx context.Context, tx *sql.Tx) error
+
+// migrationSteps — шаги на Go по каталогу миграций и номеру
+var migrationSteps = map[string]map[int]migrationStep{
+	"migrations":        {10: backfillBookingTimesPostgres},
+	"migrations/sqlite": {10: backfillBookingTimesSQLite},
+}
+
+// MigrationStatus — состояние миграции в базе
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// migrationsDir — каталог миграций для диалекта базы. Для SQLite схема ведется отдельным набором.
+func (db *Database) migrationsDir() string {
+	if db.driver == DriverSQLite {
+		return "migrations/sqlite"
+	}
+	return "migrations"
+}
+
+// loadMigrations читает встроенные файлы вида 0001_name.up.sql / 0001_name.down.sql из каталога dir
+func loadMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения миграций: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("неверное имя файла миграции: %s", fileName)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("неверный номер миграции: %s", fileName)
+		}
+
+		content, err := migrationFiles.ReadFile(dir + "/" + fileName)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения миграции %s: %v", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1], Step: migrationSteps[dir][version]}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("для миграции %04d нет файла .up.sql", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// withMigrationLock выполняет fn на отдельном соединении под advisory-блокировкой,
+// чтобы несколько экземпляров приложения не мигрировали базу одновременно.
+// SQLite сам сериализует транзакции миграций, блокировка ему не нужна. Зато в нем на время миграций
+// отключаются внешние ключи: изменить ограничение можно только пересозданием таблицы,
+// и удаление старой таблицы иначе каскадом удалило бы связанные строки.
+func (db *Database) withMigrationLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка получения соединения: %v", err)
+	}
+	defer conn.Close()
+
+	if db.driver == DriverSQLite {
+		if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+			return fmt.Errorf("ошибка отключения внешних ключей: %v", err)
+		}
+		defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+	} else {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+			return fmt.Errorf("ошибка блокировки миграций: %v", err)
+		}
+		defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы schema_migrations: %v", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration выполняет SQL миграции и запись в schema_migrations в одной транзакции
+func runMigration(conn *sql.Conn, m Migration, up bool) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := m.Up
+	if !up {
+		script = m.Down
+	}
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("ошибка выполнения миграции %04d_%s: %v", m.Version, m.Name, err)
+	}
+	if up && m.Step != nil {
+		if err := m.Step(ctx, tx); err != nil {
+			return fmt.Errorf("ошибка выполнения миграции %04d_%s: %v", m.Version, m.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка записи версии миграции %04d: %v", m.Version, err)
+	}
+
+	return tx.Commit()
+}
+
+// backfillBookingTimesPostgres заполняет начало и окончание визита существующих бронирований
+// (миграция 0010): дата и время визита записаны по местному времени ресторана из конфигурации
+func backfillBookingTimesPostgres(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE bookings
+		SET starts_at = (booking_date + booking_time) AT TIME ZONE $1,
+			ends_at = ((booking_date + booking_time) AT TIME ZONE $1) + duration_minutes * INTERVAL '1 minute'
+	`, config.Location.String())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		ALTER TABLE bookings ALTER COLUMN starts_at SET NOT NULL;
+		ALTER TABLE bookings ALTER COLUMN ends_at SET NOT NULL;
+		ALTER TABLE bookings ADD CONSTRAINT bookings_ends_after_start CHECK (ends_at > starts_at);
+	`)
+	return err
+}
+
+// backfillBookingTimesSQLite — то же для SQLite: часовых поясов в нем нет, поэтому момент начала
+// каждого бронирования вычисляется в Go и записывается в UTC
+func backfillBookingTimesSQLite(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, booking_date, booking_time, duration_minutes FROM bookings`)
+	if err != nil {
+		return err
+	}
+	type bookingTimes struct {
+		id         int
+		start, end time.Time
+	}
+	var bookings []bookingTimes
+	for rows.Next() {
+		var id, duration int
+		var date, clock string
+		if err := rows.Scan(&id, &date, &clock, &duration); err != nil {
+			rows.Close()
+			return err
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04", date+" "+clock, config.Location)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("бронирование %d: неверные дата или время визита: %v", id, err)
+		}
+		bookings = append(bookings, bookingTimes{id, start, start.Add(time.Duration(duration) * time.Minute)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	const format = "2006-01-02 15:04:05Z"
+	for _, b := range bookings {
+		_, err := tx.ExecContext(ctx, `UPDATE bookings SET starts_at = $1, ends_at = $2 WHERE id = $3`,
+			b.start.UTC().Format(format), b.end.UTC().Format(format), b.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateUp применяет все еще не примененные миграции по порядку
+func (db *Database) MigrateUp() ([]Migration, error) {
+	migrations, err := loadMigrations(db.migrationsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = db.withMigrationLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := runMigration(conn, m, true); err != nil {
+				return err
+			}
+			slog.Info("Применена миграция", "version", m.Version, "migration", m.Name)
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrateDown откатывает steps последних примененных миграций
+func (db *Database) MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := loadMigrations(db.migrationsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = db.withMigrationLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("миграция %04d_%s не поддерживает откат", m.Version, m.Name)
+			}
+			if err := runMigration(conn, m, false); err != nil {
+				return err
+			}
+			slog.Info("Откачена миграция", "version", m.Version, "migration", m.Name)
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// MigrationStatus возвращает список миграций с отметкой о применении
+func (db *Database) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(db.migrationsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = db.withMigrationLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			status := MigrationStatus{Migration: m}
+			if appliedAt, ok := applied[m.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// runMigrateCommand обрабатывает подкоманду `migrate up|down [N]|status`
+func runMigrateCommand(db *Database, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("использование: dinebook-go migrate up|down [N]|status")
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := db.MigrateUp()
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("Схема базы данных актуальна")
+		}
+		return nil
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("неверное количество шагов отката: %s", args[1])
+			}
+			steps = n
+		}
+		done, err := db.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("Нет примененных миграций")
+		}
+		return nil
+	case "status":
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ВЕРСИЯ\tИМЯ\tПРИМЕНЕНА")
+		for _, s := range statuses {
+			applied := "нет"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("неизвестная команда migrate %s (ожидается up, down или status)", args[0])
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS booking_tables;
+ALTER TABLE bookings DROP COLUMN IF EXISTS duration_minutes;
+DROP TABLE IF EXISTS restaurant_tables;
@@ -0,0 +1,21 @@
+-- Столики и привязка к ним бронирований
+CREATE TABLE IF NOT EXISTS restaurant_tables (
+    id SERIAL PRIMARY KEY,
+    number INTEGER UNIQUE NOT NULL,
+    seats INTEGER NOT NULL,
+    min_party INTEGER NOT NULL DEFAULT 1,
+    max_party INTEGER NOT NULL,
+    zone VARCHAR(50) NOT NULL DEFAULT '',
+    combinable BOOLEAN NOT NULL DEFAULT false,
+    active BOOLEAN NOT NULL DEFAULT true
+);
+
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS duration_minutes INTEGER NOT NULL DEFAULT 120;
+
+CREATE TABLE IF NOT EXISTS booking_tables (
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    table_id INTEGER NOT NULL REFERENCES restaurant_tables(id),
+    PRIMARY KEY (booking_id, table_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_booking_tables_table ON booking_tables(table_id);
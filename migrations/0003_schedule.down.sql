@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS blackouts;
+DROP TABLE IF EXISTS holidays;
+DROP TABLE IF EXISTS schedule_overrides;
+DROP TABLE IF EXISTS opening_hours;
@@ -0,0 +1,34 @@
+-- Расписание: недельные часы работы, особые дни, праздники и блокировки
+CREATE TABLE IF NOT EXISTS opening_hours (
+    id SERIAL PRIMARY KEY,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    name VARCHAR(50) NOT NULL DEFAULT '',
+    open_time VARCHAR(5) NOT NULL,
+    close_time VARCHAR(5) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS schedule_overrides (
+    id SERIAL PRIMARY KEY,
+    override_date VARCHAR(10) NOT NULL,
+    name VARCHAR(50) NOT NULL DEFAULT '',
+    open_time VARCHAR(5) NOT NULL,
+    close_time VARCHAR(5) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS holidays (
+    id SERIAL PRIMARY KEY,
+    holiday_date VARCHAR(10) NOT NULL,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    recurring BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE TABLE IF NOT EXISTS blackouts (
+    id SERIAL PRIMARY KEY,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason VARCHAR(200) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_opening_hours_weekday ON opening_hours(weekday);
+CREATE INDEX IF NOT EXISTS idx_schedule_overrides_date ON schedule_overrides(override_date);
+CREATE INDEX IF NOT EXISTS idx_blackouts_range ON blackouts(starts_at, ends_at);
@@ -0,0 +1,3 @@
+UPDATE users SET is_admin = (role IN ('owner', 'manager'));
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
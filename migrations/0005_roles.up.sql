@@ -0,0 +1,7 @@
+-- Роли сотрудников и отключение учетных записей.
+-- Существующие администраторы становятся владельцами.
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'readonly'
+    CHECK (role IN ('owner', 'manager', 'host', 'readonly'));
+ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users SET role = 'owner' WHERE is_admin = true;
@@ -0,0 +1,7 @@
+ALTER TABLE bookings DROP CONSTRAINT IF EXISTS bookings_status_check;
+ALTER TABLE bookings ALTER COLUMN status DROP NOT NULL;
+ALTER TABLE bookings DROP COLUMN IF EXISTS no_show_at;
+ALTER TABLE bookings DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE bookings DROP COLUMN IF EXISTS completed_at;
+ALTER TABLE bookings DROP COLUMN IF EXISTS seated_at;
+ALTER TABLE bookings DROP COLUMN IF EXISTS confirmed_at;
@@ -0,0 +1,11 @@
+-- Жизненный цикл бронирования: допустимые статусы и время каждого перехода
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMP;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS seated_at TIMESTAMP;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS no_show_at TIMESTAMP;
+
+UPDATE bookings SET status = 'pending' WHERE status IS NULL;
+ALTER TABLE bookings ALTER COLUMN status SET NOT NULL;
+ALTER TABLE bookings ADD CONSTRAINT bookings_status_check
+    CHECK (status IN ('pending', 'confirmed', 'seated', 'completed', 'cancelled', 'no_show'));
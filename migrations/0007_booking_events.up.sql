@@ -0,0 +1,15 @@
+-- История изменений бронирований: кто, откуда и что поменял
+CREATE TABLE IF NOT EXISTS booking_events (
+    id SERIAL PRIMARY KEY,
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL,
+    actor VARCHAR(10) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    channel VARCHAR(20) NOT NULL,
+    ip VARCHAR(45),
+    old_values TEXT,
+    new_values TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_booking_events_booking ON booking_events(booking_id, created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_bookings_manage_token;
+ALTER TABLE bookings DROP COLUMN IF EXISTS manage_token_hash;
@@ -0,0 +1,4 @@
+-- Ссылки управления бронированием для гостей: хранится только хэш токена
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS manage_token_hash CHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bookings_manage_token ON bookings(manage_token_hash);
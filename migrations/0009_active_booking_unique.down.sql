@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_bookings_phone_date_active;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bookings_phone_date ON bookings(phone, booking_date);
+ALTER TABLE bookings ADD CONSTRAINT bookings_phone_booking_date_key UNIQUE (phone, booking_date);
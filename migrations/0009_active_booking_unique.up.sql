@@ -0,0 +1,7 @@
+-- Один телефон — одно активное бронирование на дату.
+-- Отмененные, завершенные и неявки больше не мешают забронировать или перенести визит на ту же дату.
+ALTER TABLE bookings DROP CONSTRAINT IF EXISTS bookings_phone_booking_date_key;
+DROP INDEX IF EXISTS idx_bookings_phone_date;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bookings_phone_date_active ON bookings(phone, booking_date)
+    WHERE status IN ('pending', 'confirmed', 'seated');
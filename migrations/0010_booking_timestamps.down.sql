@@ -0,0 +1,17 @@
+ALTER TABLE booking_events ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE bookings
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN updated_at TYPE TIMESTAMP,
+    ALTER COLUMN confirmed_at TYPE TIMESTAMP,
+    ALTER COLUMN seated_at TYPE TIMESTAMP,
+    ALTER COLUMN completed_at TYPE TIMESTAMP,
+    ALTER COLUMN cancelled_at TYPE TIMESTAMP,
+    ALTER COLUMN no_show_at TYPE TIMESTAMP;
+
+DROP INDEX IF EXISTS idx_bookings_starts_at;
+ALTER TABLE bookings DROP CONSTRAINT IF EXISTS bookings_ends_after_start;
+ALTER TABLE bookings DROP COLUMN IF EXISTS ends_at;
+ALTER TABLE bookings DROP COLUMN IF EXISTS starts_at;
+
+ALTER TABLE bookings ALTER COLUMN booking_time TYPE VARCHAR(5) USING to_char(booking_time, 'HH24:MI');
+ALTER TABLE bookings ALTER COLUMN booking_date TYPE VARCHAR(10) USING to_char(booking_date, 'YYYY-MM-DD');
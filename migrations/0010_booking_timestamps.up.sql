@@ -0,0 +1,22 @@
+-- Дата и время визита в собственных типах, момент начала и окончания визита с часовым поясом.
+-- Существующие бронирования записаны по местному времени ресторана: starts_at и ends_at заполняет
+-- шаг миграции на Go (backfillBookingTimesPostgres) по часовому поясу из конфигурации,
+-- он же делает колонки обязательными.
+ALTER TABLE bookings ALTER COLUMN booking_date TYPE DATE USING booking_date::date;
+ALTER TABLE bookings ALTER COLUMN booking_time TYPE TIME USING booking_time::time;
+
+ALTER TABLE bookings ADD COLUMN starts_at TIMESTAMPTZ;
+ALTER TABLE bookings ADD COLUMN ends_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_bookings_starts_at ON bookings(starts_at);
+
+-- Отметки времени писались CURRENT_TIMESTAMP в часовом поясе сессии, в нем же они и переводятся
+ALTER TABLE bookings
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN confirmed_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN seated_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN completed_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN cancelled_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN no_show_at TYPE TIMESTAMPTZ;
+ALTER TABLE booking_events ALTER COLUMN created_at TYPE TIMESTAMPTZ;
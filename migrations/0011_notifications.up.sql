@@ -0,0 +1,23 @@
+-- Адрес электронной почты гостя для уведомлений; необязателен
+ALTER TABLE bookings ADD COLUMN email VARCHAR(254) NOT NULL DEFAULT '';
+
+-- Очередь исходящих уведомлений. Запись добавляется в той же транзакции, что и изменение
+-- бронирования, а отправляет ее фоновый обработчик, поэтому сбой провайдера не влияет на запрос гостя.
+CREATE TABLE IF NOT EXISTS notification_outbox (
+    id SERIAL PRIMARY KEY,
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    channel VARCHAR(10) NOT NULL,
+    recipient VARCHAR(254) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    send_after TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_pending ON notification_outbox(send_after) WHERE status = 'pending';
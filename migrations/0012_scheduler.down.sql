@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS job_runs;
+DROP TABLE IF EXISTS booking_notices;
+
+UPDATE bookings SET status = 'cancelled', cancelled_at = expired_at WHERE status = 'expired';
+ALTER TABLE bookings DROP CONSTRAINT IF EXISTS bookings_status_check;
+ALTER TABLE bookings ADD CONSTRAINT bookings_status_check
+    CHECK (status IN ('pending', 'confirmed', 'seated', 'completed', 'cancelled', 'no_show'));
+ALTER TABLE bookings DROP COLUMN IF EXISTS expired_at;
@@ -0,0 +1,27 @@
+-- Статус expired: неподтвержденное бронирование, закрытое планировщиком по сроку
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS expired_at TIMESTAMPTZ;
+ALTER TABLE bookings DROP CONSTRAINT IF EXISTS bookings_status_check;
+ALTER TABLE bookings ADD CONSTRAINT bookings_status_check
+    CHECK (status IN ('pending', 'confirmed', 'seated', 'completed', 'cancelled', 'no_show', 'expired'));
+
+-- Плановые уведомления, уже поставленные в очередь: каждое отправляется по бронированию один раз
+CREATE TABLE IF NOT EXISTS booking_notices (
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    notice VARCHAR(20) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (booking_id, notice)
+);
+
+-- История запусков фоновых заданий
+CREATE TABLE IF NOT EXISTS job_runs (
+    id SERIAL PRIMARY KEY,
+    job VARCHAR(50) NOT NULL,
+    instance VARCHAR(100) NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('ok', 'failed')),
+    processed INTEGER NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_started ON job_runs(started_at);
@@ -0,0 +1,5 @@
+DELETE FROM notification_outbox WHERE booking_id IS NULL;
+ALTER TABLE notification_outbox DROP COLUMN IF EXISTS waitlist_id;
+ALTER TABLE notification_outbox ALTER COLUMN booking_id SET NOT NULL;
+
+DROP TABLE IF EXISTS waitlist_entries;
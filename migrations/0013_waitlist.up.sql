@@ -0,0 +1,31 @@
+-- Лист ожидания: гость ждет столик на дату в окне времени начала визита [window_start, window_end].
+-- Когда место освобождается, ближайшей подходящей заявке отправляется ссылка, действующая до offer_expires_at.
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    phone VARCHAR(20) NOT NULL,
+    email VARCHAR(254) NOT NULL DEFAULT '',
+    booking_date DATE NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    guests INTEGER NOT NULL,
+    comments TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'offered', 'claimed', 'expired', 'cancelled')),
+    offered_start TIMESTAMPTZ,
+    offer_expires_at TIMESTAMPTZ,
+    claim_token_hash CHAR(64),
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT waitlist_window_check CHECK (window_end >= window_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_waitlist_date ON waitlist_entries(booking_date, status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_claim_token ON waitlist_entries(claim_token_hash);
+-- Один телефон — одна действующая заявка на дату
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_phone_date_active ON waitlist_entries(phone, booking_date)
+    WHERE status IN ('waiting', 'offered');
+
+-- Уведомления о заявке в листе ожидания не относятся к бронированию
+ALTER TABLE notification_outbox ALTER COLUMN booking_id DROP NOT NULL;
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS waitlist_id INTEGER REFERENCES waitlist_entries(id) ON DELETE CASCADE;
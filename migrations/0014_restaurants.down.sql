@@ -0,0 +1,35 @@
+-- Схема с одним рестораном: данные остальных ресторанов удаляются. Остается ресторан 'main',
+-- а если миграция не создавала его (база заведена с нуля) — ресторан с наименьшим ID
+DROP TABLE IF EXISTS user_restaurants;
+
+DELETE FROM waitlist_entries WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM bookings WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM restaurant_tables WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM opening_hours WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM schedule_overrides WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM holidays WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM blackouts WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+
+DROP INDEX IF EXISTS idx_waitlist_date;
+CREATE INDEX idx_waitlist_date ON waitlist_entries(booking_date, status);
+DROP INDEX IF EXISTS idx_waitlist_phone_date_active;
+CREATE UNIQUE INDEX idx_waitlist_phone_date_active ON waitlist_entries(phone, booking_date)
+    WHERE status IN ('waiting', 'offered');
+
+DROP INDEX IF EXISTS idx_bookings_restaurant_starts_at;
+DROP INDEX IF EXISTS idx_bookings_phone_date_active;
+CREATE UNIQUE INDEX idx_bookings_phone_date_active ON bookings(phone, booking_date)
+    WHERE status IN ('pending', 'confirmed', 'seated');
+
+ALTER TABLE restaurant_tables DROP CONSTRAINT IF EXISTS restaurant_tables_number_key;
+ALTER TABLE restaurant_tables ADD CONSTRAINT restaurant_tables_number_key UNIQUE (number);
+
+ALTER TABLE waitlist_entries DROP COLUMN restaurant_id;
+ALTER TABLE blackouts DROP COLUMN restaurant_id;
+ALTER TABLE holidays DROP COLUMN restaurant_id;
+ALTER TABLE schedule_overrides DROP COLUMN restaurant_id;
+ALTER TABLE opening_hours DROP COLUMN restaurant_id;
+ALTER TABLE restaurant_tables DROP COLUMN restaurant_id;
+ALTER TABLE bookings DROP COLUMN restaurant_id;
+
+DROP TABLE IF EXISTS restaurants;
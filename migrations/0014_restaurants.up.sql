@@ -0,0 +1,77 @@
+-- Рестораны сети: у каждого свои столики, расписание, правила бронирования и оформление страницы.
+-- Все существующие данные и сотрудники переходят к ресторану main.
+CREATE TABLE IF NOT EXISTS restaurants (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    address VARCHAR(200) NOT NULL DEFAULT '',
+    phone VARCHAR(20) NOT NULL DEFAULT '',
+    tagline VARCHAR(200) NOT NULL DEFAULT '',
+    logo_url VARCHAR(500) NOT NULL DEFAULT '',
+    accent_color VARCHAR(7) NOT NULL DEFAULT '#8d7762',
+    dining_minutes INTEGER NOT NULL DEFAULT 120 CHECK (dining_minutes > 0),
+    slot_minutes INTEGER NOT NULL DEFAULT 30 CHECK (slot_minutes > 0),
+    max_guests INTEGER NOT NULL DEFAULT 8 CHECK (max_guests > 0),
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Ресторан main заводится только для уже работающей установки, чтобы было к чему привязать ее данные.
+-- В новой базе первый ресторан создает сервер при запуске по настройкам default_restaurant и т.д.
+INSERT INTO restaurants (slug, name, tagline)
+SELECT 'main', 'La Bella Vita', 'Ресторан с итальянской душой'
+WHERE EXISTS (SELECT 1 FROM bookings) OR EXISTS (SELECT 1 FROM restaurant_tables)
+    OR EXISTS (SELECT 1 FROM opening_hours) OR EXISTS (SELECT 1 FROM users);
+
+ALTER TABLE bookings ADD COLUMN restaurant_id INTEGER REFERENCES restaurants(id);
+UPDATE bookings SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+ALTER TABLE bookings ALTER COLUMN restaurant_id SET NOT NULL;
+
+ALTER TABLE restaurant_tables ADD COLUMN restaurant_id INTEGER REFERENCES restaurants(id);
+UPDATE restaurant_tables SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+ALTER TABLE restaurant_tables ALTER COLUMN restaurant_id SET NOT NULL;
+
+ALTER TABLE opening_hours ADD COLUMN restaurant_id INTEGER REFERENCES restaurants(id);
+UPDATE opening_hours SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+ALTER TABLE opening_hours ALTER COLUMN restaurant_id SET NOT NULL;
+
+ALTER TABLE schedule_overrides ADD COLUMN restaurant_id INTEGER REFERENCES restaurants(id);
+UPDATE schedule_overrides SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+ALTER TABLE schedule_overrides ALTER COLUMN restaurant_id SET NOT NULL;
+
+ALTER TABLE holidays ADD COLUMN restaurant_id INTEGER REFERENCES restaurants(id);
+UPDATE holidays SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+ALTER TABLE holidays ALTER COLUMN restaurant_id SET NOT NULL;
+
+ALTER TABLE blackouts ADD COLUMN restaurant_id INTEGER REFERENCES restaurants(id);
+UPDATE blackouts SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+ALTER TABLE blackouts ALTER COLUMN restaurant_id SET NOT NULL;
+
+ALTER TABLE waitlist_entries ADD COLUMN restaurant_id INTEGER REFERENCES restaurants(id);
+UPDATE waitlist_entries SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+ALTER TABLE waitlist_entries ALTER COLUMN restaurant_id SET NOT NULL;
+
+-- Номера столиков и правило «один телефон — одно активное бронирование на дату» действуют внутри ресторана
+ALTER TABLE restaurant_tables DROP CONSTRAINT IF EXISTS restaurant_tables_number_key;
+ALTER TABLE restaurant_tables ADD CONSTRAINT restaurant_tables_number_key UNIQUE (restaurant_id, number);
+
+DROP INDEX IF EXISTS idx_bookings_phone_date_active;
+CREATE UNIQUE INDEX idx_bookings_phone_date_active ON bookings(restaurant_id, phone, booking_date)
+    WHERE status IN ('pending', 'confirmed', 'seated');
+CREATE INDEX IF NOT EXISTS idx_bookings_restaurant_starts_at ON bookings(restaurant_id, starts_at);
+
+DROP INDEX IF EXISTS idx_waitlist_phone_date_active;
+CREATE UNIQUE INDEX idx_waitlist_phone_date_active ON waitlist_entries(restaurant_id, phone, booking_date)
+    WHERE status IN ('waiting', 'offered');
+DROP INDEX IF EXISTS idx_waitlist_date;
+CREATE INDEX idx_waitlist_date ON waitlist_entries(restaurant_id, booking_date, status);
+
+-- Рестораны, в которых работает сотрудник. Владельцы видят все рестораны без привязки.
+CREATE TABLE IF NOT EXISTS user_restaurants (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, restaurant_id)
+);
+
+INSERT INTO user_restaurants (user_id, restaurant_id)
+SELECT u.id, r.id FROM users u CROSS JOIN restaurants r;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_bookings_restaurant_guests;
+DROP INDEX IF EXISTS idx_bookings_restaurant_created_at;
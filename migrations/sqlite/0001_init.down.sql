@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS booking_events;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS blackouts;
+DROP TABLE IF EXISTS holidays;
+DROP TABLE IF EXISTS schedule_overrides;
+DROP TABLE IF EXISTS opening_hours;
+DROP TABLE IF EXISTS booking_tables;
+DROP TABLE IF EXISTS restaurant_tables;
+DROP TABLE IF EXISTS bookings;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,120 @@
+-- Схема SQLite для локального запуска и демонстраций.
+-- Соответствует миграциям PostgreSQL 0001–0009; следующие изменения схемы добавляются в оба набора с тем же номером.
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(50) UNIQUE NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    is_admin BOOLEAN DEFAULT false,
+    role VARCHAR(20) NOT NULL DEFAULT 'readonly'
+        CHECK (role IN ('owner', 'manager', 'host', 'readonly')),
+    disabled BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE bookings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    phone VARCHAR(20) NOT NULL,
+    booking_date VARCHAR(10) NOT NULL,
+    booking_time VARCHAR(5) NOT NULL,
+    guests INTEGER NOT NULL,
+    comments TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'confirmed', 'seated', 'completed', 'cancelled', 'no_show')),
+    duration_minutes INTEGER NOT NULL DEFAULT 120,
+    manage_token_hash CHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    confirmed_at TIMESTAMP,
+    seated_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    cancelled_at TIMESTAMP,
+    no_show_at TIMESTAMP
+);
+
+CREATE INDEX idx_bookings_date ON bookings(booking_date);
+CREATE INDEX idx_bookings_status ON bookings(status);
+CREATE UNIQUE INDEX idx_bookings_manage_token ON bookings(manage_token_hash);
+CREATE UNIQUE INDEX idx_bookings_phone_date_active ON bookings(phone, booking_date)
+    WHERE status IN ('pending', 'confirmed', 'seated');
+
+CREATE TABLE restaurant_tables (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    number INTEGER UNIQUE NOT NULL,
+    seats INTEGER NOT NULL,
+    min_party INTEGER NOT NULL DEFAULT 1,
+    max_party INTEGER NOT NULL,
+    zone VARCHAR(50) NOT NULL DEFAULT '',
+    combinable BOOLEAN NOT NULL DEFAULT false,
+    active BOOLEAN NOT NULL DEFAULT true
+);
+
+CREATE TABLE booking_tables (
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    table_id INTEGER NOT NULL REFERENCES restaurant_tables(id),
+    PRIMARY KEY (booking_id, table_id)
+);
+
+CREATE INDEX idx_booking_tables_table ON booking_tables(table_id);
+
+CREATE TABLE opening_hours (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    name VARCHAR(50) NOT NULL DEFAULT '',
+    open_time VARCHAR(5) NOT NULL,
+    close_time VARCHAR(5) NOT NULL
+);
+
+CREATE TABLE schedule_overrides (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    override_date VARCHAR(10) NOT NULL,
+    name VARCHAR(50) NOT NULL DEFAULT '',
+    open_time VARCHAR(5) NOT NULL,
+    close_time VARCHAR(5) NOT NULL
+);
+
+CREATE TABLE holidays (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    holiday_date VARCHAR(10) NOT NULL,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    recurring BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE TABLE blackouts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason VARCHAR(200) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_opening_hours_weekday ON opening_hours(weekday);
+CREATE INDEX idx_schedule_overrides_date ON schedule_overrides(override_date);
+CREATE INDEX idx_blackouts_range ON blackouts(starts_at, ends_at);
+
+CREATE TABLE sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+CREATE INDEX idx_sessions_expires ON sessions(expires_at);
+
+CREATE TABLE booking_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL,
+    actor VARCHAR(10) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    channel VARCHAR(20) NOT NULL,
+    ip VARCHAR(45),
+    old_values TEXT,
+    new_values TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_booking_events_booking ON booking_events(booking_id, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_bookings_starts_at;
+ALTER TABLE bookings DROP COLUMN ends_at;
+ALTER TABLE bookings DROP COLUMN starts_at;
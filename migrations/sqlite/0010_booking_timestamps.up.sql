@@ -0,0 +1,8 @@
+-- Момент начала и окончания визита. Хранится в UTC строкой вида 'YYYY-MM-DD HH:MM:SSZ',
+-- поэтому сравнение строк совпадает со сравнением времени.
+-- Существующие бронирования записаны по местному времени ресторана: колонки заполняет
+-- шаг миграции на Go (backfillBookingTimesSQLite) по часовому поясу из конфигурации.
+ALTER TABLE bookings ADD COLUMN starts_at TIMESTAMP;
+ALTER TABLE bookings ADD COLUMN ends_at TIMESTAMP;
+
+CREATE INDEX idx_bookings_starts_at ON bookings(starts_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS notification_outbox;
+ALTER TABLE bookings DROP COLUMN email;
@@ -0,0 +1,22 @@
+-- Адрес электронной почты гостя для уведомлений; необязателен
+ALTER TABLE bookings ADD COLUMN email VARCHAR(254) NOT NULL DEFAULT '';
+
+-- Очередь исходящих уведомлений; send_after и locked_until хранятся в UTC, как starts_at
+CREATE TABLE notification_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    channel VARCHAR(10) NOT NULL,
+    recipient VARCHAR(254) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    send_after TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_notification_outbox_pending ON notification_outbox(send_after) WHERE status = 'pending';
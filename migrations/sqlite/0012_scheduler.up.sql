@@ -0,0 +1,63 @@
+-- Статус expired: неподтвержденное бронирование, закрытое планировщиком по сроку.
+-- SQLite не умеет менять CHECK, поэтому таблица бронирований пересоздается;
+-- внешние ключи на время миграций отключены, связанные строки сохраняются.
+CREATE TABLE bookings_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    phone VARCHAR(20) NOT NULL,
+    email VARCHAR(254) NOT NULL DEFAULT '',
+    booking_date VARCHAR(10) NOT NULL,
+    booking_time VARCHAR(5) NOT NULL,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    guests INTEGER NOT NULL,
+    comments TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'confirmed', 'seated', 'completed', 'cancelled', 'no_show', 'expired')),
+    duration_minutes INTEGER NOT NULL DEFAULT 120,
+    manage_token_hash CHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    confirmed_at TIMESTAMP,
+    seated_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    cancelled_at TIMESTAMP,
+    no_show_at TIMESTAMP,
+    expired_at TIMESTAMP
+);
+
+INSERT INTO bookings_new (id, name, phone, booking_date, booking_time, guests, comments, status, duration_minutes, manage_token_hash, created_at, updated_at, confirmed_at, seated_at, completed_at, cancelled_at, no_show_at, starts_at, ends_at, email)
+SELECT id, name, phone, booking_date, booking_time, guests, comments, status, duration_minutes, manage_token_hash, created_at, updated_at, confirmed_at, seated_at, completed_at, cancelled_at, no_show_at, starts_at, ends_at, email
+FROM bookings;
+
+DROP TABLE bookings;
+ALTER TABLE bookings_new RENAME TO bookings;
+
+CREATE INDEX idx_bookings_date ON bookings(booking_date);
+CREATE INDEX idx_bookings_status ON bookings(status);
+CREATE INDEX idx_bookings_starts_at ON bookings(starts_at);
+CREATE UNIQUE INDEX idx_bookings_manage_token ON bookings(manage_token_hash);
+CREATE UNIQUE INDEX idx_bookings_phone_date_active ON bookings(phone, booking_date)
+    WHERE status IN ('pending', 'confirmed', 'seated');
+
+-- Плановые уведомления, уже поставленные в очередь: каждое отправляется по бронированию один раз
+CREATE TABLE booking_notices (
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    notice VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (booking_id, notice)
+);
+
+-- История запусков фоновых заданий
+CREATE TABLE job_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job VARCHAR(50) NOT NULL,
+    instance VARCHAR(100) NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('ok', 'failed')),
+    processed INTEGER NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+CREATE INDEX idx_job_runs_started ON job_runs(started_at);
@@ -0,0 +1,28 @@
+CREATE TABLE notification_outbox_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    channel VARCHAR(10) NOT NULL,
+    recipient VARCHAR(254) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    send_after TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+INSERT INTO notification_outbox_new (id, booking_id, kind, channel, recipient, subject, body, status, attempts, last_error, send_after, locked_until, created_at, sent_at)
+SELECT id, booking_id, kind, channel, recipient, subject, body, status, attempts, last_error, send_after, locked_until, created_at, sent_at
+FROM notification_outbox
+WHERE booking_id IS NOT NULL;
+
+DROP TABLE notification_outbox;
+ALTER TABLE notification_outbox_new RENAME TO notification_outbox;
+
+CREATE INDEX idx_notification_outbox_pending ON notification_outbox(send_after) WHERE status = 'pending';
+
+DROP TABLE IF EXISTS waitlist_entries;
@@ -0,0 +1,56 @@
+-- Лист ожидания: гость ждет столик на дату в окне времени начала визита [window_start, window_end].
+-- Когда место освобождается, ближайшей подходящей заявке отправляется ссылка, действующая до offer_expires_at.
+CREATE TABLE waitlist_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    phone VARCHAR(20) NOT NULL,
+    email VARCHAR(254) NOT NULL DEFAULT '',
+    booking_date VARCHAR(10) NOT NULL,
+    window_start TIMESTAMP NOT NULL,
+    window_end TIMESTAMP NOT NULL,
+    guests INTEGER NOT NULL,
+    comments TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting'
+        CHECK (status IN ('waiting', 'offered', 'claimed', 'expired', 'cancelled')),
+    offered_start TIMESTAMP,
+    offer_expires_at TIMESTAMP,
+    claim_token_hash CHAR(64),
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (window_end >= window_start)
+);
+
+CREATE INDEX idx_waitlist_date ON waitlist_entries(booking_date, status);
+CREATE UNIQUE INDEX idx_waitlist_claim_token ON waitlist_entries(claim_token_hash);
+-- Один телефон — одна действующая заявка на дату
+CREATE UNIQUE INDEX idx_waitlist_phone_date_active ON waitlist_entries(phone, booking_date)
+    WHERE status IN ('waiting', 'offered');
+
+-- Уведомления о заявке в листе ожидания не относятся к бронированию;
+-- SQLite не снимает NOT NULL, поэтому очередь пересоздается
+CREATE TABLE notification_outbox_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE CASCADE,
+    waitlist_id INTEGER REFERENCES waitlist_entries(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    channel VARCHAR(10) NOT NULL,
+    recipient VARCHAR(254) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    send_after TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+INSERT INTO notification_outbox_new (id, booking_id, kind, channel, recipient, subject, body, status, attempts, last_error, send_after, locked_until, created_at, sent_at)
+SELECT id, booking_id, kind, channel, recipient, subject, body, status, attempts, last_error, send_after, locked_until, created_at, sent_at
+FROM notification_outbox;
+
+DROP TABLE notification_outbox;
+ALTER TABLE notification_outbox_new RENAME TO notification_outbox;
+
+CREATE INDEX idx_notification_outbox_pending ON notification_outbox(send_after) WHERE status = 'pending';
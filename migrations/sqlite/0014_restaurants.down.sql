@@ -0,0 +1,68 @@
+-- Схема с одним рестораном: данные остальных ресторанов удаляются. Остается ресторан 'main',
+-- а если миграция не создавала его (база заведена с нуля) — ресторан с наименьшим ID
+DROP TABLE IF EXISTS user_restaurants;
+
+-- Внешние ключи на время миграций отключены, поэтому связанные строки удаляются явно
+DELETE FROM notification_outbox WHERE waitlist_id IN (
+    SELECT id FROM waitlist_entries WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants))
+);
+DELETE FROM notification_outbox WHERE booking_id IN (
+    SELECT id FROM bookings WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants))
+);
+DELETE FROM booking_notices WHERE booking_id IN (
+    SELECT id FROM bookings WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants))
+);
+DELETE FROM booking_events WHERE booking_id IN (
+    SELECT id FROM bookings WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants))
+);
+DELETE FROM booking_tables WHERE booking_id IN (
+    SELECT id FROM bookings WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants))
+);
+UPDATE waitlist_entries SET booking_id = NULL WHERE booking_id IN (
+    SELECT id FROM bookings WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants))
+);
+DELETE FROM waitlist_entries WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM bookings WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM restaurant_tables WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM opening_hours WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM schedule_overrides WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM holidays WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+DELETE FROM blackouts WHERE restaurant_id <> COALESCE((SELECT id FROM restaurants WHERE slug = 'main'), (SELECT MIN(id) FROM restaurants));
+
+DROP INDEX IF EXISTS idx_waitlist_date;
+CREATE INDEX idx_waitlist_date ON waitlist_entries(booking_date, status);
+DROP INDEX IF EXISTS idx_waitlist_phone_date_active;
+CREATE UNIQUE INDEX idx_waitlist_phone_date_active ON waitlist_entries(phone, booking_date)
+    WHERE status IN ('waiting', 'offered');
+
+DROP INDEX IF EXISTS idx_bookings_restaurant_starts_at;
+DROP INDEX IF EXISTS idx_bookings_phone_date_active;
+CREATE UNIQUE INDEX idx_bookings_phone_date_active ON bookings(phone, booking_date)
+    WHERE status IN ('pending', 'confirmed', 'seated');
+
+CREATE TABLE restaurant_tables_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    number INTEGER UNIQUE NOT NULL,
+    seats INTEGER NOT NULL,
+    min_party INTEGER NOT NULL DEFAULT 1,
+    max_party INTEGER NOT NULL,
+    zone VARCHAR(50) NOT NULL DEFAULT '',
+    combinable BOOLEAN NOT NULL DEFAULT false,
+    active BOOLEAN NOT NULL DEFAULT true
+);
+
+INSERT INTO restaurant_tables_new (id, number, seats, min_party, max_party, zone, combinable, active)
+SELECT id, number, seats, min_party, max_party, zone, combinable, active
+FROM restaurant_tables;
+
+DROP TABLE restaurant_tables;
+ALTER TABLE restaurant_tables_new RENAME TO restaurant_tables;
+
+ALTER TABLE waitlist_entries DROP COLUMN restaurant_id;
+ALTER TABLE blackouts DROP COLUMN restaurant_id;
+ALTER TABLE holidays DROP COLUMN restaurant_id;
+ALTER TABLE schedule_overrides DROP COLUMN restaurant_id;
+ALTER TABLE opening_hours DROP COLUMN restaurant_id;
+ALTER TABLE bookings DROP COLUMN restaurant_id;
+
+DROP TABLE IF EXISTS restaurants;
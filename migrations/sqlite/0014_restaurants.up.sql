@@ -0,0 +1,86 @@
+-- Рестораны сети: у каждого свои столики, расписание, правила бронирования и оформление страницы.
+-- Все существующие данные и сотрудники переходят к ресторану main.
+CREATE TABLE restaurants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    address VARCHAR(200) NOT NULL DEFAULT '',
+    phone VARCHAR(20) NOT NULL DEFAULT '',
+    tagline VARCHAR(200) NOT NULL DEFAULT '',
+    logo_url VARCHAR(500) NOT NULL DEFAULT '',
+    accent_color VARCHAR(7) NOT NULL DEFAULT '#8d7762',
+    dining_minutes INTEGER NOT NULL DEFAULT 120 CHECK (dining_minutes > 0),
+    slot_minutes INTEGER NOT NULL DEFAULT 30 CHECK (slot_minutes > 0),
+    max_guests INTEGER NOT NULL DEFAULT 8 CHECK (max_guests > 0),
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Ресторан main заводится только для уже работающей установки, чтобы было к чему привязать ее данные.
+-- В новой базе первый ресторан создает сервер при запуске по настройкам default_restaurant и т.д.
+INSERT INTO restaurants (slug, name, tagline)
+SELECT 'main', 'La Bella Vita', 'Ресторан с итальянской душой'
+WHERE EXISTS (SELECT 1 FROM bookings) OR EXISTS (SELECT 1 FROM restaurant_tables)
+    OR EXISTS (SELECT 1 FROM opening_hours) OR EXISTS (SELECT 1 FROM users);
+
+-- SQLite добавляет колонку NOT NULL только со значением по умолчанию; приложение всегда передает ресторан явно
+ALTER TABLE bookings ADD COLUMN restaurant_id INTEGER NOT NULL DEFAULT 0 REFERENCES restaurants(id);
+UPDATE bookings SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+
+ALTER TABLE opening_hours ADD COLUMN restaurant_id INTEGER NOT NULL DEFAULT 0 REFERENCES restaurants(id);
+UPDATE opening_hours SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+
+ALTER TABLE schedule_overrides ADD COLUMN restaurant_id INTEGER NOT NULL DEFAULT 0 REFERENCES restaurants(id);
+UPDATE schedule_overrides SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+
+ALTER TABLE holidays ADD COLUMN restaurant_id INTEGER NOT NULL DEFAULT 0 REFERENCES restaurants(id);
+UPDATE holidays SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+
+ALTER TABLE blackouts ADD COLUMN restaurant_id INTEGER NOT NULL DEFAULT 0 REFERENCES restaurants(id);
+UPDATE blackouts SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+
+ALTER TABLE waitlist_entries ADD COLUMN restaurant_id INTEGER NOT NULL DEFAULT 0 REFERENCES restaurants(id);
+UPDATE waitlist_entries SET restaurant_id = (SELECT id FROM restaurants WHERE slug = 'main');
+
+-- Номера столиков уникальны внутри ресторана; SQLite не меняет ограничения, поэтому таблица пересоздается
+CREATE TABLE restaurant_tables_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id),
+    number INTEGER NOT NULL,
+    seats INTEGER NOT NULL,
+    min_party INTEGER NOT NULL DEFAULT 1,
+    max_party INTEGER NOT NULL,
+    zone VARCHAR(50) NOT NULL DEFAULT '',
+    combinable BOOLEAN NOT NULL DEFAULT false,
+    active BOOLEAN NOT NULL DEFAULT true,
+    UNIQUE (restaurant_id, number)
+);
+
+INSERT INTO restaurant_tables_new (id, restaurant_id, number, seats, min_party, max_party, zone, combinable, active)
+SELECT id, (SELECT id FROM restaurants WHERE slug = 'main'), number, seats, min_party, max_party, zone, combinable, active
+FROM restaurant_tables;
+
+DROP TABLE restaurant_tables;
+ALTER TABLE restaurant_tables_new RENAME TO restaurant_tables;
+
+-- Правило «один телефон — одно активное бронирование на дату» действует внутри ресторана
+DROP INDEX IF EXISTS idx_bookings_phone_date_active;
+CREATE UNIQUE INDEX idx_bookings_phone_date_active ON bookings(restaurant_id, phone, booking_date)
+    WHERE status IN ('pending', 'confirmed', 'seated');
+CREATE INDEX idx_bookings_restaurant_starts_at ON bookings(restaurant_id, starts_at);
+
+DROP INDEX IF EXISTS idx_waitlist_phone_date_active;
+CREATE UNIQUE INDEX idx_waitlist_phone_date_active ON waitlist_entries(restaurant_id, phone, booking_date)
+    WHERE status IN ('waiting', 'offered');
+DROP INDEX IF EXISTS idx_waitlist_date;
+CREATE INDEX idx_waitlist_date ON waitlist_entries(restaurant_id, booking_date, status);
+
+-- Рестораны, в которых работает сотрудник. Владельцы видят все рестораны без привязки.
+CREATE TABLE user_restaurants (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    restaurant_id INTEGER NOT NULL REFERENCES restaurants(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, restaurant_id)
+);
+
+INSERT INTO user_restaurants (user_id, restaurant_id)
+SELECT u.id, r.id FROM users u CROSS JOIN restaurants r;
@@ -0,0 +1,3 @@
+-- Постраничный вывод бронирований по времени создания и размеру компании
+CREATE INDEX IF NOT EXISTS idx_bookings_restaurant_created_at ON bookings(restaurant_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_bookings_restaurant_guests ON bookings(restaurant_id, guests, id);
@@ -0,0 +1,4 @@
+ALTER TABLE notification_outbox DROP COLUMN calendar;
+DROP INDEX IF EXISTS idx_users_calendar_token;
+ALTER TABLE users DROP COLUMN calendar_token_hash;
+ALTER TABLE bookings DROP COLUMN revision;
@@ -0,0 +1,9 @@
+-- Номер версии бронирования для календарей (SEQUENCE в iCalendar): растет при каждом изменении
+ALTER TABLE bookings ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
+
+-- Хэш токена личной ссылки сотрудника на календарь бронирований (.ics)
+ALTER TABLE users ADD COLUMN calendar_token_hash CHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_calendar_token ON users(calendar_token_hash);
+
+-- Событие календаря, которое прикладывается к письму гостю
+ALTER TABLE notification_outbox ADD COLUMN calendar TEXT NOT NULL DEFAULT '';
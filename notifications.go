@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Виды уведомлений гостю
+const (
+	NotifyCreated   = "created"
+	NotifyConfirmed = "confirmed"
+	NotifyCancelled = "cancelled"
+	NotifyExpired   = "expired"
+	NotifyReminder  = "reminder"
+	NotifyFeedback  = "feedback"
+	// Предложение освободившегося места гостю из листа ожидания
+	NotifyWaitlistOffer = "waitlist_offer"
+)
+
+// Каналы доставки уведомлений
+const (
+	NotifyChannelEmail = "email"
+	NotifyChannelSMS   = "sms"
+)
+
+// Состояния записи в очереди уведомлений
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+const (
+	// Сколько уведомлений обработчик забирает из очереди за один проход
+	notifyBatchSize = 20
+	// На это время запись закрепляется за обработчиком, чтобы ее не отправил второй экземпляр сервера
+	notifyLease = 2 * time.Minute
+	// Ограничение на одну попытку отправки
+	notifySendTimeout = 30 * time.Second
+)
+
+// statusNotifications — о каких переходах статуса сообщаем гостю
+var statusNotifications = map[string]string{
+	StatusConfirmed: NotifyConfirmed,
+	StatusCancelled: NotifyCancelled,
+	StatusExpired:   NotifyExpired,
+}
+
+// calendarNotifications — к каким письмам прикладывается событие календаря. Событие с тем же UID
+// и большим SEQUENCE обновляет уже добавленное в календарь гостя, отмена помечает его отмененным.
+var calendarNotifications = map[string]bool{
+	NotifyCreated:   true,
+	NotifyConfirmed: true,
+	NotifyCancelled: true,
+	NotifyExpired:   true,
+}
+
+// Message — готовое к отправке сообщение. Subject и Calendar используются только в письмах:
+// Calendar — событие iCalendar, которое прикладывается к письму файлом booking.ics.
+type Message struct {
+	To       string
+	Subject  string
+	Body     string
+	Calendar string
+}
+
+// Notifier доставляет сообщение через один канал: почту, SMS или файл для разработки
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// notifiers — настроенные каналы доставки по названию канала; заполняется при запуске
+var notifiers = map[string]Notifier{}
+
+// Notification — уведомление в очереди на отправку. Относится к бронированию
+// или, если BookingID не задан, к заявке в листе ожидания WaitlistID.
+type Notification struct {
+	ID         int
+	BookingID  int
+	WaitlistID int
+	Kind       string
+	Channel    string
+	Message
+	Attempts int
+}
+
+// NotificationStore — очередь исходящих уведомлений.
+// Записи в нее добавляет само хранилище в той же транзакции, что и изменение бронирования.
+type NotificationStore interface {
+	// ClaimNotifications закрепляет за вызывающим до limit готовых к отправке уведомлений на время lease
+	ClaimNotifications(limit int, lease time.Duration) ([]Notification, error)
+	MarkNotificationSent(id int) error
+	// MarkNotificationFailed записывает неудачную попытку: повтор в retryAt или, если он nil, окончательный отказ
+	MarkNotificationFailed(id int, errMsg string, retryAt *time.Time) error
+}
+
+type notificationTemplate struct {
+	subject *template.Template
+	email   *template.Template
+	sms     *template.Template
+}
+
+func newNotificationTemplate(subject, email, sms string) notificationTemplate {
+	return notificationTemplate{
+		subject: template.Must(template.New("subject").Parse(subject)),
+		email:   template.Must(template.New("email").Parse(email)),
+		sms:     template.Must(template.New("sms").Parse(sms)),
+	}
+}
+
+var notificationTemplates = map[string]notificationTemplate{
+	NotifyCreated: newNotificationTemplate(
+		`Бронирование на {{.StartsAt.Format "02.01.2006"}} принято`,
+		`Здравствуйте, {{.Name}}!
+
+Мы получили ваше бронирование на {{.StartsAt.Format "02.01.2006"}} в {{.Time}}, гостей: {{.Guests}}.
+Мы сообщим, когда администратор его подтвердит.
+{{- if .ManageURL}}
+
+Посмотреть, изменить или отменить бронирование: {{.ManageURL}}
+{{- end}}
+
+{{.Venue}}`,
+		`{{.Venue}}: бронирование на {{.StartsAt.Format "02.01"}} {{.Time}}, гостей: {{.Guests}}, принято.{{if .ManageURL}} Управление: {{.ManageURL}}{{end}}`,
+	),
+	NotifyConfirmed: newNotificationTemplate(
+		`Бронирование на {{.StartsAt.Format "02.01.2006"}} подтверждено`,
+		`Здравствуйте, {{.Name}}!
+
+Ваше бронирование на {{.StartsAt.Format "02.01.2006"}} в {{.Time}}, гостей: {{.Guests}}, подтверждено.
+Ждем вас!
+
+{{.Venue}}`,
+		`{{.Venue}}: бронирование на {{.StartsAt.Format "02.01"}} {{.Time}}, гостей: {{.Guests}}, подтверждено. Ждем вас!`,
+	),
+	NotifyCancelled: newNotificationTemplate(
+		`Бронирование на {{.StartsAt.Format "02.01.2006"}} отменено`,
+		`Здравствуйте, {{.Name}}!
+
+Ваше бронирование на {{.StartsAt.Format "02.01.2006"}} в {{.Time}} отменено.
+Будем рады видеть вас в другой раз.
+
+{{.Venue}}`,
+		`{{.Venue}}: бронирование на {{.StartsAt.Format "02.01"}} {{.Time}} отменено.`,
+	),
+	NotifyExpired: newNotificationTemplate(
+		`Бронирование на {{.StartsAt.Format "02.01.2006"}} не подтверждено`,
+		`Здравствуйте, {{.Name}}!
+
+К сожалению, мы не успели подтвердить ваше бронирование на {{.StartsAt.Format "02.01.2006"}} в {{.Time}},
+и оно снято. Пожалуйста, забронируйте столик заново или позвоните нам.
+
+{{.Venue}}`,
+		`{{.Venue}}: бронирование на {{.StartsAt.Format "02.01"}} {{.Time}} не подтверждено и снято. Забронируйте заново или позвоните нам.`,
+	),
+	NotifyReminder: newNotificationTemplate(
+		`Напоминание: ждем вас {{.StartsAt.Format "02.01.2006"}} в {{.Time}}`,
+		`Здравствуйте, {{.Name}}!
+
+Напоминаем о бронировании на {{.StartsAt.Format "02.01.2006"}} в {{.Time}}, гостей: {{.Guests}}.
+Если планы изменились, пожалуйста, отмените бронирование заранее.
+
+{{.Venue}}`,
+		`{{.Venue}}: ждем вас {{.StartsAt.Format "02.01"}} в {{.Time}}, гостей: {{.Guests}}.`,
+	),
+	NotifyFeedback: newNotificationTemplate(
+		`Спасибо, что были у нас`,
+		`Здравствуйте, {{.Name}}!
+
+Спасибо, что посетили нас {{.StartsAt.Format "02.01.2006"}}.
+Нам важно ваше мнение: ответьте на это письмо и расскажите, что понравилось и что можно улучшить.
+
+{{.Venue}}`,
+		`{{.Venue}}: спасибо за визит! Будем рады вашему отзыву в ответном сообщении.`,
+	),
+	NotifyWaitlistOffer: newNotificationTemplate(
+		`Освободился столик {{.StartsAt.Format "02.01.2006"}} в {{.Time}}`,
+		`Здравствуйте, {{.Name}}!
+
+Освободился столик на {{.StartsAt.Format "02.01.2006"}} в {{.Time}}, гостей: {{.Guests}}.
+Чтобы забронировать его, перейдите по ссылке до {{.ExpiresAt.Format "15:04 02.01.2006"}}:
+{{.ClaimURL}}
+
+Позже предложение перейдет следующему гостю из листа ожидания.
+
+{{.Venue}}`,
+		`{{.Venue}}: освободился столик {{.StartsAt.Format "02.01"}} в {{.Time}} на {{.Guests}} чел. Забронируйте до {{.ExpiresAt.Format "15:04"}}: {{.ClaimURL}}`,
+	),
+}
+
+// notificationData — данные для шаблонов уведомлений
+type notificationData struct {
+	*Booking
+	// Ссылка управления; есть только в уведомлении о создании, пока токен известен
+	ManageURL string
+	// Ссылка и срок, чтобы принять предложение из листа ожидания
+	ClaimURL  string
+	ExpiresAt time.Time
+}
+
+// Venue — подпись уведомления: название ресторана бронирования
+func (d notificationData) Venue() string {
+	if d.Booking != nil && d.Booking.Restaurant != "" {
+		return d.Booking.Restaurant
+	}
+	return "DineBook"
+}
+
+func renderTemplate(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// notificationsFor готовит уведомление kind о бронировании для каждого настроенного канала,
+// у которого есть адрес получателя
+func notificationsFor(kind string, booking *Booking) ([]Notification, error) {
+	data := notificationData{Booking: booking}
+	if booking.ManageToken != "" {
+		data.ManageURL = siteURL("/manage/" + booking.ManageToken)
+	}
+	return renderNotifications(kind, data)
+}
+
+// siteURL — абсолютная ссылка на страницу сайта для уведомлений
+func siteURL(path string) string {
+	return strings.TrimRight(config.BaseURL, "/") + path
+}
+
+// renderNotifications готовит уведомление kind для каждого настроенного канала, у которого есть адрес
+// получателя; имя и контакты берутся из data.Booking
+func renderNotifications(kind string, data notificationData) ([]Notification, error) {
+	tmpl, ok := notificationTemplates[kind]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный вид уведомления: %s", kind)
+	}
+	booking := data.Booking
+
+	channels := make([]string, 0, len(notifiers))
+	for channel := range notifiers {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	var result []Notification
+	for _, channel := range channels {
+		n := Notification{BookingID: booking.ID, Kind: kind, Channel: channel}
+		var err error
+		switch channel {
+		case NotifyChannelEmail:
+			if booking.Email == "" {
+				continue
+			}
+			n.To = booking.Email
+			if n.Subject, err = renderTemplate(tmpl.subject, data); err == nil {
+				n.Body, err = renderTemplate(tmpl.email, data)
+			}
+			if calendarNotifications[kind] {
+				n.Calendar = icsCalendar{Method: icsMethodPublish, Events: []icsEvent{guestCalendarEvent(booking, data.ManageURL)}}.String()
+			}
+		case NotifyChannelSMS:
+			if booking.Phone == "" {
+				continue
+			}
+			n.To = "+" + booking.Phone
+			n.Body, err = renderTemplate(tmpl.sms, data)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка подготовки уведомления %s (%s): %v", kind, channel, err)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// enqueueNotifications ставит уведомления о бронировании в очередь; вызывается в транзакции изменения.
+// Ошибка шаблона не должна мешать бронированию, поэтому она только пишется в журнал.
+func enqueueNotifications(ex execer, kind string, booking *Booking) error {
+	batch, err := notificationsFor(kind, booking)
+	if err != nil {
+		slog.Error("Уведомление о бронировании не отправлено", "booking_id", booking.ID, "error", err)
+		return nil
+	}
+	return insertNotifications(ex, batch)
+}
+
+// nullableID — внешний ключ для запроса: NULL вместо нулевого ID
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func insertNotifications(ex execer, batch []Notification) error {
+	for _, n := range batch {
+		_, err := ex.Exec(`
+			INSERT INTO notification_outbox (booking_id, waitlist_id, kind, channel, recipient, subject, body, calendar, send_after)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, nullableID(n.BookingID), nullableID(n.WaitlistID), n.Kind, n.Channel, n.To, n.Subject, n.Body, n.Calendar, dbTime(time.Now()))
+		if err != nil {
+			return fmt.Errorf("ошибка постановки уведомления в очередь: %v", err)
+		}
+	}
+	return nil
+}
+
+func (db *Database) ClaimNotifications(limit int, lease time.Duration) ([]Notification, error) {
+	defer observeQuery("ClaimNotifications", time.Now())
+	now := time.Now()
+	rows, err := db.Query(`
+		SELECT id FROM notification_outbox
+		WHERE status = 'pending' AND send_after <= $1 AND (locked_until IS NULL OR locked_until <= $1)
+		ORDER BY send_after, id
+		LIMIT $2
+	`, dbTime(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении очереди уведомлений: %v", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Запись достается тому обработчику, чье обновление прошло первым
+	var claimed []Notification
+	for _, id := range ids {
+		var n Notification
+		err := db.QueryRow(`
+			UPDATE notification_outbox SET locked_until = $1
+			WHERE id = $2 AND status = 'pending' AND (locked_until IS NULL OR locked_until <= $3)
+			RETURNING id, COALESCE(booking_id, 0), COALESCE(waitlist_id, 0), kind, channel, recipient, subject, body, calendar, attempts
+		`, dbTime(now.Add(lease)), id, dbTime(now)).Scan(
+			&n.ID, &n.BookingID, &n.WaitlistID, &n.Kind, &n.Channel, &n.To, &n.Subject, &n.Body, &n.Calendar, &n.Attempts)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return claimed, fmt.Errorf("ошибка при захвате уведомления %d: %v", id, err)
+		}
+		claimed = append(claimed, n)
+	}
+	return claimed, nil
+}
+
+func (db *Database) MarkNotificationSent(id int) error {
+	defer observeQuery("MarkNotificationSent", time.Now())
+	_, err := db.Exec(`
+		UPDATE notification_outbox
+		SET status = 'sent', attempts = attempts + 1, last_error = NULL, locked_until = NULL, sent_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+func (db *Database) MarkNotificationFailed(id int, errMsg string, retryAt *time.Time) error {
+	defer observeQuery("MarkNotificationFailed", time.Now())
+	if retryAt != nil {
+		_, err := db.Exec(`
+			UPDATE notification_outbox
+			SET attempts = attempts + 1, last_error = $1, send_after = $2, locked_until = NULL
+			WHERE id = $3
+		`, errMsg, dbTime(*retryAt), id)
+		return err
+	}
+	_, err := db.Exec(`
+		UPDATE notification_outbox
+		SET status = 'failed', attempts = attempts + 1, last_error = $1, locked_until = NULL
+		WHERE id = $2
+	`, errMsg, id)
+	return err
+}
+
+// notificationBackoff — пауза перед повтором после attempts неудачных попыток: 1, 2, 4... минут, не больше часа
+func notificationBackoff(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// deliverNotifications отправляет одну порцию уведомлений из очереди
+func deliverNotifications(ctx context.Context) {
+	batch, err := db.ClaimNotifications(notifyBatchSize, notifyLease)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка очереди уведомлений", "error", err)
+	}
+	for _, n := range batch {
+		var sendErr error
+		if notifier, ok := notifiers[n.Channel]; ok {
+			sendCtx, cancel := context.WithTimeout(ctx, notifySendTimeout)
+			sendErr = notifier.Send(sendCtx, n.Message)
+			cancel()
+		} else {
+			sendErr = fmt.Errorf("канал %s не настроен", n.Channel)
+		}
+
+		if sendErr == nil {
+			if err := db.MarkNotificationSent(n.ID); err != nil {
+				slog.ErrorContext(ctx, "Ошибка при отметке уведомления", "notification_id", n.ID, "error", err)
+			}
+			continue
+		}
+
+		attempts := n.Attempts + 1
+		var retryAt *time.Time
+		if attempts < config.NotifyMaxAttempts {
+			at := time.Now().Add(notificationBackoff(attempts))
+			retryAt = &at
+			slog.WarnContext(ctx, "Не удалось отправить уведомление", "notification_id", n.ID, "channel", n.Channel, "attempt", attempts, "error", sendErr)
+		} else {
+			slog.ErrorContext(ctx, "Уведомление не доставлено", "notification_id", n.ID, "channel", n.Channel, "attempts", attempts, "error", sendErr)
+		}
+		if err := db.MarkNotificationFailed(n.ID, sendErr.Error(), retryAt); err != nil {
+			slog.ErrorContext(ctx, "Ошибка при отметке уведомления", "notification_id", n.ID, "error", err)
+		}
+	}
+}
+
+// runNotificationOutbox в фоне отправляет уведомления из очереди, пока не отменен ctx
+func runNotificationOutbox(ctx context.Context) {
+	ticker := time.NewTicker(config.NotifyPollInterval)
+	defer ticker.Stop()
+	for {
+		// Начатая пачка доотправляется и при остановке сервера, чтобы не оставлять сообщения под арендой
+		deliverNotifications(context.WithoutCancel(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTPNotifier отправляет письма через SMTP-сервер
+type SMTPNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	// From может содержать имя отправителя, в конверте письма нужен только адрес
+	sender, err := mail.ParseAddress(n.From)
+	if err != nil {
+		return fmt.Errorf("неверный адрес отправителя %q: %v", n.From, err)
+	}
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	if msg.Calendar == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+		buf.WriteString(mailText(msg.Body))
+	} else {
+		// Текст письма и событие календаря — части multipart/mixed
+		parts := multipart.NewWriter(&buf)
+		fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", parts.Boundary())
+		text, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		io.WriteString(text, mailText(msg.Body))
+		calendar, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {`text/calendar; charset=utf-8; method=PUBLISH; name="booking.ics"`},
+			"Content-Disposition":       {`attachment; filename="booking.ics"`},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		writeBase64Lines(calendar, []byte(msg.Calendar))
+		parts.Close()
+	}
+
+	// smtp.SendMail не принимает контекст, поэтому ждем его результата не дольше ctx
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(n.Host, n.Port), auth, sender.Address, []string{msg.To}, buf.Bytes())
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("ошибка отправки письма: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mailText — текст письма с переводами строк CRLF
+func mailText(body string) string {
+	return strings.ReplaceAll(body, "\n", "\r\n") + "\r\n"
+}
+
+// writeBase64Lines кодирует вложение в base64 строками по 76 символов, как требует MIME
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+// SMSGateway — провайдер рассылки SMS
+type SMSGateway interface {
+	SendSMS(ctx context.Context, phone, text string) error
+}
+
+// HTTPSMSGateway отправляет SMS через HTTP API провайдера: POST на URL с JSON {"to", "from", "text"}
+// и токеном в заголовке Authorization. Любой ответ, кроме 2xx, считается ошибкой.
+type HTTPSMSGateway struct {
+	URL    string
+	Token  string
+	Sender string
+	Client *http.Client
+}
+
+func (g *HTTPSMSGateway) SendSMS(ctx context.Context, phone, text string) error {
+	payload, err := json.Marshal(map[string]string{"to": phone, "from": g.Sender, "text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к SMS-шлюзу: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SMS-шлюз ответил %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// SMSNotifier отправляет уведомления по SMS через шлюз
+type SMSNotifier struct {
+	Gateway SMSGateway
+}
+
+func (n *SMSNotifier) Send(ctx context.Context, msg Message) error {
+	return n.Gateway.SendSMS(ctx, msg.To, msg.Body)
+}
+
+// FileNotifier — канал для разработки: вместо отправки дописывает сообщения в файл,
+// а если путь не задан, выводит их в журнал сервера
+type FileNotifier struct {
+	Channel string
+	Path    string
+}
+
+// Почта и SMS для разработки обычно пишут в один файл
+var notifyFileMu sync.Mutex
+
+func (n *FileNotifier) Send(ctx context.Context, msg Message) error {
+	if n.Path == "" {
+		// Адресат пишется под ключом phone или email, чтобы журнал его замаскировал.
+		// В тексте есть имя гостя и ссылка управления, поэтому он выводится только на уровне debug.
+		recipient := "email"
+		if n.Channel == NotifyChannelSMS {
+			recipient = "phone"
+		}
+		slog.InfoContext(ctx, "Уведомление", "channel", n.Channel, recipient, msg.To, "subject", msg.Subject)
+		slog.DebugContext(ctx, "Текст уведомления", "channel", n.Channel, "body", msg.Body)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "=== %s %s -> %s\n", time.Now().In(config.Location).Format("2006-01-02 15:04:05"), n.Channel, msg.To)
+	if msg.Subject != "" {
+		fmt.Fprintf(&buf, "Тема: %s\n", msg.Subject)
+	}
+	buf.WriteString(msg.Body)
+	if msg.Calendar != "" {
+		buf.WriteString("\n\nВложение booking.ics:\n")
+		buf.WriteString(strings.ReplaceAll(msg.Calendar, "\r\n", "\n"))
+	}
+	buf.WriteString("\n\n")
+
+	notifyFileMu.Lock()
+	defer notifyFileMu.Unlock()
+	f, err := os.OpenFile(n.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newNotifiers создает каналы уведомлений, выбранные в конфигурации
+func newNotifiers(c *Config) (map[string]Notifier, error) {
+	result := make(map[string]Notifier)
+
+	switch c.NotifyEmail {
+	case "":
+	case "smtp":
+		if c.SMTPHost == "" || c.SMTPFrom == "" {
+			return nil, fmt.Errorf("для отправки писем нужны SMTPHost и SMTPFrom")
+		}
+		result[NotifyChannelEmail] = &SMTPNotifier{
+			Host:     c.SMTPHost,
+			Port:     c.SMTPPort,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			From:     c.SMTPFrom,
+		}
+	case "log":
+		result[NotifyChannelEmail] = &FileNotifier{Channel: NotifyChannelEmail, Path: c.NotifyLogPath}
+	default:
+		return nil, fmt.Errorf("неизвестный канал писем: %s (ожидается smtp, log или пусто)", c.NotifyEmail)
+	}
+
+	switch c.NotifySMS {
+	case "":
+	case "http":
+		if c.SMSGatewayURL == "" {
+			return nil, fmt.Errorf("для отправки SMS нужен SMSGatewayURL")
+		}
+		result[NotifyChannelSMS] = &SMSNotifier{Gateway: &HTTPSMSGateway{
+			URL:    c.SMSGatewayURL,
+			Token:  c.SMSGatewayToken,
+			Sender: c.SMSSender,
+			Client: &http.Client{Timeout: notifySendTimeout},
+		}}
+	case "log":
+		result[NotifyChannelSMS] = &FileNotifier{Channel: NotifyChannelSMS, Path: c.NotifyLogPath}
+	default:
+		return nil, fmt.Errorf("неизвестный канал SMS: %s (ожидается http, log или пусто)", c.NotifySMS)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,794 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Описание API в формате OpenAPI 3 собирается из таблицы apiOperations: схемы тел запросов
+// и ответов строятся по Go-типам, которые разбирают и отдают обработчики, а ограничения
+// берутся из тегов schema:"required,format=date,enum=status,min=1,max=6". По тому же описанию
+// openAPIValidationMiddleware проверяет JSON в запросах, а checkOpenAPIRoutes при запуске
+// сверяет таблицу с маршрутами роутера.
+
+// maxRequestBody — предельный размер JSON в запросе
+const maxRequestBody = 1 << 20
+
+// openAPISchema — схема значения в подмножестве OpenAPI 3.0, которое понимает проверка запросов
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Minimum              *int                      `json:"minimum,omitempty"`
+	Maximum              *int                      `json:"maximum,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*openAPISchema          `json:"anyOf,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaFormats — форматы строк из тега schema: формат OpenAPI и шаблон для проверки
+var schemaFormats = map[string]struct{ format, pattern string }{
+	"date":           {"date", `^\d{4}-\d{2}-\d{2}$`},
+	"time":           {"", `^\d{2}:\d{2}(:\d{2})?$`},
+	"datetime-local": {"", `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}$`},
+	"integer":        {"", `^\d+$`},
+}
+
+// schemaEnums — допустимые значения для enum=... в теге schema
+var schemaEnums = map[string]func() []string{
+	"status":  func() []string { return sortedKeys(bookingTransitions) },
+	"channel": func() []string { return []string{ChannelAdmin, ChannelAPI, ChannelSystem, ChannelWeb} },
+	"role": func() []string {
+		roles := make([]string, 0, len(rolePermissions))
+		for role := range rolePermissions {
+			roles = append(roles, string(role))
+		}
+		sort.Strings(roles)
+		return roles
+	},
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// apiParam — параметр строки запроса
+type apiParam struct {
+	Name        string
+	Type        string // string, integer
+	Format      string // ключ schemaFormats
+	Required    bool
+	Description string
+}
+
+// apiField оборачивает ответ в объект с одним полем: {"bookings": [...]}
+type apiField struct {
+	Name  string
+	Value interface{}
+}
+
+// apiAnyOf — тело, которое подходит под одну из схем (например, зависит от параметра пути)
+type apiAnyOf []interface{}
+
+// apiOperation — метод и шаблон маршрута gorilla/mux с описанием запроса и ответа
+type apiOperation struct {
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+	// Staff — нужна сессия сотрудника; в /api/v1 — cookie или Authorization: Bearer, в /admin — cookie
+	Staff  bool
+	Query  []apiParam
+	Body   interface{} // значение типа тела запроса; nil — запрос без тела
+	Status int         // код успешного ответа, по умолчанию 200
+	// Response — значение типа ответа; nil — ответ без тела
+	Response interface{}
+	// Produces — тип файла в ответе вместо JSON (выгрузка); Consumes — типы файла в теле запроса
+	// вместо JSON (загрузка). Файлы по схеме не проверяются.
+	Produces string
+	Consumes []string
+	// Conflicts — коды ошибок, с которыми операция отвечает 409
+	Conflicts []string
+}
+
+// apiMessage — ответ старых адресов со служебным сообщением: {"message": "Столик удален"}
+type apiMessage struct {
+	Message string `json:"message"`
+}
+
+var (
+	availabilityQuery = []apiParam{
+		{Name: "date", Type: "string", Format: "date", Required: true, Description: "Дата визита"},
+		{Name: "guests", Type: "integer", Required: true, Description: "Количество гостей"},
+		{Name: "token", Type: "string", Description: "Токен ссылки управления: столики переносимого бронирования считаются свободными"},
+	}
+	bookingsQuery = []apiParam{
+		{Name: "from", Type: "string", Format: "date", Description: "Визит не раньше даты"},
+		{Name: "to", Type: "string", Format: "date", Description: "Визит не позже даты"},
+		{Name: "date", Type: "string", Format: "date", Description: "Визит в этот день (from и to одновременно)"},
+		{Name: "created_from", Type: "string", Format: "date", Description: "Создано не раньше даты"},
+		{Name: "created_to", Type: "string", Format: "date", Description: "Создано не позже даты"},
+		{Name: "status", Type: "string", Description: "Статусы через запятую: pending,confirmed"},
+		{Name: "guests_min", Type: "integer", Description: "Гостей не меньше"},
+		{Name: "guests_max", Type: "integer", Description: "Гостей не больше"},
+		{Name: "q", Type: "string", Description: "Поиск по имени, телефону и комментарию"},
+		{Name: "phone", Type: "string", Description: "Часть номера телефона"},
+		{Name: "name", Type: "string", Description: "Часть имени гостя"},
+		{Name: "sort", Type: "string", Description: "starts_at, created_at, guests или name; с минусом — по убыванию. По умолчанию -starts_at"},
+		{Name: "limit", Type: "integer", Description: "Размер страницы, по умолчанию 50, не больше 200"},
+		{Name: "cursor", Type: "string", Description: "Курсор следующей страницы из next_cursor или заголовка Link"},
+	}
+	// Выгрузка берет те же фильтры, что и список, но без страниц
+	exportQuery = bookingsQuery[:len(bookingsQuery)-2]
+	importQuery = []apiParam{
+		{Name: "dry_run", Type: "integer", Description: "1 — проверить файл, ничего не сохраняя"},
+	}
+	waitlistQuery = []apiParam{
+		{Name: "date", Type: "string", Format: "date", Description: "Дата, по умолчанию сегодня"},
+	}
+	// Коды 409 при создании бронирования
+	bookingConflicts = []string{"duplicate_booking", "phone_name_mismatch", "no_table_available"}
+	scheduleBody     = apiAnyOf{OpeningPeriod{}, ScheduleOverride{}, Holiday{}, blackoutRequest{}}
+	scheduleItems    = apiAnyOf{OpeningPeriod{}, ScheduleOverride{}, Holiday{}, Blackout{}}
+)
+
+// apiOperations — все JSON-адреса сервера. Страницы админки отдают JSON, если клиент
+// просит его в заголовке Accept; HTML-страницы, вход через форму и служебные адреса
+// (/healthz, /metrics) сюда не входят.
+var apiOperations = []apiOperation{
+	// Сайт ресторана
+	{Method: "POST", Path: "/api/book", Tag: "Гости", Summary: "Забронировать столик в ресторане по умолчанию", Body: BookingRequest{}, Response: bookingCreated{}, Conflicts: bookingConflicts},
+	{Method: "GET", Path: "/api/availability", Tag: "Гости", Summary: "Свободное время в ресторане по умолчанию", Query: availabilityQuery, Response: availabilityResponse{}},
+	{Method: "POST", Path: "/api/waitlist", Tag: "Гости", Summary: "Встать в лист ожидания ресторана по умолчанию", Body: waitlistRequest{}, Status: http.StatusCreated, Response: waitlistJoined{}, Conflicts: []string{"duplicate_waitlist"}},
+	{Method: "POST", Path: "/r/{slug}/api/book", Tag: "Гости", Summary: "Забронировать столик", Body: BookingRequest{}, Response: bookingCreated{}, Conflicts: bookingConflicts},
+	{Method: "GET", Path: "/r/{slug}/api/availability", Tag: "Гости", Summary: "Свободное время", Query: availabilityQuery, Response: availabilityResponse{}},
+	{Method: "POST", Path: "/r/{slug}/api/waitlist", Tag: "Гости", Summary: "Встать в лист ожидания", Body: waitlistRequest{}, Status: http.StatusCreated, Response: waitlistJoined{}, Conflicts: []string{"duplicate_waitlist"}},
+	{Method: "GET", Path: "/api/manage/{token}", Tag: "Гости", Summary: "Бронирование по ссылке управления", Response: managedBookingView{}},
+	{Method: "PUT", Path: "/api/manage/{token}", Tag: "Гости", Summary: "Перенести бронирование по ссылке управления", Body: manageUpdateRequest{}, Response: bookingUpdated{}, Conflicts: []string{"not_modifiable", "duplicate_booking", "no_table_available", "status_changed"}},
+	{Method: "GET", Path: "/api/manage/{token}/calendar.ics", Tag: "Гости", Summary: "Событие бронирования для календаря (iCalendar)", Produces: "text/calendar"},
+	{Method: "PUT", Path: "/api/bookings/{id}/status", Tag: "Гости", Summary: "Отменить бронирование по токену ссылки управления или сменить статус из админки", Body: bookingStatusRequest{}, Response: apiMessage{}},
+	{Method: "POST", Path: "/api/waitlist/claim/{token}", Tag: "Гости", Summary: "Забрать освободившееся время из листа ожидания", Response: bookingCreated{}, Conflicts: bookingConflicts},
+
+	// API v1
+	{Method: "GET", Path: "/api/v1/restaurants", Tag: "API v1", Summary: "Рестораны, которые принимают бронирования", Response: apiField{"restaurants", []Restaurant{}}},
+	{Method: "GET", Path: "/api/v1/restaurants/{slug}/availability", Tag: "API v1", Summary: "Свободное время", Query: availabilityQuery, Response: availabilityResponse{}},
+	{Method: "POST", Path: "/api/v1/restaurants/{slug}/bookings", Tag: "API v1", Summary: "Забронировать столик", Body: apiBookingRequest{}, Status: http.StatusCreated, Response: apiBooking{}, Conflicts: bookingConflicts},
+	{Method: "POST", Path: "/api/v1/session", Tag: "API v1", Summary: "Войти и получить токен сессии", Body: loginRequest{}, Status: http.StatusCreated, Response: apiSession{}},
+	{Method: "DELETE", Path: "/api/v1/session", Tag: "API v1", Summary: "Завершить сессию", Staff: true, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/v1/bookings", Tag: "API v1", Summary: "Бронирования ресторана", Staff: true, Query: bookingsQuery, Response: apiBookingPage{}},
+	{Method: "GET", Path: "/api/v1/bookings/{id}", Tag: "API v1", Summary: "Бронирование", Staff: true, Response: apiBooking{}},
+	{Method: "PUT", Path: "/api/v1/bookings/{id}/status", Tag: "API v1", Summary: "Сменить статус бронирования", Staff: true, Body: bookingStatusRequest{}, Response: apiBooking{}},
+	{Method: "GET", Path: "/api/v1/tables", Tag: "API v1", Summary: "Столики ресторана", Staff: true, Response: apiField{"tables", []Table{}}},
+	{Method: "POST", Path: "/api/v1/tables", Tag: "API v1", Summary: "Добавить столик", Staff: true, Body: Table{}, Status: http.StatusCreated, Response: Table{}, Conflicts: []string{"duplicate_table"}},
+	{Method: "PUT", Path: "/api/v1/tables/{id}", Tag: "API v1", Summary: "Изменить столик", Staff: true, Body: Table{}, Response: Table{}, Conflicts: []string{"duplicate_table"}},
+	{Method: "DELETE", Path: "/api/v1/tables/{id}", Tag: "API v1", Summary: "Удалить столик", Staff: true, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/v1/users", Tag: "API v1", Summary: "Сотрудники", Staff: true, Response: apiField{"users", []User{}}},
+	{Method: "POST", Path: "/api/v1/users", Tag: "API v1", Summary: "Добавить сотрудника", Staff: true, Body: createUserRequest{}, Status: http.StatusCreated, Response: User{}},
+	{Method: "PUT", Path: "/api/v1/users/{id}", Tag: "API v1", Summary: "Изменить сотрудника", Staff: true, Body: updateUserRequest{}, Response: User{}},
+
+	// Админ-панель
+	{Method: "POST", Path: "/admin/logout", Tag: "Админ-панель", Summary: "Выйти", Response: apiMessage{}},
+	{Method: "GET", Path: "/admin/bookings", Tag: "Админ-панель", Summary: "Бронирования ресторана; следующая страница — в заголовке Link", Staff: true, Query: bookingsQuery, Response: []Booking{}},
+	{Method: "GET", Path: "/admin/bookings/export.csv", Tag: "Админ-панель", Summary: "Выгрузить бронирования по фильтрам списка в CSV", Staff: true, Query: exportQuery, Produces: "text/csv"},
+	{Method: "GET", Path: "/admin/bookings/export.xlsx", Tag: "Админ-панель", Summary: "Выгрузить бронирования по фильтрам списка в Excel", Staff: true, Query: exportQuery, Produces: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{Method: "POST", Path: "/admin/bookings/import", Tag: "Админ-панель", Summary: "Загрузить бронирования из CSV; с dry_run=1 — только проверить строки", Staff: true, Query: importQuery, Consumes: []string{"multipart/form-data", "text/csv"}, Response: bookingImportReport{}},
+	{Method: "POST", Path: "/admin/calendar", Tag: "Админ-панель", Summary: "Получить новую ссылку на ленту бронирований для календаря; прежняя перестает работать", Staff: true, Response: calendarLink{}},
+	{Method: "DELETE", Path: "/admin/calendar", Tag: "Админ-панель", Summary: "Отключить ссылку на ленту календаря", Staff: true, Response: apiMessage{}},
+	{Method: "GET", Path: "/admin/bookings/{id}/history", Tag: "Админ-панель", Summary: "История бронирования", Staff: true, Response: []BookingEvent{}},
+	{Method: "PUT", Path: "/admin/bookings/{id}/status", Tag: "Админ-панель", Summary: "Сменить статус бронирования", Staff: true, Body: bookingStatusRequest{}, Response: apiMessage{}},
+	{Method: "GET", Path: "/admin/waitlist", Tag: "Админ-панель", Summary: "Лист ожидания по сменам", Staff: true, Query: waitlistQuery, Response: []waitlistService{}},
+	{Method: "DELETE", Path: "/admin/waitlist/{id}", Tag: "Админ-панель", Summary: "Снять заявку из листа ожидания", Staff: true, Response: apiMessage{}, Conflicts: []string{"status_changed"}},
+	{Method: "GET", Path: "/admin/tables", Tag: "Админ-панель", Summary: "Столики ресторана", Staff: true, Response: []Table{}},
+	{Method: "POST", Path: "/admin/tables", Tag: "Админ-панель", Summary: "Добавить столик", Staff: true, Body: Table{}, Response: Table{}, Conflicts: []string{"duplicate_table"}},
+	{Method: "PUT", Path: "/admin/tables/{id}", Tag: "Админ-панель", Summary: "Изменить столик", Staff: true, Body: Table{}, Response: Table{}, Conflicts: []string{"duplicate_table"}},
+	{Method: "DELETE", Path: "/admin/tables/{id}", Tag: "Админ-панель", Summary: "Удалить столик", Staff: true, Response: apiMessage{}},
+	{Method: "GET", Path: "/admin/hours", Tag: "Админ-панель", Summary: "Часы работы, особые дни и блокировки", Staff: true, Response: scheduleView{}},
+	{Method: "POST", Path: "/admin/hours/{kind}", Tag: "Админ-панель", Summary: "Добавить период (weekly), особые часы (overrides), праздник (holidays) или блокировку (blackouts)", Staff: true, Body: scheduleBody, Response: scheduleItems},
+	{Method: "DELETE", Path: "/admin/hours/{kind}/{id}", Tag: "Админ-панель", Summary: "Удалить запись расписания", Staff: true, Response: apiMessage{}},
+	{Method: "GET", Path: "/admin/restaurants", Tag: "Админ-панель", Summary: "Доступные рестораны", Staff: true, Response: []Restaurant{}},
+	{Method: "POST", Path: "/admin/restaurants", Tag: "Админ-панель", Summary: "Открыть ресторан", Staff: true, Body: Restaurant{}, Response: Restaurant{}},
+	{Method: "PUT", Path: "/admin/restaurants/{id}", Tag: "Админ-панель", Summary: "Изменить ресторан", Staff: true, Body: Restaurant{}, Response: Restaurant{}},
+	{Method: "GET", Path: "/admin/jobs", Tag: "Админ-панель", Summary: "Последние запуски фоновых заданий", Staff: true, Response: []JobRun{}},
+	{Method: "GET", Path: "/admin/users", Tag: "Админ-панель", Summary: "Сотрудники", Staff: true, Response: []User{}},
+	{Method: "POST", Path: "/admin/users", Tag: "Админ-панель", Summary: "Добавить сотрудника", Staff: true, Body: createUserRequest{}, Response: User{}},
+	{Method: "PUT", Path: "/admin/users/{id}", Tag: "Админ-панель", Summary: "Изменить сотрудника", Staff: true, Body: updateUserRequest{}, Response: User{}},
+}
+
+// openAPISpec — собранное описание API и схемы тел запросов для проверки
+type openAPISpec struct {
+	document   []byte
+	components map[string]*openAPISchema
+	bodies     map[string]*openAPISchema // "PUT /api/manage/{token}" → схема тела
+}
+
+var apiSpec = buildOpenAPISpec(apiOperations)
+
+// schemaBuilder строит схемы по Go-типам; именованные структуры попадают в components
+type schemaBuilder struct {
+	components map[string]*openAPISchema
+}
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *openAPISchema {
+	if t == reflect.TypeOf(time.Time{}) {
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schemaOf(t.Elem())
+		if s.Ref != "" {
+			return s
+		}
+		nullable := *s
+		nullable.Nullable = true
+		return &nullable
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: b.schemaOf(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.objectSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = &openAPISchema{} // заглушка на случай рекурсивных типов
+			b.components[name] = b.objectSchema(t)
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + name}
+	}
+	return &openAPISchema{}
+}
+
+// schemaName — имя схемы в components: имя Go-типа с заглавной буквы
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// objectSchema собирает свойства структуры по правилам encoding/json: поля встроенных
+// структур поднимаются наверх, а одноименное поле внешней структуры их перекрывает
+func (b *schemaBuilder) objectSchema(t reflect.Type) *openAPISchema {
+	s := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}}
+	b.addFields(s, t, 0, map[string]int{})
+	sort.Strings(s.Required)
+	return s
+}
+
+func (b *schemaBuilder) addFields(s *openAPISchema, t reflect.Type, depth int, depths map[string]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.addFields(s, embedded, depth+1, depths)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if d, ok := depths[name]; ok && d <= depth {
+			continue
+		}
+		depths[name] = depth
+
+		field := b.schemaOf(f.Type)
+		if opts := f.Tag.Get("schema"); opts != "" {
+			field = applySchemaTag(field, opts)
+			if hasOption(opts, "required") && !containsString(s.Required, name) {
+				s.Required = append(s.Required, name)
+			}
+		}
+		s.Properties[name] = field
+	}
+}
+
+// applySchemaTag добавляет к схеме поля ограничения из тега schema
+func applySchemaTag(s *openAPISchema, opts string) *openAPISchema {
+	tagged := *s
+	for _, opt := range strings.Split(opts, ",") {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "format":
+			format, ok := schemaFormats[value]
+			if !ok {
+				panic("неизвестный формат в теге schema: " + value)
+			}
+			tagged.Format = format.format
+			tagged.Pattern = format.pattern
+			tagged.pattern = regexp.MustCompile(format.pattern)
+		case "enum":
+			values, ok := schemaEnums[value]
+			if !ok {
+				panic("неизвестный список значений в теге schema: " + value)
+			}
+			tagged.Enum = values()
+		case "min", "max":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				panic("неверное число в теге schema: " + opt)
+			}
+			if key == "min" {
+				tagged.Minimum = &n
+			} else {
+				tagged.Maximum = &n
+			}
+		}
+	}
+	return &tagged
+}
+
+func hasOption(opts, option string) bool {
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// valueSchema строит схему тела запроса или ответа из значения в таблице операций
+func (b *schemaBuilder) valueSchema(v interface{}) *openAPISchema {
+	switch v := v.(type) {
+	case apiField:
+		return &openAPISchema{
+			Type:       "object",
+			Properties: map[string]*openAPISchema{v.Name: b.valueSchema(v.Value)},
+			Required:   []string{v.Name},
+		}
+	case apiAnyOf:
+		s := &openAPISchema{}
+		for _, variant := range v {
+			s.AnyOf = append(s.AnyOf, b.valueSchema(variant))
+		}
+		return s
+	}
+	return b.schemaOf(reflect.TypeOf(v))
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)`)
+
+func buildOpenAPISpec(operations []apiOperation) *openAPISpec {
+	b := &schemaBuilder{components: map[string]*openAPISchema{}}
+	b.components["Error"] = b.objectSchema(reflect.TypeOf(apiErrorBody{}))
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": &openAPISchema{Ref: "#/components/schemas/Error"}},
+			},
+		}
+	}
+
+	spec := &openAPISpec{bodies: map[string]*openAPISchema{}}
+	paths := map[string]map[string]interface{}{}
+	for _, op := range operations {
+		var params []map[string]interface{}
+		for _, m := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+			schema := &openAPISchema{Type: "string"}
+			if m[1] == "id" {
+				schema.Type = "integer"
+			}
+			params = append(params, map[string]interface{}{"name": m[1], "in": "path", "required": true, "schema": schema})
+		}
+		query := append([]apiParam{}, op.Query...)
+		if op.Staff {
+			query = append(query, apiParam{Name: "restaurant", Type: "integer", Description: "Ресторан, по умолчанию — выбранный в админ-панели или первый доступный"})
+		}
+		for _, p := range query {
+			schema := &openAPISchema{Type: p.Type}
+			if p.Format != "" {
+				schema = applySchemaTag(schema, "format="+p.Format)
+			}
+			param := map[string]interface{}{"name": p.Name, "in": "query", "schema": schema, "description": p.Description}
+			if p.Required {
+				param["required"] = true
+			}
+			params = append(params, param)
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if op.Response != nil {
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": b.valueSchema(op.Response)},
+			}
+		}
+		if op.Produces != "" {
+			success["content"] = map[string]interface{}{
+				op.Produces: map[string]interface{}{"schema": &openAPISchema{Type: "string", Format: "binary"}},
+			}
+		}
+		responses := map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            errorResponse("Ошибка"),
+		}
+
+		operation := map[string]interface{}{
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+			"responses":   responses,
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.Body != nil {
+			body := b.valueSchema(op.Body)
+			spec.bodies[op.Method+" "+op.Path] = body
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": body},
+				},
+			}
+			responses["400"] = errorResponse("Неверный JSON или данные не прошли проверку")
+		}
+		if len(op.Consumes) > 0 {
+			content := map[string]interface{}{}
+			for _, mediaType := range op.Consumes {
+				schema := &openAPISchema{Type: "string", Format: "binary"}
+				if mediaType == "multipart/form-data" {
+					schema = &openAPISchema{Type: "object", Required: []string{"file"},
+						Properties: map[string]*openAPISchema{"file": schema}}
+				}
+				content[mediaType] = map[string]interface{}{"schema": schema}
+			}
+			operation["requestBody"] = map[string]interface{}{"required": true, "content": content}
+			responses["400"] = errorResponse("Файл не разобран")
+		}
+		if len(op.Conflicts) > 0 {
+			responses["409"] = errorResponse("Конфликт, error.code: " + strings.Join(op.Conflicts, ", "))
+		}
+		if op.Staff {
+			responses["401"] = errorResponse("Нужен вход")
+			responses["403"] = errorResponse("Недостаточно прав")
+			if strings.HasPrefix(op.Path, "/api/v1/") {
+				operation["security"] = []map[string][]string{{"bearerAuth": {}}, {"cookieAuth": {}}}
+			} else {
+				operation["security"] = []map[string][]string{{"cookieAuth": {}}}
+			}
+		}
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]interface{}{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+	spec.components = b.components
+
+	document, err := json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "DineBook API",
+			"version":     "1",
+			"description": "Бронирование столиков: сайт ресторана, API v1 и JSON-ответы админ-панели. Ошибки API v1 приходят в конверте {\"error\": {\"code\", \"message\", \"request_id\"}}.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"},
+				"cookieAuth": map[string]string{"type": "apiKey", "in": "cookie", "name": sessionCookieName},
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		panic("ошибка сборки описания API: " + err.Error())
+	}
+	spec.document = document
+	return spec
+}
+
+// apiErrorBody — тело ответа с ошибкой
+type apiErrorBody struct {
+	Error apiError `json:"error"`
+}
+
+// operationID — имя операции для генераторов клиентов: put_api_v1_bookings_id_status
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.Split(op.Path, "/") {
+		part = strings.Trim(part, "{}")
+		if part != "" {
+			id += "_" + part
+		}
+	}
+	return id
+}
+
+// handleOpenAPI отдает описание API
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(apiSpec.document)
+}
+
+// handleAPIDocs — страница просмотра описания API
+func handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFiles("templates/api_docs.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона api_docs.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, nil); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона api_docs.html", "error", err)
+	}
+}
+
+// openAPIValidationMiddleware проверяет JSON в теле запроса по схеме операции до того,
+// как его разберет обработчик. Ошибка приходит в общем формате writeError с кодом
+// invalid_json (не JSON) или validation_failed (не совпадает со схемой) и списком нарушений.
+func openAPIValidationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		schema := apiSpec.bodies[r.Method+" "+routeTemplate(r)]
+		if schema == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, r, http.StatusRequestEntityTooLarge, "request_too_large", "Слишком большой запрос")
+				return
+			}
+			writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при чтении данных")
+			return
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+			return
+		}
+		if problems := apiSpec.validate(schema, value, ""); len(problems) > 0 {
+			slog.InfoContext(r.Context(), "Запрос не прошел проверку по схеме", "route", routeTemplate(r), "problems", strings.Join(problems, "; "))
+			writeValidationError(w, r, problems)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeValidationError отдает нарушения схемы: в JSON — списком в поле details, иначе текстом
+func writeValidationError(w http.ResponseWriter, r *http.Request, problems []string) {
+	message := "Неверные данные: " + strings.Join(problems, "; ")
+	if !wantsJSON(r) {
+		http.Error(w, message, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]apiError{
+		"error": {Code: "validation_failed", Message: message, RequestID: requestID(r.Context()), Details: problems},
+	})
+}
+
+var schemaTypeTitles = map[string]string{
+	"object":  "объект",
+	"array":   "массив",
+	"string":  "строка",
+	"integer": "целое число",
+	"number":  "число",
+	"boolean": "true или false",
+}
+
+// validate проверяет значение, разобранное с UseNumber, и возвращает нарушения вида
+// «поле guests: ожидается целое число»
+func (spec *openAPISpec) validate(s *openAPISchema, value interface{}, path string) []string {
+	if s.Ref != "" {
+		return spec.validate(spec.components[strings.TrimPrefix(s.Ref, "#/components/schemas/")], value, path)
+	}
+	fail := func(format string, args ...interface{}) []string {
+		where := "тело запроса"
+		if path != "" {
+			where = "поле " + path
+		}
+		return []string{where + ": " + fmt.Sprintf(format, args...)}
+	}
+
+	if len(s.AnyOf) > 0 {
+		var first []string
+		for _, variant := range s.AnyOf {
+			problems := spec.validate(variant, value, path)
+			if len(problems) == 0 {
+				return nil
+			}
+			if first == nil {
+				first = problems
+			}
+		}
+		return fail("не подходит ни под один из вариантов (%s)", strings.Join(first, "; "))
+	}
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fail("ожидается %s, а не null", schemaTypeTitles[s.Type])
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("ожидается объект")
+		}
+		var problems []string
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				problems = append(problems, "поле "+joinPath(path, name)+": обязательное поле")
+			}
+		}
+		for _, name := range sortedKeys(object) {
+			field := s.Properties[name]
+			if field == nil {
+				field = s.AdditionalProperties
+			}
+			if field != nil {
+				problems = append(problems, spec.validate(field, object[name], joinPath(path, name))...)
+			}
+		}
+		return problems
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fail("ожидается массив")
+		}
+		var problems []string
+		for i, item := range items {
+			problems = append(problems, spec.validate(s.Items, item, path+"["+strconv.Itoa(i)+"]")...)
+		}
+		return problems
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fail("ожидается строка")
+		}
+		if len(s.Enum) > 0 && !containsString(s.Enum, str) {
+			return fail("допустимые значения: %s", strings.Join(s.Enum, ", "))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(str) {
+			return fail("неверный формат")
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fail("ожидается %s", schemaTypeTitles[s.Type])
+		}
+		n, err := number.Float64()
+		if err != nil {
+			return fail("ожидается %s", schemaTypeTitles[s.Type])
+		}
+		if _, err := number.Int64(); s.Type == "integer" && err != nil {
+			return fail("ожидается целое число")
+		}
+		if s.Minimum != nil && n < float64(*s.Minimum) {
+			return fail("значение меньше %d", *s.Minimum)
+		}
+		if s.Maximum != nil && n > float64(*s.Maximum) {
+			return fail("значение больше %d", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("ожидается true или false")
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// checkOpenAPIRoutes сверяет описание API с маршрутами роутера: каждый JSON-адрес
+// должен быть описан, а каждая описанная операция — зарегистрирована
+func checkOpenAPIRoutes(router *mux.Router) []string {
+	documented := map[string]bool{}
+	for _, op := range apiOperations {
+		documented[op.Method+" "+op.Path] = true
+	}
+
+	var problems []string
+	registered := map[string]bool{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			key := method + " " + path
+			registered[key] = true
+			if !documented[key] && wantsOpenAPI(path) {
+				problems = append(problems, "маршрут не описан: "+key)
+			}
+		}
+		return nil
+	})
+	for _, op := range apiOperations {
+		if key := op.Method + " " + op.Path; !registered[key] {
+			problems = append(problems, "описанной операции нет среди маршрутов: "+key)
+		}
+	}
+	return problems
+}
+
+// wantsOpenAPI сообщает, должен ли маршрут быть описан: все адреса /api/ и JSON-ответы админки,
+// кроме самого описания и HTML-страниц (/api/docs, /admin/, /admin/login)
+func wantsOpenAPI(path string) bool {
+	if path == "/api/openapi.json" || path == "/api/docs" {
+		return false
+	}
+	if strings.Contains(path, "/api/") {
+		return true
+	}
+	return strings.HasPrefix(path, "/admin/") && path != "/admin/" && path != "/admin/login"
+}
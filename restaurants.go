@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Restaurant — ресторан сети со своими столиками, расписанием, правилами бронирования и оформлением.
+// Публичная страница ресторана открывается по адресу /r/{slug}.
+type Restaurant struct {
+	ID      int    `json:"id"`
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Phone   string `json:"phone"`
+
+	// Оформление публичной страницы
+	Tagline     string `json:"tagline"`
+	LogoURL     string `json:"logo_url"`
+	AccentColor string `json:"accent_color"`
+
+	// Продолжительность визита и шаг слотов в минутах, максимальный размер компании для онлайн-бронирования
+	DiningMinutes int `json:"dining_minutes"`
+	SlotMinutes   int `json:"slot_minutes"`
+	MaxGuests     int `json:"max_guests"`
+
+	// Отключенный ресторан не принимает бронирования, но остается в админ-панели
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+var errRestaurantNotFound = errors.New("ресторан не найден")
+
+var (
+	restaurantSlugPattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+	restaurantColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// restaurantCookieName — cookie с рестораном, выбранным в админ-панели
+const restaurantCookieName = "restaurant"
+
+const restaurantContextKey contextKey = "restaurant"
+
+// DiningDuration — ожидаемая продолжительность визита, на которую резервируется столик
+func (rest *Restaurant) DiningDuration() time.Duration {
+	return time.Duration(rest.DiningMinutes) * time.Minute
+}
+
+// SlotInterval — шаг времени начала визита
+func (rest *Restaurant) SlotInterval() time.Duration {
+	return time.Duration(rest.SlotMinutes) * time.Minute
+}
+
+// BasePath — адрес публичной страницы ресторана
+func (rest *Restaurant) BasePath() string {
+	return "/r/" + rest.Slug
+}
+
+// GuestOption — вариант размера компании в форме бронирования
+type GuestOption struct {
+	Value int
+	Label string
+}
+
+// GuestOptions — варианты размера компании от 1 до MaxGuests: «1 человек», «2 человека», «5 человек»
+func (rest *Restaurant) GuestOptions() []GuestOption {
+	options := make([]GuestOption, rest.MaxGuests)
+	for i := range options {
+		n := i + 1
+		word := "человек"
+		if n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14) {
+			word = "человека"
+		}
+		options[i] = GuestOption{Value: n, Label: strconv.Itoa(n) + " " + word}
+	}
+	return options
+}
+
+func (rest *Restaurant) validate() error {
+	rest.Slug = strings.ToLower(strings.TrimSpace(rest.Slug))
+	rest.Name = strings.TrimSpace(rest.Name)
+	if !restaurantSlugPattern.MatchString(rest.Slug) {
+		return fmt.Errorf("адрес ресторана может содержать только латинские буквы, цифры и дефис (до 50 символов)")
+	}
+	if rest.Name == "" || len([]rune(rest.Name)) > 100 {
+		return fmt.Errorf("название ресторана должно содержать от 1 до 100 символов")
+	}
+	if rest.AccentColor == "" {
+		rest.AccentColor = "#8d7762"
+	}
+	if !restaurantColorPattern.MatchString(rest.AccentColor) {
+		return fmt.Errorf("цвет оформления должен быть в формате #RRGGBB")
+	}
+	if rest.LogoURL != "" && !strings.HasPrefix(rest.LogoURL, "https://") && !strings.HasPrefix(rest.LogoURL, "/static/") {
+		return fmt.Errorf("логотип должен быть ссылкой https:// или файлом из /static/")
+	}
+	if rest.DiningMinutes <= 0 || rest.DiningMinutes > 24*60 {
+		return fmt.Errorf("продолжительность визита должна быть от 1 минуты до 24 часов")
+	}
+	if rest.SlotMinutes <= 0 || rest.SlotMinutes > 24*60 {
+		return fmt.Errorf("шаг слотов должен быть от 1 минуты до 24 часов")
+	}
+	if rest.MaxGuests <= 0 || rest.MaxGuests > 100 {
+		return fmt.Errorf("максимальный размер компании должен быть от 1 до 100")
+	}
+	return nil
+}
+
+// RestaurantStore — рестораны сети
+type RestaurantStore interface {
+	GetRestaurants() ([]Restaurant, error)
+	GetRestaurantByID(id int) (*Restaurant, error)
+	GetRestaurantBySlug(slug string) (*Restaurant, error)
+	CreateRestaurant(rest *Restaurant) error
+	UpdateRestaurant(rest *Restaurant) error
+	// EnsureDefaultRestaurant создает ресторан rest, если в хранилище нет ни одного ресторана
+	EnsureDefaultRestaurant(rest *Restaurant) error
+}
+
+// defaultRestaurantSettings — ресторан, создаваемый при первом запуске, с правилами бронирования из конфигурации.
+// Те же правила предлагаются по умолчанию для новых ресторанов.
+func defaultRestaurantSettings() Restaurant {
+	return Restaurant{
+		Slug:          config.DefaultRestaurant,
+		Name:          config.DefaultRestaurantName,
+		AccentColor:   "#8d7762",
+		DiningMinutes: int(config.DiningDuration / time.Minute),
+		SlotMinutes:   int(config.SlotInterval / time.Minute),
+		MaxGuests:     config.MaxGuests,
+		Active:        true,
+	}
+}
+
+// defaultRestaurant возвращает ресторан по умолчанию: на него ведут адреса API без /r/{slug}.
+// Если ресторана DefaultRestaurant нет, используется первый действующий.
+func defaultRestaurant() (*Restaurant, error) {
+	rest, err := db.GetRestaurantBySlug(config.DefaultRestaurant)
+	if err == nil && rest.Active {
+		return rest, nil
+	}
+	if err != nil && !errors.Is(err, errRestaurantNotFound) {
+		return nil, err
+	}
+	restaurants, err := db.GetRestaurants()
+	if err != nil {
+		return nil, err
+	}
+	for i := range restaurants {
+		if restaurants[i].Active {
+			return &restaurants[i], nil
+		}
+	}
+	return nil, errRestaurantNotFound
+}
+
+const restaurantColumns = `id, slug, name, address, phone, tagline, logo_url, accent_color,
+	dining_minutes, slot_minutes, max_guests, active, created_at`
+
+func scanRestaurant(row rowScanner, rest *Restaurant) error {
+	err := row.Scan(&rest.ID, &rest.Slug, &rest.Name, &rest.Address, &rest.Phone, &rest.Tagline, &rest.LogoURL,
+		&rest.AccentColor, &rest.DiningMinutes, &rest.SlotMinutes, &rest.MaxGuests, &rest.Active, &rest.Created)
+	if err != nil {
+		return err
+	}
+	rest.Created = rest.Created.In(config.Location)
+	return nil
+}
+
+func (db *Database) GetRestaurants() ([]Restaurant, error) {
+	defer observeQuery("GetRestaurants", time.Now())
+	rows, err := db.Query(`SELECT ` + restaurantColumns + ` FROM restaurants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении ресторанов: %v", err)
+	}
+	defer rows.Close()
+
+	var restaurants []Restaurant
+	for rows.Next() {
+		var rest Restaurant
+		if err := scanRestaurant(rows, &rest); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении ресторана: %v", err)
+		}
+		restaurants = append(restaurants, rest)
+	}
+	return restaurants, rows.Err()
+}
+
+func (db *Database) getRestaurant(where string, arg interface{}) (*Restaurant, error) {
+	var rest Restaurant
+	row := db.QueryRow(`SELECT `+restaurantColumns+` FROM restaurants WHERE `+where+` = $1`, arg)
+	if err := scanRestaurant(row, &rest); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errRestaurantNotFound
+		}
+		return nil, err
+	}
+	return &rest, nil
+}
+
+func (db *Database) GetRestaurantByID(id int) (*Restaurant, error) {
+	defer observeQuery("GetRestaurantByID", time.Now())
+	return db.getRestaurant("id", id)
+}
+
+func (db *Database) GetRestaurantBySlug(slug string) (*Restaurant, error) {
+	defer observeQuery("GetRestaurantBySlug", time.Now())
+	return db.getRestaurant("slug", slug)
+}
+
+func (db *Database) CreateRestaurant(rest *Restaurant) error {
+	defer observeQuery("CreateRestaurant", time.Now())
+	err := db.QueryRow(`
+		INSERT INTO restaurants (slug, name, address, phone, tagline, logo_url, accent_color,
+			dining_minutes, slot_minutes, max_guests, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at
+	`, rest.Slug, rest.Name, rest.Address, rest.Phone, rest.Tagline, rest.LogoURL, rest.AccentColor,
+		rest.DiningMinutes, rest.SlotMinutes, rest.MaxGuests, rest.Active).Scan(&rest.ID, &rest.Created)
+	if err != nil {
+		return err
+	}
+	rest.Created = rest.Created.In(config.Location)
+	return nil
+}
+
+func (db *Database) UpdateRestaurant(rest *Restaurant) error {
+	defer observeQuery("UpdateRestaurant", time.Now())
+	result, err := db.Exec(`
+		UPDATE restaurants
+		SET slug = $1, name = $2, address = $3, phone = $4, tagline = $5, logo_url = $6, accent_color = $7,
+			dining_minutes = $8, slot_minutes = $9, max_guests = $10, active = $11
+		WHERE id = $12
+	`, rest.Slug, rest.Name, rest.Address, rest.Phone, rest.Tagline, rest.LogoURL, rest.AccentColor,
+		rest.DiningMinutes, rest.SlotMinutes, rest.MaxGuests, rest.Active, rest.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errRestaurantNotFound
+	}
+	return nil
+}
+
+func (db *Database) EnsureDefaultRestaurant(rest *Restaurant) error {
+	defer observeQuery("EnsureDefaultRestaurant", time.Now())
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM restaurants`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.CreateRestaurant(rest)
+}
+
+// currentRestaurant возвращает ресторан, к которому относится запрос: из адреса /r/{slug}
+// или выбранный сотрудником в админ-панели
+func currentRestaurant(r *http.Request) *Restaurant {
+	rest, _ := r.Context().Value(restaurantContextKey).(*Restaurant)
+	return rest
+}
+
+func withRestaurant(r *http.Request, rest *Restaurant) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), restaurantContextKey, rest))
+}
+
+// restaurantBySlugMiddleware находит ресторан по {slug} из адреса; отключенный ресторан гостям не показывается
+func restaurantBySlugMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, err := db.GetRestaurantBySlug(mux.Vars(r)["slug"])
+		if err != nil && !errors.Is(err, errRestaurantNotFound) {
+			slog.ErrorContext(r.Context(), "Ошибка при получении ресторана", "restaurant", mux.Vars(r)["slug"], "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		if rest == nil || !rest.Active {
+			writeError(w, r, http.StatusNotFound, "not_found", "Ресторан не найден")
+			return
+		}
+		next.ServeHTTP(w, withRestaurant(r, rest))
+	})
+}
+
+// withDefaultRestaurant обслуживает адреса API без /r/{slug} от имени ресторана по умолчанию,
+// чтобы не сломать интеграции, написанные до появления нескольких ресторанов
+func withDefaultRestaurant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest, err := defaultRestaurant()
+		if err != nil {
+			if errors.Is(err, errRestaurantNotFound) {
+				http.Error(w, "Ресторан не найден", http.StatusNotFound)
+				return
+			}
+			slog.ErrorContext(r.Context(), "Ошибка при получении ресторана по умолчанию", "error", err)
+			http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+			return
+		}
+		next(w, withRestaurant(r, rest))
+	}
+}
+
+// accessibleRestaurants возвращает рестораны, с которыми может работать сотрудник
+func accessibleRestaurants(user *User) ([]Restaurant, error) {
+	restaurants, err := db.GetRestaurants()
+	if err != nil {
+		return nil, err
+	}
+	accessible := []Restaurant{}
+	for _, rest := range restaurants {
+		if user.CanAccess(rest.ID) {
+			accessible = append(accessible, rest)
+		}
+	}
+	return accessible, nil
+}
+
+// adminRestaurantMiddleware выбирает ресторан, с которым работает сотрудник в админ-панели.
+// Ресторан переключается параметром ?restaurant=ID и запоминается в cookie.
+// В API v1 ресторан передается в ?restaurant=ID с каждым запросом; без него выбирается первый доступный.
+func adminRestaurantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(r)
+		restaurants, err := accessibleRestaurants(user)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при получении ресторанов", "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		if len(restaurants) == 0 {
+			slog.WarnContext(r.Context(), "У пользователя нет доступа ни к одному ресторану", "username", user.Username)
+			writeError(w, r, http.StatusForbidden, "forbidden", "Нет доступа ни к одному ресторану")
+			return
+		}
+
+		selected := r.URL.Query().Get("restaurant")
+		fromQuery := selected != ""
+		if !fromQuery {
+			if cookie, err := r.Cookie(restaurantCookieName); err == nil {
+				selected = cookie.Value
+			}
+		}
+		var rest *Restaurant
+		if id, err := strconv.Atoi(selected); err == nil {
+			for i := range restaurants {
+				if restaurants[i].ID == id {
+					rest = &restaurants[i]
+					break
+				}
+			}
+		}
+		// Клиент API явно указывает ресторан, и чужой ресторан не подменяется первым доступным
+		if rest == nil && fromQuery && isAPIRequest(r) {
+			writeError(w, r, http.StatusNotFound, "not_found", "Ресторан не найден")
+			return
+		}
+		if rest == nil {
+			rest = &restaurants[0]
+		}
+		if fromQuery && !isAPIRequest(r) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     restaurantCookieName,
+				Value:    strconv.Itoa(rest.ID),
+				Path:     "/admin",
+				HttpOnly: true,
+				Secure:   config.SecureCookies,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		next.ServeHTTP(w, withRestaurant(r, rest))
+	})
+}
+
+// handleRestaurants — главная страница: единственный ресторан открывается сразу, иначе показывается список
+func handleRestaurants(w http.ResponseWriter, r *http.Request) {
+	all, err := db.GetRestaurants()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении ресторанов", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	restaurants := []Restaurant{}
+	for _, rest := range all {
+		if rest.Active {
+			restaurants = append(restaurants, rest)
+		}
+	}
+	if len(restaurants) == 0 {
+		http.Error(w, "Бронирование временно недоступно", http.StatusNotFound)
+		return
+	}
+	if len(restaurants) == 1 {
+		http.Redirect(w, r, restaurants[0].BasePath(), http.StatusFound)
+		return
+	}
+
+	tmpl, err := template.ParseFiles("templates/restaurants.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, restaurants); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона restaurants.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	}
+}
+
+func handleAdminRestaurants(w http.ResponseWriter, r *http.Request) {
+	restaurants, err := accessibleRestaurants(currentUser(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении ресторанов", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(restaurants)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(r, "templates/admin/restaurants.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона restaurants.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Restaurants []Restaurant
+		Defaults    Restaurant
+	}{restaurants, defaultRestaurantSettings()}
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона restaurants.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	}
+}
+
+// handleCreateRestaurant открывает новый ресторан с недельным расписанием по умолчанию; столики заводятся отдельно
+func handleCreateRestaurant(w http.ResponseWriter, r *http.Request) {
+	var rest Restaurant
+	if err := json.NewDecoder(r.Body).Decode(&rest); err != nil {
+		http.Error(w, "Ошибка при разборе данных", http.StatusBadRequest)
+		return
+	}
+	if err := rest.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := db.CreateRestaurant(&rest); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при создании ресторана", "restaurant", rest.Slug, "error", err)
+		if isUniqueViolation(err) {
+			http.Error(w, "Ресторан с таким адресом уже существует", http.StatusConflict)
+		} else {
+			http.Error(w, "Ошибка при создании ресторана", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := db.EnsureDefaultOpeningHours(rest.ID, config.OpeningTime, config.ClosingTime); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка создания часов работы", "restaurant", rest.Slug, "error", err)
+	}
+
+	slog.InfoContext(r.Context(), "Ресторан открыт", "username", currentUser(r).Username, "restaurant", rest.Slug, "restaurant_id", rest.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rest)
+}
+
+func handleUpdateRestaurant(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+	if !currentUser(r).CanAccess(id) {
+		http.Error(w, "Ресторан не найден", http.StatusNotFound)
+		return
+	}
+
+	var rest Restaurant
+	if err := json.NewDecoder(r.Body).Decode(&rest); err != nil {
+		http.Error(w, "Ошибка при разборе данных", http.StatusBadRequest)
+		return
+	}
+	rest.ID = id
+	if err := rest.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := db.UpdateRestaurant(&rest); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при обновлении ресторана", "restaurant_id", id, "error", err)
+		switch {
+		case errors.Is(err, errRestaurantNotFound):
+			http.Error(w, "Ресторан не найден", http.StatusNotFound)
+		case isUniqueViolation(err):
+			http.Error(w, "Ресторан с таким адресом уже существует", http.StatusConflict)
+		default:
+			http.Error(w, "Ошибка при обновлении ресторана", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Ресторан изменен", "username", currentUser(r).Username, "restaurant", rest.Slug, "restaurant_id", rest.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rest)
+}
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OpeningPeriod — период обслуживания в определенный день недели (например, обед или ужин)
+type OpeningPeriod struct {
+	ID           int    `json:"id"`
+	RestaurantID int    `json:"restaurant_id"`
+	Weekday      int    `json:"weekday" schema:"required,min=0,max=6"` // 0 — воскресенье, как в time.Weekday
+	Name         string `json:"name"`
+	Open         string `json:"open" schema:"required,format=time"`
+	Close        string `json:"close" schema:"required,format=time"`
+}
+
+// ScheduleOverride — особые часы работы на конкретную дату, заменяющие недельное расписание
+type ScheduleOverride struct {
+	ID           int    `json:"id"`
+	RestaurantID int    `json:"restaurant_id"`
+	Date         string `json:"date" schema:"required,format=date"`
+	Name         string `json:"name"`
+	Open         string `json:"open" schema:"required,format=time"`
+	Close        string `json:"close" schema:"required,format=time"`
+}
+
+// Holiday — праздничный день, в который ресторан закрыт
+type Holiday struct {
+	ID           int    `json:"id"`
+	RestaurantID int    `json:"restaurant_id"`
+	Date         string `json:"date" schema:"required,format=date"`
+	Name         string `json:"name"`
+	Recurring    bool   `json:"recurring"` // Повторяется каждый год
+}
+
+// Blackout — интервал, в который бронирование недоступно (банкет, санитарный день и т.п.)
+type Blackout struct {
+	ID           int       `json:"id"`
+	RestaurantID int       `json:"restaurant_id"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Reason       string    `json:"reason"`
+}
+
+// ServicePeriod — интервал работы ресторана в конкретный день
+type ServicePeriod struct {
+	Name  string `json:"name"`
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+// DaySchedule — итоговое расписание на дату с учетом особых дней, праздников и блокировок
+type DaySchedule struct {
+	Date      string          `json:"date"`
+	Closed    bool            `json:"closed"`
+	Reason    string          `json:"reason,omitempty"`
+	Periods   []ServicePeriod `json:"periods"`
+	Blackouts []Blackout      `json:"blackouts"`
+}
+
+var errScheduleItemNotFound = errors.New("запись расписания не найдена")
+
+var weekdayNames = []string{"Воскресенье", "Понедельник", "Вторник", "Среда", "Четверг", "Пятница", "Суббота"}
+
+// minutesOf переводит время HH:MM в минуты от начала суток
+func minutesOf(hhmm string) int {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+// bounds возвращает границы периода в минутах; период, заканчивающийся после полуночи, продлевается на следующие сутки
+func (p ServicePeriod) bounds() (int, int) {
+	open, close := minutesOf(p.Open), minutesOf(p.Close)
+	if close <= open {
+		close += 24 * 60
+	}
+	return open, close
+}
+
+func validatePeriod(open, close string) error {
+	if _, err := time.Parse("15:04", open); err != nil {
+		return fmt.Errorf("неверное время открытия (должно быть HH:MM)")
+	}
+	if _, err := time.Parse("15:04", close); err != nil {
+		return fmt.Errorf("неверное время закрытия (должно быть HH:MM)")
+	}
+	if open == close {
+		return fmt.Errorf("время открытия и закрытия совпадают")
+	}
+	return nil
+}
+
+// localWallClock трактует дату и время из колонки TIMESTAMP как местное время ресторана
+func localWallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, config.Location)
+}
+
+func closedError(reason, message string) error {
+	return &BookingError{Status: http.StatusUnprocessableEntity, Message: message, Reason: reason}
+}
+
+func (s DaySchedule) hours() string {
+	var parts []string
+	for _, p := range s.Periods {
+		parts = append(parts, p.Open+"–"+p.Close)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkSlot проверяет, что визит, начинающийся в timeStr, укладывается в расписание дня
+func (s DaySchedule) checkSlot(timeStr string, duration time.Duration) error {
+	if s.Closed {
+		return closedError("holiday", "Ресторан закрыт: "+s.Reason)
+	}
+	if len(s.Periods) == 0 {
+		return closedError("closed_day", "Ресторан не работает в этот день")
+	}
+
+	start := minutesOf(timeStr)
+	end := start + int(duration/time.Minute)
+	inPeriod := false
+	for _, p := range s.Periods {
+		open, close := p.bounds()
+		if start >= open && end <= close {
+			inPeriod = true
+			break
+		}
+	}
+	if !inPeriod {
+		return closedError("outside_hours", fmt.Sprintf(
+			"Выбранное время вне часов работы (%s); визит должен закончиться до закрытия", s.hours()))
+	}
+
+	startAt, err := bookingStart(s.Date, timeStr)
+	if err != nil {
+		return newBookingError(http.StatusBadRequest, "Неверный формат времени (должен быть HH:MM)")
+	}
+	endAt := startAt.Add(duration)
+	for _, b := range s.Blackouts {
+		if startAt.Before(b.End) && b.Start.Before(endAt) {
+			reason := b.Reason
+			if reason == "" {
+				reason = "ресторан недоступен для бронирования"
+			}
+			return closedError("blackout", "Бронирование на это время недоступно: "+reason)
+		}
+	}
+
+	return nil
+}
+
+// slotTimes перечисляет времена начала визита в часы работы с шагом interval
+func (s DaySchedule) slotTimes(interval, duration time.Duration) []string {
+	if s.Closed {
+		return nil
+	}
+
+	step := int(interval / time.Minute)
+	length := int(duration / time.Minute)
+	if step <= 0 {
+		return nil
+	}
+
+	seen := make(map[int]bool)
+	var starts []int
+	for _, p := range s.Periods {
+		open, close := p.bounds()
+		// Время после полуночи относится уже к следующей дате
+		for t := open; t+length <= close && t < 24*60; t += step {
+			if !seen[t] {
+				seen[t] = true
+				starts = append(starts, t)
+			}
+		}
+	}
+	sort.Ints(starts)
+
+	slots := make([]string, 0, len(starts))
+	for _, t := range starts {
+		slots = append(slots, fmt.Sprintf("%02d:%02d", t/60, t%60))
+	}
+	return slots
+}
+
+// overnightTails — части периодов предыдущего дня, которые заканчиваются после полуночи:
+// с 00:00 до закрытия они продолжаются в следующие сутки
+func overnightTails(prev DaySchedule) []ServicePeriod {
+	if prev.Closed {
+		return nil
+	}
+	var tails []ServicePeriod
+	for _, p := range prev.Periods {
+		if _, close := p.bounds(); close > 24*60 {
+			tails = append(tails, ServicePeriod{Name: p.Name, Open: "00:00", Close: p.Close})
+		}
+	}
+	return tails
+}
+
+// GetDaySchedule собирает расписание ресторана на дату: праздники, особые часы или недельное расписание,
+// продолжение ночных периодов предыдущего дня и блокировки
+func (db *Database) GetDaySchedule(restaurantID int, date string) (DaySchedule, error) {
+	defer observeQuery("GetDaySchedule", time.Now())
+	schedule := DaySchedule{Date: date, Periods: []ServicePeriod{}, Blackouts: []Blackout{}}
+
+	day, err := time.ParseInLocation("2006-01-02", date, config.Location)
+	if err != nil {
+		return schedule, fmt.Errorf("неверный формат даты: %v", err)
+	}
+
+	schedule, err = db.dayPeriods(restaurantID, day)
+	if err != nil || schedule.Closed {
+		return schedule, err
+	}
+	prev, err := db.dayPeriods(restaurantID, day.AddDate(0, 0, -1))
+	if err != nil {
+		return schedule, err
+	}
+	schedule.Periods = append(overnightTails(prev), schedule.Periods...)
+
+	// Блокировки, пересекающиеся с этими сутками (визит может закончиться после полуночи)
+	rows, err := db.Query(`
+		SELECT id, restaurant_id, starts_at, ends_at, reason FROM blackouts
+		WHERE restaurant_id = $1 AND starts_at < $2 AND ends_at > $3
+		ORDER BY starts_at
+	`, restaurantID, day.AddDate(0, 0, 2).Format("2006-01-02 15:04:05"), day.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return schedule, fmt.Errorf("ошибка при получении блокировок: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b Blackout
+		if err := rows.Scan(&b.ID, &b.RestaurantID, &b.Start, &b.End, &b.Reason); err != nil {
+			return schedule, fmt.Errorf("ошибка при чтении блокировки: %v", err)
+		}
+		b.Start, b.End = localWallClock(b.Start), localWallClock(b.End)
+		schedule.Blackouts = append(schedule.Blackouts, b)
+	}
+	return schedule, rows.Err()
+}
+
+// dayPeriods возвращает собственные периоды дня без блокировок: праздник, особые часы или недельное расписание
+func (db *Database) dayPeriods(restaurantID int, day time.Time) (DaySchedule, error) {
+	date := day.Format("2006-01-02")
+	schedule := DaySchedule{Date: date, Periods: []ServicePeriod{}, Blackouts: []Blackout{}}
+
+	// Праздники закрывают ресторан на весь день
+	err := db.QueryRow(`
+		SELECT name FROM holidays
+		WHERE restaurant_id = $1 AND (holiday_date = $2 OR (recurring AND SUBSTR(holiday_date, 6) = $3))
+		LIMIT 1
+	`, restaurantID, date, date[5:]).Scan(&schedule.Reason)
+	if err == nil {
+		schedule.Closed = true
+		return schedule, nil
+	}
+	if err != sql.ErrNoRows {
+		return schedule, fmt.Errorf("ошибка при проверке праздников: %v", err)
+	}
+
+	// Особые часы на дату заменяют недельное расписание
+	schedule.Periods, err = db.queryServicePeriods(`
+		SELECT name, open_time, close_time FROM schedule_overrides
+		WHERE restaurant_id = $1 AND override_date = $2
+		ORDER BY open_time
+	`, restaurantID, date)
+	if err != nil {
+		return schedule, err
+	}
+	if len(schedule.Periods) == 0 {
+		schedule.Periods, err = db.queryServicePeriods(`
+			SELECT name, open_time, close_time FROM opening_hours
+			WHERE restaurant_id = $1 AND weekday = $2
+			ORDER BY open_time
+		`, restaurantID, int(day.Weekday()))
+		if err != nil {
+			return schedule, err
+		}
+	}
+	return schedule, nil
+}
+
+func (db *Database) queryServicePeriods(query string, args ...interface{}) ([]ServicePeriod, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении часов работы: %v", err)
+	}
+	defer rows.Close()
+
+	periods := []ServicePeriod{}
+	for rows.Next() {
+		var p ServicePeriod
+		if err := rows.Scan(&p.Name, &p.Open, &p.Close); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении часов работы: %v", err)
+		}
+		periods = append(periods, p)
+	}
+	return periods, rows.Err()
+}
+
+func (db *Database) GetOpeningHours(restaurantID int) ([]OpeningPeriod, error) {
+	defer observeQuery("GetOpeningHours", time.Now())
+	rows, err := db.Query(`
+		SELECT id, restaurant_id, weekday, name, open_time, close_time
+		FROM opening_hours
+		WHERE restaurant_id = $1
+		ORDER BY weekday, open_time
+	`, restaurantID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении часов работы: %v", err)
+	}
+	defer rows.Close()
+
+	var periods []OpeningPeriod
+	for rows.Next() {
+		var p OpeningPeriod
+		if err := rows.Scan(&p.ID, &p.RestaurantID, &p.Weekday, &p.Name, &p.Open, &p.Close); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении часов работы: %v", err)
+		}
+		periods = append(periods, p)
+	}
+	return periods, rows.Err()
+}
+
+func (db *Database) CreateOpeningPeriod(p *OpeningPeriod) error {
+	defer observeQuery("CreateOpeningPeriod", time.Now())
+	return db.QueryRow(`
+		INSERT INTO opening_hours (restaurant_id, weekday, name, open_time, close_time)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, p.RestaurantID, p.Weekday, p.Name, p.Open, p.Close).Scan(&p.ID)
+}
+
+// EnsureDefaultOpeningHours заполняет недельное расписание ресторана, если оно еще не задано
+func (db *Database) EnsureDefaultOpeningHours(restaurantID int, open, close string) error {
+	defer observeQuery("EnsureDefaultOpeningHours", time.Now())
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM opening_hours WHERE restaurant_id = $1`, restaurantID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	for weekday := 0; weekday < 7; weekday++ {
+		p := OpeningPeriod{RestaurantID: restaurantID, Weekday: weekday, Name: "Основное время", Open: open, Close: close}
+		if err := db.CreateOpeningPeriod(&p); err != nil {
+			return fmt.Errorf("ошибка создания часов работы: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetScheduleOverrides возвращает особые часы работы начиная с указанной даты
+func (db *Database) GetScheduleOverrides(restaurantID int, from string) ([]ScheduleOverride, error) {
+	defer observeQuery("GetScheduleOverrides", time.Now())
+	rows, err := db.Query(`
+		SELECT id, restaurant_id, override_date, name, open_time, close_time
+		FROM schedule_overrides
+		WHERE restaurant_id = $1 AND override_date >= $2
+		ORDER BY override_date, open_time
+	`, restaurantID, from)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении особых часов работы: %v", err)
+	}
+	defer rows.Close()
+
+	var overrides []ScheduleOverride
+	for rows.Next() {
+		var o ScheduleOverride
+		if err := rows.Scan(&o.ID, &o.RestaurantID, &o.Date, &o.Name, &o.Open, &o.Close); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении особых часов работы: %v", err)
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+func (db *Database) CreateScheduleOverride(o *ScheduleOverride) error {
+	defer observeQuery("CreateScheduleOverride", time.Now())
+	return db.QueryRow(`
+		INSERT INTO schedule_overrides (restaurant_id, override_date, name, open_time, close_time)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, o.RestaurantID, o.Date, o.Name, o.Open, o.Close).Scan(&o.ID)
+}
+
+func (db *Database) GetHolidays(restaurantID int) ([]Holiday, error) {
+	defer observeQuery("GetHolidays", time.Now())
+	rows, err := db.Query(`
+		SELECT id, restaurant_id, holiday_date, name, recurring
+		FROM holidays
+		WHERE restaurant_id = $1
+		ORDER BY holiday_date
+	`, restaurantID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении праздников: %v", err)
+	}
+	defer rows.Close()
+
+	var holidays []Holiday
+	for rows.Next() {
+		var h Holiday
+		if err := rows.Scan(&h.ID, &h.RestaurantID, &h.Date, &h.Name, &h.Recurring); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении праздника: %v", err)
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, rows.Err()
+}
+
+func (db *Database) CreateHoliday(h *Holiday) error {
+	defer observeQuery("CreateHoliday", time.Now())
+	return db.QueryRow(`
+		INSERT INTO holidays (restaurant_id, holiday_date, name, recurring)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, h.RestaurantID, h.Date, h.Name, h.Recurring).Scan(&h.ID)
+}
+
+// GetBlackouts возвращает блокировки ресторана, которые еще не закончились
+func (db *Database) GetBlackouts(restaurantID int, after time.Time) ([]Blackout, error) {
+	defer observeQuery("GetBlackouts", time.Now())
+	rows, err := db.Query(`
+		SELECT id, restaurant_id, starts_at, ends_at, reason
+		FROM blackouts
+		WHERE restaurant_id = $1 AND ends_at > $2
+		ORDER BY starts_at
+	`, restaurantID, after.In(config.Location).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении блокировок: %v", err)
+	}
+	defer rows.Close()
+
+	var blackouts []Blackout
+	for rows.Next() {
+		var b Blackout
+		if err := rows.Scan(&b.ID, &b.RestaurantID, &b.Start, &b.End, &b.Reason); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении блокировки: %v", err)
+		}
+		b.Start, b.End = localWallClock(b.Start), localWallClock(b.End)
+		blackouts = append(blackouts, b)
+	}
+	return blackouts, rows.Err()
+}
+
+func (db *Database) CreateBlackout(b *Blackout) error {
+	defer observeQuery("CreateBlackout", time.Now())
+	return db.QueryRow(`
+		INSERT INTO blackouts (restaurant_id, starts_at, ends_at, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, b.RestaurantID, b.Start.In(config.Location).Format("2006-01-02 15:04:05"), b.End.In(config.Location).Format("2006-01-02 15:04:05"), b.Reason).Scan(&b.ID)
+}
+
+// DeleteScheduleItem удаляет запись расписания ресторана из одной из таблиц расписания
+func (db *Database) DeleteScheduleItem(restaurantID int, kind string, id int) error {
+	defer observeQuery("DeleteScheduleItem", time.Now())
+	tables := map[string]string{
+		"weekly":    "opening_hours",
+		"overrides": "schedule_overrides",
+		"holidays":  "holidays",
+		"blackouts": "blackouts",
+	}
+	table, ok := tables[kind]
+	if !ok {
+		return fmt.Errorf("неизвестный раздел расписания: %s", kind)
+	}
+
+	result, err := db.Exec(`DELETE FROM `+table+` WHERE restaurant_id = $1 AND id = $2`, restaurantID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errScheduleItemNotFound
+	}
+	return nil
+}
+
+// scheduleView — расписание ресторана на странице часов работы: неделя, особые дни и блокировки
+type scheduleView struct {
+	Weekly    []OpeningPeriod    `json:"weekly"`
+	Overrides []ScheduleOverride `json:"overrides"`
+	Holidays  []Holiday          `json:"holidays"`
+	Blackouts []Blackout         `json:"blackouts"`
+	Weekdays  []string           `json:"-"`
+}
+
+// blackoutRequest — новая блокировка; начало и конец задаются по часовому поясу ресторана
+type blackoutRequest struct {
+	Start  string `json:"start" schema:"required,format=datetime-local"`
+	End    string `json:"end" schema:"required,format=datetime-local"`
+	Reason string `json:"reason"`
+}
+
+func handleAdminHours(w http.ResponseWriter, r *http.Request) {
+	var data scheduleView
+
+	restaurantID := currentRestaurant(r).ID
+	var err error
+	if data.Weekly, err = db.GetOpeningHours(restaurantID); err == nil {
+		if data.Overrides, err = db.GetScheduleOverrides(restaurantID, restaurantToday().Format("2006-01-02")); err == nil {
+			if data.Holidays, err = db.GetHolidays(restaurantID); err == nil {
+				data.Blackouts, err = db.GetBlackouts(restaurantID, time.Now())
+			}
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении расписания", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	data.Weekdays = weekdayNames
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(r, "templates/admin/hours.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона hours.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона hours.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	}
+}
+
+func handleCreateScheduleItem(w http.ResponseWriter, r *http.Request) {
+	kind := mux.Vars(r)["kind"]
+	restaurantID := currentRestaurant(r).ID
+
+	var item interface{}
+	var err error
+	switch kind {
+	case "weekly":
+		var p OpeningPeriod
+		if err = json.NewDecoder(r.Body).Decode(&p); err != nil {
+			break
+		}
+		if p.Weekday < 0 || p.Weekday > 6 {
+			http.Error(w, "Неверный день недели", http.StatusBadRequest)
+			return
+		}
+		if err := validatePeriod(p.Open, p.Close); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.RestaurantID = restaurantID
+		err = db.CreateOpeningPeriod(&p)
+		item = p
+	case "overrides":
+		var o ScheduleOverride
+		if err = json.NewDecoder(r.Body).Decode(&o); err != nil {
+			break
+		}
+		if _, err := time.Parse("2006-01-02", o.Date); err != nil {
+			http.Error(w, "Неверный формат даты (должен быть YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		if err := validatePeriod(o.Open, o.Close); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		o.RestaurantID = restaurantID
+		err = db.CreateScheduleOverride(&o)
+		item = o
+	case "holidays":
+		var h Holiday
+		if err = json.NewDecoder(r.Body).Decode(&h); err != nil {
+			break
+		}
+		if _, err := time.Parse("2006-01-02", h.Date); err != nil {
+			http.Error(w, "Неверный формат даты (должен быть YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		h.RestaurantID = restaurantID
+		err = db.CreateHoliday(&h)
+		item = h
+	case "blackouts":
+		var data blackoutRequest
+		if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+			break
+		}
+		start, errStart := time.ParseInLocation("2006-01-02T15:04", data.Start, config.Location)
+		end, errEnd := time.ParseInLocation("2006-01-02T15:04", data.End, config.Location)
+		if errStart != nil || errEnd != nil {
+			http.Error(w, "Неверный формат даты и времени (должен быть YYYY-MM-DDTHH:MM)", http.StatusBadRequest)
+			return
+		}
+		if !end.After(start) {
+			http.Error(w, "Окончание блокировки должно быть позже начала", http.StatusBadRequest)
+			return
+		}
+		b := Blackout{RestaurantID: restaurantID, Start: start, End: end, Reason: data.Reason}
+		err = db.CreateBlackout(&b)
+		item = b
+	default:
+		http.Error(w, "Неизвестный раздел расписания", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при сохранении расписания", "kind", kind, "error", err)
+		http.Error(w, "Ошибка при сохранении расписания", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Расписание обновлено", "restaurant_id", restaurantID, "kind", kind)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+func handleDeleteScheduleItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var id int
+	if _, err := fmt.Sscanf(vars["id"], "%d", &id); err != nil {
+		http.Error(w, "Неверный формат ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteScheduleItem(currentRestaurant(r).ID, vars["kind"], id); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при удалении расписания", "kind", vars["kind"], "id", id, "error", err)
+		if errors.Is(err, errScheduleItemNotFound) {
+			http.Error(w, "Запись расписания не найдена", http.StatusNotFound)
+		} else {
+			http.Error(w, "Ошибка при удалении расписания", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Запись расписания удалена",
+	})
+}
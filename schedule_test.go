@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckSlot(t *testing.T) {
+	date := "2026-10-20"
+	blackoutStart, _ := bookingStart(date, "20:00")
+	blackoutEnd, _ := bookingStart(date, "21:00")
+	open := DaySchedule{
+		Date: date,
+		Periods: []ServicePeriod{
+			{Name: "Ночь", Open: "00:00", Close: "02:00"},
+			{Name: "Обед", Open: "12:00", Close: "16:00"},
+			{Name: "Ужин", Open: "18:00", Close: "01:00"},
+		},
+		Blackouts: []Blackout{{Start: blackoutStart, End: blackoutEnd, Reason: "банкет"}},
+	}
+
+	tests := []struct {
+		name     string
+		schedule DaySchedule
+		time     string
+		want     string // Reason ошибки; пусто — время подходит
+	}{
+		{"в часы работы", open, "12:00", ""},
+		{"визит заканчивается к закрытию", open, "14:00", ""},
+		{"визит заканчивается после полуночи", open, "23:00", ""},
+		{"визит не успевает до закрытия", open, "23:30", "outside_hours"},
+		{"продолжение ночного периода", open, "00:00", ""},
+		{"между периодами", open, "16:30", "outside_hours"},
+		{"пересекает блокировку", open, "19:00", "blackout"},
+		{"сразу после блокировки", open, "21:00", ""},
+		{"праздник", DaySchedule{Date: date, Closed: true, Reason: "Новый год"}, "12:00", "holiday"},
+		{"выходной", DaySchedule{Date: date}, "12:00", "closed_day"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.checkSlot(tt.time, 2*time.Hour)
+			got := ""
+			if bookingErr, ok := err.(*BookingError); ok {
+				got = bookingErr.Reason
+			} else if err != nil {
+				t.Fatalf("checkSlot(%s): %v", tt.time, err)
+			}
+			if got != tt.want {
+				t.Errorf("checkSlot(%s) = %q, ожидалось %q", tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlotTimes(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule DaySchedule
+		interval time.Duration
+		want     []string
+	}{
+		{"визит укладывается в период", DaySchedule{Periods: []ServicePeriod{{Open: "12:00", Close: "15:00"}}}, time.Hour, []string{"12:00", "13:00"}},
+		{"ночной период без времени после полуночи", DaySchedule{Periods: []ServicePeriod{{Open: "22:00", Close: "02:00"}}}, time.Hour, []string{"22:00", "23:00"}},
+		{"продолжение ночного периода", DaySchedule{Periods: []ServicePeriod{{Open: "00:00", Close: "02:30"}, {Open: "23:00", Close: "01:00"}}}, 30 * time.Minute, []string{"00:00", "00:30", "23:00"}},
+		{"пересекающиеся периоды без повторов", DaySchedule{Periods: []ServicePeriod{{Open: "12:00", Close: "15:00"}, {Open: "13:00", Close: "16:00"}}}, time.Hour, []string{"12:00", "13:00", "14:00"}},
+		{"период короче визита", DaySchedule{Periods: []ServicePeriod{{Open: "12:00", Close: "13:00"}}}, time.Hour, []string{}},
+		{"праздник", DaySchedule{Closed: true, Periods: []ServicePeriod{{Open: "12:00", Close: "15:00"}}}, time.Hour, nil},
+		{"нулевой шаг", DaySchedule{Periods: []ServicePeriod{{Open: "12:00", Close: "15:00"}}}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.slotTimes(tt.interval, 2*time.Hour); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("slotTimes = %v, ожидалось %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOvernightTails(t *testing.T) {
+	prev := DaySchedule{Periods: []ServicePeriod{
+		{Name: "Обед", Open: "12:00", Close: "16:00"},
+		{Name: "Ужин", Open: "18:00", Close: "00:00"},
+		{Name: "Бар", Open: "22:00", Close: "03:00"},
+	}}
+	want := []ServicePeriod{{Name: "Бар", Open: "00:00", Close: "03:00"}}
+	if got := overnightTails(prev); !reflect.DeepEqual(got, want) {
+		t.Errorf("overnightTails = %v, ожидалось %v", got, want)
+	}
+
+	prev.Closed = true
+	if got := overnightTails(prev); got != nil {
+		t.Errorf("overnightTails в праздник = %v, ожидалось пусто", got)
+	}
+}
+
+func TestStoreDayScheduleOvernight(t *testing.T) {
+	forEachStore(t, func(t *testing.T, rest *Restaurant) {
+		date := testDate(0)
+		day, _ := parseBookingDate(date)
+		bar := OpeningPeriod{RestaurantID: rest.ID, Weekday: int(day.Weekday()), Name: "Бар", Open: "23:00", Close: "02:00"}
+		if err := db.CreateOpeningPeriod(&bar); err != nil {
+			t.Fatal(err)
+		}
+
+		next, err := db.GetDaySchedule(rest.ID, testDate(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(next.Periods) == 0 || next.Periods[0] != (ServicePeriod{Name: "Бар", Open: "00:00", Close: "02:00"}) {
+			t.Errorf("периоды следующего дня: %v", next.Periods)
+		}
+		if err := next.checkSlot("00:00", 2*time.Hour); err != nil {
+			t.Errorf("визит после полуночи отклонен: %v", err)
+		}
+
+		holiday := Holiday{RestaurantID: rest.ID, Date: testDate(1), Name: "Праздник"}
+		if err := db.CreateHoliday(&holiday); err != nil {
+			t.Fatal(err)
+		}
+		if next, err = db.GetDaySchedule(rest.ID, testDate(1)); err != nil {
+			t.Fatal(err)
+		}
+		if !next.Closed || len(next.Periods) != 0 {
+			t.Errorf("праздник после ночного периода: %+v", next)
+		}
+	})
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Плановые уведомления; каждое ставится в очередь по бронированию не больше одного раза
+const (
+	NoticeReminder24h = "reminder_24h"
+	NoticeReminder2h  = "reminder_2h"
+	NoticeFeedback    = "feedback"
+)
+
+// Итог запуска задания
+const (
+	JobRunOK     = "ok"
+	JobRunFailed = "failed"
+)
+
+const (
+	// Ключ advisory-блокировки ведущего экземпляра планировщика
+	schedulerLockKey = 4701203
+	// Просьбу об отзыве не отправляем о давних визитах, например после первого запуска
+	feedbackWindow = 3 * 24 * time.Hour
+	// Сколько последних запусков показывать в админ-панели
+	jobRunsShown = 100
+)
+
+// Job — фоновое задание планировщика. Run возвращает число обработанных бронирований.
+type Job struct {
+	Name  string
+	Title string
+	Run   func(now time.Time) (int, error)
+}
+
+// JobRun — запись о запуске задания
+type JobRun struct {
+	ID         int       `json:"id"`
+	Job        string    `json:"job"`
+	Instance   string    `json:"instance"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Status     string    `json:"status"`
+	Processed  int       `json:"processed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// JobStore — выборки для фоновых заданий, выбор ведущего экземпляра и история запусков
+type JobStore interface {
+	// AcquireJobLeadership сообщает, ведущий ли этот экземпляр; задания выполняет только ведущий
+	AcquireJobLeadership(ctx context.Context) (bool, error)
+	ReleaseJobLeadership()
+
+	// EnqueueReminders ставит напоминание notice о подтвержденных бронированиях,
+	// которые начинаются в промежутке (from, to]
+	EnqueueReminders(notice string, from, to time.Time) (int, error)
+	// EnqueueFeedback ставит просьбу об отзыве о визитах, завершенных в промежутке (from, to]
+	EnqueueFeedback(from, to time.Time) (int, error)
+	// StalePendingBookings возвращает неподтвержденные бронирования, созданные не позже createdBefore
+	// или с началом визита не позже startsBefore
+	StalePendingBookings(createdBefore, startsBefore time.Time) ([]int, error)
+
+	RecordJobRun(run *JobRun) error
+	GetJobRuns(limit int) ([]JobRun, error)
+	DeleteJobRuns(before time.Time) error
+}
+
+var schedulerJobs = []Job{
+	{
+		Name:  NoticeReminder24h,
+		Title: "Напоминание за 24 часа",
+		Run: func(now time.Time) (int, error) {
+			// Кто бронирует меньше чем за 2 часа, получит только второе напоминание
+			return db.EnqueueReminders(NoticeReminder24h, now.Add(2*time.Hour), now.Add(24*time.Hour))
+		},
+	},
+	{
+		Name:  NoticeReminder2h,
+		Title: "Напоминание за 2 часа",
+		Run: func(now time.Time) (int, error) {
+			return db.EnqueueReminders(NoticeReminder2h, now, now.Add(2*time.Hour))
+		},
+	},
+	{
+		Name:  "expire_pending",
+		Title: "Истечение неподтвержденных бронирований",
+		Run:   expirePendingBookings,
+	},
+	{
+		Name:  NoticeFeedback,
+		Title: "Просьба об отзыве",
+		Run: func(now time.Time) (int, error) {
+			to := now.Add(-config.FeedbackDelay)
+			return db.EnqueueFeedback(to.Add(-feedbackWindow), to)
+		},
+	},
+	{
+		Name:  "waitlist_offers",
+		Title: "Лист ожидания: истекшие заявки и предложения",
+		Run: func(now time.Time) (int, error) {
+			return db.ExpireWaitlist(now)
+		},
+	},
+}
+
+// expirePendingBookings переводит в статус «Истекло» бронирования, которые не подтвердили
+// за PendingTTL или до начала визита. Как и при отмене, гостю уходит уведомление,
+// а освободившееся место предлагается листу ожидания.
+func expirePendingBookings(now time.Time) (int, error) {
+	ids, err := db.StalePendingBookings(now.Add(-config.PendingTTL), now)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, id := range ids {
+		err := db.UpdateBookingStatus(id, StatusPending, StatusExpired, systemActor)
+		if errors.Is(err, ErrStatusChanged) {
+			// Бронирование успели подтвердить или отменить
+			continue
+		}
+		if err != nil {
+			return expired, fmt.Errorf("бронирование %d: %v", id, err)
+		}
+		recordBookingStatus(StatusExpired)
+		expired++
+	}
+	return expired, nil
+}
+
+// instanceName — имя экземпляра сервера в истории запусков
+var instanceName = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + ":" + strconv.Itoa(os.Getpid())
+}()
+
+// runJobs выполняет все задания по одному разу и записывает их результат
+func runJobs(now time.Time) {
+	for _, job := range schedulerJobs {
+		run := JobRun{Job: job.Name, Instance: instanceName, StartedAt: time.Now(), Status: JobRunOK}
+		processed, err := job.Run(now)
+		run.FinishedAt = time.Now()
+		run.Processed = processed
+		if err != nil {
+			run.Status = JobRunFailed
+			run.Error = err.Error()
+			slog.Error("Ошибка задания", "job", job.Name, "error", err)
+		} else if processed > 0 {
+			slog.Info("Задание выполнено", "job", job.Name, "processed", processed)
+		}
+		if err := db.RecordJobRun(&run); err != nil {
+			slog.Error("Ошибка записи истории задания", "job", job.Name, "error", err)
+		}
+	}
+
+	if err := db.DeleteJobRuns(now.Add(-config.JobHistoryRetention)); err != nil {
+		slog.Error("Ошибка очистки истории заданий", "error", err)
+	}
+}
+
+// runScheduler раз в SchedulerInterval выполняет задания, если этот экземпляр ведущий
+func runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(config.SchedulerInterval)
+	defer ticker.Stop()
+	defer db.ReleaseJobLeadership()
+
+	leading := false
+	for {
+		ok, err := db.AcquireJobLeadership(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Ошибка выбора ведущего планировщика", "error", err)
+		}
+		if ok != leading {
+			if ok {
+				slog.InfoContext(ctx, "Экземпляр выполняет фоновые задания", "instance", instanceName)
+			} else {
+				slog.InfoContext(ctx, "Экземпляр больше не выполняет фоновые задания", "instance", instanceName)
+			}
+			leading = ok
+		}
+		if ok {
+			runJobs(time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AcquireJobLeadership удерживает advisory-блокировку на отдельном соединении: пока оно живо,
+// остальные экземпляры задания не выполняют. Если соединение оборвалось, блокировка снята
+// сервером, и ведущим станет тот, кто захватит ее первым. SQLite работает в одном процессе.
+func (db *Database) AcquireJobLeadership(ctx context.Context) (bool, error) {
+	if db.driver == DriverSQLite {
+		return true, nil
+	}
+
+	db.leaderMu.Lock()
+	defer db.leaderMu.Unlock()
+
+	if db.leaderConn != nil {
+		if _, err := db.leaderConn.ExecContext(ctx, `SELECT 1`); err == nil {
+			return true, nil
+		}
+		db.leaderConn.Close()
+		db.leaderConn = nil
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, schedulerLockKey).Scan(&locked); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !locked {
+		conn.Close()
+		return false, nil
+	}
+	db.leaderConn = conn
+	return true, nil
+}
+
+func (db *Database) ReleaseJobLeadership() {
+	db.leaderMu.Lock()
+	defer db.leaderMu.Unlock()
+
+	if db.leaderConn == nil {
+		return
+	}
+	db.leaderConn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, schedulerLockKey)
+	db.leaderConn.Close()
+	db.leaderConn = nil
+}
+
+// enqueueNotices отмечает плановое уведомление notice для бронирований из запроса и ставит его в очередь.
+// Отметка с уникальным ключом не дает отправить его дважды, даже если задания выполнятся параллельно.
+func (db *Database) enqueueNotices(notice, kind, query string, args ...interface{}) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка выборки бронирований: %v", err)
+	}
+	var bookings []Booking
+	for rows.Next() {
+		var b Booking
+		if err := scanBooking(rows, &b); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		bookings = append(bookings, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range bookings {
+		result, err := tx.Exec(`
+			INSERT INTO booking_notices (booking_id, notice) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, bookings[i].ID, notice)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка отметки уведомления: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		if err := enqueueNotifications(tx, kind, &bookings[i]); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, tx.Commit()
+}
+
+func (db *Database) EnqueueReminders(notice string, from, to time.Time) (int, error) {
+	defer observeQuery("EnqueueReminders", time.Now())
+	return db.enqueueNotices(notice, NotifyReminder, `
+		SELECT `+bookingColumns+`
+		FROM bookings
+		WHERE status = $1 AND starts_at > $2 AND starts_at <= $3
+			AND NOT EXISTS (SELECT 1 FROM booking_notices n WHERE n.booking_id = bookings.id AND n.notice = $4)
+		ORDER BY starts_at
+	`, StatusConfirmed, dbTime(from), dbTime(to), notice)
+}
+
+func (db *Database) EnqueueFeedback(from, to time.Time) (int, error) {
+	defer observeQuery("EnqueueFeedback", time.Now())
+	return db.enqueueNotices(NoticeFeedback, NotifyFeedback, `
+		SELECT `+bookingColumns+`
+		FROM bookings
+		WHERE status = $1 AND completed_at > $2 AND completed_at <= $3
+			AND NOT EXISTS (SELECT 1 FROM booking_notices n WHERE n.booking_id = bookings.id AND n.notice = $4)
+		ORDER BY completed_at
+	`, StatusCompleted, dbTime(from), dbTime(to), NoticeFeedback)
+}
+
+func (db *Database) StalePendingBookings(createdBefore, startsBefore time.Time) ([]int, error) {
+	defer observeQuery("StalePendingBookings", time.Now())
+	rows, err := db.Query(`
+		SELECT id FROM bookings
+		WHERE status = $1 AND (created_at <= $2 OR starts_at <= $3)
+		ORDER BY id
+	`, StatusPending, dbTime(createdBefore), dbTime(startsBefore))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выборки неподтвержденных бронирований: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (db *Database) RecordJobRun(run *JobRun) error {
+	defer observeQuery("RecordJobRun", time.Now())
+	var errMsg sql.NullString
+	if run.Error != "" {
+		errMsg = sql.NullString{String: run.Error, Valid: true}
+	}
+	return db.QueryRow(`
+		INSERT INTO job_runs (job, instance, started_at, finished_at, status, processed, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, run.Job, run.Instance, dbTime(run.StartedAt), dbTime(run.FinishedAt), run.Status, run.Processed, errMsg).Scan(&run.ID)
+}
+
+func (db *Database) GetJobRuns(limit int) ([]JobRun, error) {
+	defer observeQuery("GetJobRuns", time.Now())
+	rows, err := db.Query(`
+		SELECT id, job, instance, started_at, finished_at, status, processed, COALESCE(error, '')
+		FROM job_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении истории заданий: %v", err)
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		var run JobRun
+		if err := rows.Scan(&run.ID, &run.Job, &run.Instance, &run.StartedAt, &run.FinishedAt,
+			&run.Status, &run.Processed, &run.Error); err != nil {
+			return nil, err
+		}
+		run.StartedAt = run.StartedAt.In(config.Location)
+		run.FinishedAt = run.FinishedAt.In(config.Location)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (db *Database) DeleteJobRuns(before time.Time) error {
+	defer observeQuery("DeleteJobRuns", time.Now())
+	_, err := db.Exec(`DELETE FROM job_runs WHERE started_at < $1`, dbTime(before))
+	return err
+}
+
+func handleAdminJobs(w http.ResponseWriter, r *http.Request) {
+	runs, err := db.GetJobRuns(jobRunsShown)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении истории заданий", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runs)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(r, "templates/admin/jobs.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона jobs.html", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	titles := make(map[string]string, len(schedulerJobs))
+	for _, job := range schedulerJobs {
+		titles[job.Name] = job.Title
+	}
+	data := struct {
+		Jobs     []Job
+		Titles   map[string]string
+		Runs     []JobRun
+		Interval time.Duration
+	}{schedulerJobs, titles, runs, config.SchedulerInterval}
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона jobs.html", "error", err)
+		writeInternalError(w, r)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Список бронирований в админ-панели и API листается страницами по ключу (keyset):
+// курсор хранит значение поля сортировки и ID последней строки страницы, а следующая
+// страница начинается строго после них. В отличие от OFFSET, скорость не падает с ростом
+// номера страницы, а новые бронирования не сдвигают уже показанные строки.
+
+const (
+	defaultBookingPageSize = 50
+	maxBookingPageSize     = 200
+	defaultBookingSort     = "-starts_at"
+)
+
+// bookingSortFields — поля, по которым можно сортировать список, и их подписи в форме фильтров
+var bookingSortFields = []struct{ Field, Title string }{
+	{"starts_at", "Время визита"},
+	{"created_at", "Время создания"},
+	{"guests", "Количество гостей"},
+	{"name", "Имя гостя"},
+}
+
+// BookingQuery — фильтры, сортировка и страница списка бронирований
+type BookingQuery struct {
+	// Визит и создание в полуинтервалах [From, To); нулевое время — без ограничения
+	From, To               time.Time
+	CreatedFrom, CreatedTo time.Time
+
+	Statuses             []string
+	GuestsMin, GuestsMax int // 0 — без ограничения
+
+	// Search ищет подстроку в имени, телефоне и комментарии; Phone и Name — только в своем поле
+	Search      string
+	Phone, Name string
+
+	// Sort — поле из bookingSortFields, "-" в начале — по убыванию
+	Sort   string
+	Limit  int // 0 — все строки
+	Cursor *bookingCursor
+}
+
+// BookingPage — страница списка; NextCursor пуст на последней странице
+type BookingPage struct {
+	Bookings   []Booking
+	NextCursor string
+}
+
+// bookingCursor — место, с которого продолжается список: значение поля сортировки и ID строки
+type bookingCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// sortField возвращает поле сортировки и направление
+func (q BookingQuery) sortField() (field string, desc bool) {
+	sort := q.Sort
+	if sort == "" {
+		sort = defaultBookingSort
+	}
+	return strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+}
+
+// searchDigits — цифры из строки поиска для сравнения с телефоном, который хранится только цифрами.
+// Пусто, если в строке есть что-то кроме цифр и знаков записи номера: иначе «Гость2» совпал бы
+// с каждым телефоном, где есть двойка
+func (q BookingQuery) searchDigits() string {
+	var digits strings.Builder
+	for _, r := range q.Search {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case strings.ContainsRune(" +-()", r):
+		default:
+			return ""
+		}
+	}
+	return digits.String()
+}
+
+// bookingSortValue — значение поля сортировки бронирования в виде строки для курсора
+func bookingSortValue(b *Booking, field string) string {
+	switch field {
+	case "created_at":
+		return b.Created.UTC().Format(time.RFC3339Nano)
+	case "guests":
+		return b.Guests
+	case "name":
+		return b.Name
+	}
+	return b.StartsAt.UTC().Format(time.RFC3339Nano)
+}
+
+// nextCursor возвращает курсор после последнего бронирования страницы
+func (q BookingQuery) nextCursor(last *Booking) string {
+	data, _ := json.Marshal(q.cursorAfter(last))
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorAfter — курсор, с которого продолжается список после бронирования last
+func (q BookingQuery) cursorAfter(last *Booking) *bookingCursor {
+	field, _ := q.sortField()
+	sort := q.Sort
+	if sort == "" {
+		sort = defaultBookingSort
+	}
+	return &bookingCursor{Sort: sort, Value: bookingSortValue(last, field), ID: last.ID}
+}
+
+// decodeBookingCursor разбирает курсор; он действителен только для той же сортировки
+func decodeBookingCursor(raw, sort string) (*bookingCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("неверный курсор")
+	}
+	var cursor bookingCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID <= 0 {
+		return nil, fmt.Errorf("неверный курсор")
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("курсор получен для другой сортировки")
+	}
+	field := strings.TrimPrefix(sort, "-")
+	switch field {
+	case "starts_at", "created_at":
+		if _, err := time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+			return nil, fmt.Errorf("неверный курсор")
+		}
+	case "guests":
+		if _, err := strconv.Atoi(cursor.Value); err != nil {
+			return nil, fmt.Errorf("неверный курсор")
+		}
+	}
+	return &cursor, nil
+}
+
+// parseBookingQuery читает параметры списка бронирований:
+//
+//	from, to                 — даты визита включительно (date — прежний фильтр на один день)
+//	created_from, created_to — даты создания включительно
+//	status                   — статусы через запятую или несколько параметров status
+//	guests_min, guests_max   — размер компании
+//	q                        — поиск по имени, телефону и комментарию; phone, name — по одному полю
+//	sort                     — starts_at, created_at, guests, name; "-" в начале — по убыванию
+//	limit, cursor            — размер страницы и курсор из next_cursor предыдущей страницы
+func parseBookingQuery(values url.Values) (BookingQuery, error) {
+	q := BookingQuery{
+		Search: strings.TrimSpace(values.Get("q")),
+		Phone:  strings.TrimSpace(values.Get("phone")),
+		Name:   strings.TrimSpace(values.Get("name")),
+		Sort:   defaultBookingSort,
+		Limit:  defaultBookingPageSize,
+	}
+
+	var err error
+	if date := values.Get("date"); date != "" {
+		if q.From, q.To, err = dayRange("date", date, date); err != nil {
+			return q, err
+		}
+	}
+	if from, to := values.Get("from"), values.Get("to"); from != "" || to != "" {
+		if q.From, q.To, err = dayRange("from/to", from, to); err != nil {
+			return q, err
+		}
+	}
+	if q.CreatedFrom, q.CreatedTo, err = dayRange("created_from/created_to", values.Get("created_from"), values.Get("created_to")); err != nil {
+		return q, err
+	}
+
+	for _, raw := range values["status"] {
+		for _, status := range strings.Split(raw, ",") {
+			status = strings.TrimSpace(status)
+			if status == "" {
+				continue
+			}
+			if !validStatus(status) {
+				return q, fmt.Errorf("неизвестный статус: %s", status)
+			}
+			if !containsStatus(q.Statuses, status) {
+				q.Statuses = append(q.Statuses, status)
+			}
+		}
+	}
+
+	if q.GuestsMin, err = positiveParam(values, "guests_min"); err != nil {
+		return q, err
+	}
+	if q.GuestsMax, err = positiveParam(values, "guests_max"); err != nil {
+		return q, err
+	}
+	if q.GuestsMin > 0 && q.GuestsMax > 0 && q.GuestsMin > q.GuestsMax {
+		return q, fmt.Errorf("guests_min больше guests_max")
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		field := strings.TrimPrefix(sort, "-")
+		known := false
+		for _, f := range bookingSortFields {
+			known = known || f.Field == field
+		}
+		if !known {
+			return q, fmt.Errorf("неизвестное поле сортировки: %s", field)
+		}
+		q.Sort = sort
+	}
+
+	if limit, err := positiveParam(values, "limit"); err != nil {
+		return q, err
+	} else if limit > 0 {
+		q.Limit = min(limit, maxBookingPageSize)
+	}
+
+	if raw := values.Get("cursor"); raw != "" {
+		if q.Cursor, err = decodeBookingCursor(raw, q.Sort); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// dayRange переводит даты from и to (включительно, любая может быть пустой) в полуинтервал
+// по часовому поясу ресторана
+func dayRange(param, from, to string) (start, end time.Time, err error) {
+	if from != "" {
+		if start, err = time.ParseInLocation("2006-01-02", from, config.Location); err != nil {
+			return start, end, fmt.Errorf("неверный формат даты в %s (должен быть YYYY-MM-DD)", param)
+		}
+	}
+	if to != "" {
+		day, err := time.ParseInLocation("2006-01-02", to, config.Location)
+		if err != nil {
+			return start, end, fmt.Errorf("неверный формат даты в %s (должен быть YYYY-MM-DD)", param)
+		}
+		end = day.AddDate(0, 0, 1)
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return start, end, fmt.Errorf("начало периода %s позже конца", param)
+	}
+	return start, end, nil
+}
+
+func positiveParam(values url.Values, name string) (int, error) {
+	raw := values.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s должен быть положительным целым числом", name)
+	}
+	return n, nil
+}
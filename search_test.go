@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestDecodeBookingCursor(t *testing.T) {
+	starts := time.Date(2026, 10, 20, 19, 0, 0, 0, time.UTC)
+	last := &Booking{ID: 42, Name: "Анна", Guests: "4", StartsAt: starts, Created: starts.Add(-time.Hour)}
+	for _, field := range bookingSortFields {
+		for _, sort := range []string{field.Field, "-" + field.Field} {
+			q := BookingQuery{Sort: sort}
+			cursor, err := decodeBookingCursor(q.nextCursor(last), sort)
+			if err != nil {
+				t.Errorf("%s: %v", sort, err)
+				continue
+			}
+			if *cursor != *q.cursorAfter(last) {
+				t.Errorf("%s: курсор %+v, ожидался %+v", sort, cursor, q.cursorAfter(last))
+			}
+		}
+	}
+
+	encode := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+	invalid := []struct {
+		name, raw, sort string
+	}{
+		{"не base64", "%%%", "name"},
+		{"не JSON", encode("cursor"), "name"},
+		{"без ID", encode(`{"s":"name","v":"Анна"}`), "name"},
+		{"другая сортировка", encode(`{"s":"name","v":"Анна","id":1}`), "-name"},
+		{"неверное время", encode(`{"s":"-starts_at","v":"вчера","id":1}`), "-starts_at"},
+		{"неверное число гостей", encode(`{"s":"guests","v":"много","id":1}`), "guests"},
+	}
+	for _, tt := range invalid {
+		if cursor, err := decodeBookingCursor(tt.raw, tt.sort); err == nil {
+			t.Errorf("%s: курсор принят: %+v", tt.name, cursor)
+		}
+	}
+}
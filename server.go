@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shuttingDown выставляется в начале остановки: /readyz отвечает 503, и балансировщик
+// перестает направлять новые запросы, пока текущие дорабатывают
+var shuttingDown atomic.Bool
+
+// newServer создает HTTP-сервер с таймаутами из конфигурации. Без них медленный
+// или зависший клиент держит соединение и горутину сколько угодно.
+// Каждому запросу присваивается идентификатор, который попадает в журнал и в ответ.
+func newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              config.ListenAddr,
+		Handler:           requestIDMiddleware(handler),
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		ReadHeaderTimeout: config.HTTPReadTimeout,
+		ReadTimeout:       config.HTTPReadTimeout,
+		WriteTimeout:      config.HTTPWriteTimeout,
+		IdleTimeout:       config.HTTPIdleTimeout,
+	}
+}
+
+// serve обслуживает запросы до отмены ctx (SIGINT/SIGTERM) или ошибки сервера.
+// При остановке новые соединения не принимаются, а начатые запросы дорабатывают
+// не дольше ShutdownTimeout.
+func serve(ctx context.Context, srv *http.Server) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		if config.TLSCertFile != "" {
+			slog.Info("Сервер запущен", "addr", "https://"+config.ListenAddr)
+			serverErr <- srv.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			slog.Info("Сервер запущен", "addr", "http://"+config.ListenAddr)
+			serverErr <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Получен сигнал остановки, завершаем текущие запросы", "timeout", config.ShutdownTimeout.String())
+	shuttingDown.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("не все запросы завершились за %s: %v", config.ShutdownTimeout, err)
+	}
+	return nil
+}
+
+// waitBackground ждет завершения фоновых заданий после отмены их контекста, но не дольше timeout
+func waitBackground(wg *sync.WaitGroup, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Warn("Фоновые задания не завершились вовремя", "timeout", timeout.String())
+	}
+}
+
+// handleHealthz — проверка живости: процесс запущен и отвечает на запросы
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadyz — проверка готовности: хранилище доступно и схема обновлена до последней миграции.
+// Во время остановки сервер сообщает, что не готов принимать запросы.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if shuttingDown.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+	if err := db.Ready(ctx); err != nil {
+		slog.ErrorContext(r.Context(), "Проверка готовности не пройдена", "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		// Причина остается в журнале: эндпоинт открыт без входа, а текст ошибки может содержать адрес базы
+		json.NewEncoder(w).Encode(map[string]string{"status": "not_ready"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Сколько ждать ответа базы при проверке готовности
+const readyCheckTimeout = 2 * time.Second
+
+// Ready проверяет соединение с базой и то, что применены все встроенные миграции
+func (db *Database) Ready(ctx context.Context) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("база данных недоступна: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.PingContext(ctx); err != nil {
+		return fmt.Errorf("база данных недоступна: %v", err)
+	}
+
+	migrations, err := loadMigrations(db.migrationsDir())
+	if err != nil {
+		return err
+	}
+	applied, err := appliedVersions(conn)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			return fmt.Errorf("не применена миграция %04d_%s", m.Version, m.Name)
+		}
+	}
+	return nil
+}
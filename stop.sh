@@ -1,10 +1,21 @@
 #!/bin/bash
 
 echo "Остановка приложения DineBook..."
-pkill -f dinebook-go
 
-if [ $? -eq 0 ]; then
-    echo "Приложение успешно остановлено"
-else
+# SIGTERM: сервер дорабатывает начатые запросы и фоновые задания (до shutdown_timeout)
+if ! pkill -TERM -f dinebook-go; then
     echo "Приложение не было запущено"
-fi 
\ No newline at end of file
+    exit 0
+fi
+
+# Ждем завершения процесса, при зависании останавливаем принудительно
+for _ in $(seq 1 35); do
+    if ! pgrep -f dinebook-go > /dev/null; then
+        echo "Приложение успешно остановлено"
+        exit 0
+    fi
+    sleep 1
+done
+
+echo "Приложение не завершилось вовремя, принудительная остановка"
+pkill -KILL -f dinebook-go
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Драйверы хранилища, из которых выбирает Config.DBDriver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
+// errUniqueViolation возвращают хранилища без SQL-базы, когда запись нарушила бы уникальность
+var errUniqueViolation = errors.New("запись с такими данными уже существует")
+
+// BookingStore — бронирования, их история и ссылки управления для гостей
+type BookingStore interface {
+	CreateBooking(booking *Booking, actor BookingActor) error
+	UpdateBooking(booking *Booking, changes BookingChanges, actor BookingActor) error
+	UpdateBookingStatus(id int, from, to string, actor BookingActor) error
+	SearchBookings(restaurantID int, q BookingQuery) (*BookingPage, error)
+	GetBookingByID(id int) (*Booking, error)
+	GetBookingByToken(token string) (*Booking, error)
+	CheckBookingToken(id int, token string) (bool, error)
+	GetBookingEvents(bookingID int) ([]BookingEvent, error)
+	CheckExistingBooking(restaurantID int, phone, date string) (bool, error)
+	CheckPhoneNameUnique(phone, name string) (bool, error)
+	TableOccupancies(restaurantID int, from, to time.Time, excludeID int) ([]tableOccupancy, error)
+}
+
+// UserStore — учетные записи сотрудников, их рестораны и сессии
+type UserStore interface {
+	CreateAdminUser(username, password string) error
+	AuthenticateUser(username, password string) (*User, error)
+	GetUsers() ([]User, error)
+	GetUserByID(id int) (*User, error)
+	CreateUser(username, password string, role Role) (*User, error)
+	UpdateUser(u *User) error
+	SetUserRestaurants(userID int, restaurantIDs []int) error
+	SetUserPassword(id int, password string) error
+	CountActiveOwners() (int, error)
+
+	CreateSession(userID int, ip, userAgent string, ttl time.Duration) (string, time.Time, error)
+	GetSessionUser(token string) (*User, error)
+	DeleteSession(token string) error
+	DeleteUserSessions(userID int) error
+	DeleteExpiredSessions() error
+
+	// Личная ссылка сотрудника на ленту календаря; новый токен заменяет прежний
+	CreateCalendarToken(userID int) (string, error)
+	DeleteCalendarToken(userID int) error
+	GetCalendarUser(token string) (*User, error)
+}
+
+// TableStore — схема зала ресторана
+type TableStore interface {
+	GetTables(restaurantID int) ([]Table, error)
+	CreateTable(t *Table) error
+	UpdateTable(t *Table) error
+	DeleteTable(restaurantID, id int) error
+	EnsureDefaultTables(restaurantID int, tables []Table) error
+}
+
+// ScheduleStore — часы работы, особые дни, праздники и блокировки ресторана
+type ScheduleStore interface {
+	GetDaySchedule(restaurantID int, date string) (DaySchedule, error)
+	GetOpeningHours(restaurantID int) ([]OpeningPeriod, error)
+	CreateOpeningPeriod(p *OpeningPeriod) error
+	EnsureDefaultOpeningHours(restaurantID int, open, close string) error
+	GetScheduleOverrides(restaurantID int, from string) ([]ScheduleOverride, error)
+	CreateScheduleOverride(o *ScheduleOverride) error
+	GetHolidays(restaurantID int) ([]Holiday, error)
+	CreateHoliday(h *Holiday) error
+	GetBlackouts(restaurantID int, after time.Time) ([]Blackout, error)
+	CreateBlackout(b *Blackout) error
+	DeleteScheduleItem(restaurantID int, kind string, id int) error
+}
+
+// Store — все данные приложения. Реализации: Database (PostgreSQL или SQLite) и MemoryStore.
+type Store interface {
+	RestaurantStore
+	BookingStore
+	UserStore
+	TableStore
+	ScheduleStore
+	NotificationStore
+	JobStore
+	WaitlistStore
+	// Ready проверяет, что хранилище доступно и готово обслуживать запросы
+	Ready(ctx context.Context) error
+	Close() error
+}
+
+// NewStore открывает хранилище, выбранное в конфигурации
+func NewStore(config *Config) (Store, error) {
+	var db *Database
+	var err error
+	switch config.DBDriver {
+	case "", DriverPostgres:
+		db, err = NewDatabase(config)
+	case DriverSQLite:
+		db, err = NewSQLiteDatabase(config.SQLitePath)
+	case DriverMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("неизвестный драйвер хранилища: %s (ожидается postgres, sqlite или memory)", config.DBDriver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
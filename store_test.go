@@ -0,0 +1,448 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	config = defaultConfig()
+	if err := config.LoadLocation(); err != nil {
+		panic(err)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// staffActor — изменения из тестов записываются в историю как действия администратора
+var staffActor = BookingActor{Channel: ChannelAdmin}
+
+// forEachStore запускает сценарий на хранилище в памяти и на SQLite во временном файле.
+// Как при первом запуске, в хранилище создаются ресторан, часы работы и столики по умолчанию.
+func forEachStore(t *testing.T, run func(t *testing.T, rest *Restaurant)) {
+	for _, driver := range []string{DriverMemory, DriverSQLite} {
+		t.Run(driver, func(t *testing.T) {
+			var store Store = NewMemoryStore()
+			if driver == DriverSQLite {
+				sqlite, err := NewSQLiteDatabase(filepath.Join(t.TempDir(), "test.db"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := sqlite.MigrateUp(); err != nil {
+					t.Fatal(err)
+				}
+				store = sqlite
+			}
+			t.Cleanup(func() { store.Close() })
+			db = store
+
+			initial := defaultRestaurantSettings()
+			if err := db.EnsureDefaultRestaurant(&initial); err != nil {
+				t.Fatal(err)
+			}
+			rest, err := defaultRestaurant()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.EnsureDefaultOpeningHours(rest.ID, config.OpeningTime, config.ClosingTime); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.EnsureDefaultTables(rest.ID, config.DefaultTables); err != nil {
+				t.Fatal(err)
+			}
+			run(t, rest)
+		})
+	}
+}
+
+// testDate — дата через неделю, чтобы визиты были в будущем
+func testDate(days int) string {
+	return restaurantToday().AddDate(0, 0, 7+days).Format("2006-01-02")
+}
+
+func testBooking(rest *Restaurant, name, phone, date, timeStr, guests string) *Booking {
+	return &Booking{
+		Name:         name,
+		Phone:        phone,
+		Date:         date,
+		Time:         timeStr,
+		Guests:       guests,
+		Status:       StatusPending,
+		Duration:     rest.DiningMinutes,
+		RestaurantID: rest.ID,
+	}
+}
+
+func TestStoreCreateBooking(t *testing.T) {
+	// Шаги выполняются по порядку на одном хранилище; столики по умолчанию — defaultConfig
+	steps := []struct {
+		name       string
+		guest      string
+		phone      string
+		days       int
+		time       string
+		guests     string
+		wantTables []int
+		wantErr    error
+	}{
+		{"столик на восьмерых", "Анна", "79000000001", 0, "19:00", "8", []int{7}, nil},
+		{"второе бронирование на дату", "Анна", "79000000001", 0, "12:00", "2", nil, ErrDuplicateBooking},
+		{"номер на другое имя", "Борис", "79000000001", 1, "19:00", "2", nil, ErrPhoneNameMismatch},
+		{"объединение столиков зоны", "Вера", "79000000002", 0, "19:00", "8", []int{3, 4}, nil},
+		{"нет свободных столиков", "Глеб", "79000000003", 0, "20:00", "8", nil, ErrNoTableAvailable},
+		{"столик свободен после визита", "Глеб", "79000000003", 0, "21:00", "8", []int{7}, nil},
+	}
+
+	forEachStore(t, func(t *testing.T, rest *Restaurant) {
+		for _, step := range steps {
+			booking := testBooking(rest, step.guest, step.phone, testDate(step.days), step.time, step.guests)
+			err := db.CreateBooking(booking, staffActor)
+			if !errors.Is(err, step.wantErr) {
+				t.Fatalf("%s: ошибка %v, ожидалась %v", step.name, err, step.wantErr)
+			}
+			if err != nil {
+				continue
+			}
+			if booking.ID == 0 || booking.ManageToken == "" {
+				t.Errorf("%s: не заполнены ID или токен: %+v", step.name, booking)
+			}
+			if !reflect.DeepEqual(booking.Tables, step.wantTables) {
+				t.Errorf("%s: столики %v, ожидались %v", step.name, booking.Tables, step.wantTables)
+			}
+
+			stored, err := db.GetBookingByID(booking.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != StatusPending || stored.Guests != step.guests || !stored.StartsAt.Equal(booking.StartsAt) {
+				t.Errorf("%s: сохранено %+v", step.name, stored)
+			}
+		}
+	})
+}
+
+func TestStoreStatusTransitions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, rest *Restaurant) {
+		date := testDate(0)
+		booking := testBooking(rest, "Анна", "79000000001", date, "19:00", "2")
+		if err := db.CreateBooking(booking, staffActor); err != nil {
+			t.Fatal(err)
+		}
+		windowStart, _ := bookingStart(date, "18:00")
+		windowEnd, _ := bookingStart(date, "20:00")
+		entry := &WaitlistEntry{
+			Name: "Борис", Phone: "79000000002", Date: date, Guests: 2,
+			WindowStart: windowStart, WindowEnd: windowEnd, RestaurantID: rest.ID,
+		}
+		if err := db.CreateWaitlistEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+
+		waitlistStatus := func() *WaitlistEntry {
+			t.Helper()
+			entries, err := db.GetWaitlist(rest.ID, date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("в листе ожидания %d заявок", len(entries))
+			}
+			return &entries[0]
+		}
+
+		steps := []struct {
+			name         string
+			from, to     string
+			wantErr      error
+			wantWaitlist string
+		}{
+			{"подтверждение", StatusPending, StatusConfirmed, nil, WaitlistWaiting},
+			{"устаревший статус", StatusPending, StatusCancelled, ErrStatusChanged, WaitlistWaiting},
+			{"отмена предлагает место", StatusConfirmed, StatusCancelled, nil, WaitlistOffered},
+			{"повторная отмена", StatusConfirmed, StatusCancelled, ErrStatusChanged, WaitlistOffered},
+		}
+		for _, step := range steps {
+			err := db.UpdateBookingStatus(booking.ID, step.from, step.to, staffActor)
+			if !errors.Is(err, step.wantErr) {
+				t.Fatalf("%s: ошибка %v, ожидалась %v", step.name, err, step.wantErr)
+			}
+			if got := waitlistStatus(); got.Status != step.wantWaitlist {
+				t.Errorf("%s: заявка в статусе %s, ожидался %s", step.name, got.Status, step.wantWaitlist)
+			}
+		}
+
+		stored, err := db.GetBookingByID(booking.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != StatusCancelled || stored.ConfirmedAt == nil || stored.CancelledAt == nil {
+			t.Errorf("бронирование после переходов: %+v", stored)
+		}
+		offered := waitlistStatus()
+		if offered.OfferedStart == nil || !offered.OfferedStart.Equal(booking.StartsAt) {
+			t.Errorf("предложено время %v, ожидалось %v", offered.OfferedStart, booking.StartsAt)
+		}
+
+		events, err := db.GetBookingEvents(booking.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		if want := []string{EventCreated, EventStatusChanged, EventStatusChanged}; !reflect.DeepEqual(types, want) {
+			t.Errorf("история %v, ожидалась %v", types, want)
+		}
+	})
+}
+
+func TestStoreWaitlistOfferHoldsTable(t *testing.T) {
+	forEachStore(t, func(t *testing.T, rest *Restaurant) {
+		date := testDate(0)
+		// Пары садятся за столики 1–5 по умолчанию: пять бронирований занимают зал на 19:00
+		var first *Booking
+		for i := 1; i <= 5; i++ {
+			booking := testBooking(rest, "Гость "+strconv.Itoa(i), "7900000000"+strconv.Itoa(i), date, "19:00", "2")
+			if err := db.CreateBooking(booking, staffActor); err != nil {
+				t.Fatal(err)
+			}
+			if first == nil {
+				first = booking
+			}
+		}
+		windowStart, _ := bookingStart(date, "18:00")
+		windowEnd, _ := bookingStart(date, "20:00")
+		entry := &WaitlistEntry{
+			Name: "Борис", Phone: "79000000010", Date: date, Guests: 2,
+			WindowStart: windowStart, WindowEnd: windowEnd, RestaurantID: rest.ID,
+		}
+		if err := db.CreateWaitlistEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateBookingStatus(first.ID, StatusPending, StatusCancelled, staffActor); err != nil {
+			t.Fatal(err)
+		}
+
+		// Пока ссылка действует, освободившийся столик придержан за приглашенным гостем
+		other := testBooking(rest, "Вера", "79000000011", date, "19:00", "2")
+		if err := db.CreateBooking(other, staffActor); !errors.Is(err, ErrNoTableAvailable) {
+			t.Fatalf("бронирование на предложенное время: ошибка %v, ожидалась %v", err, ErrNoTableAvailable)
+		}
+		claim := testBooking(rest, "Борис", "79000000010", date, "19:00", "2")
+		if err := db.ClaimWaitlistOffer(entry.ID, claim, staffActor); err != nil {
+			t.Fatalf("приглашенный гость не забрал место: %v", err)
+		}
+	})
+}
+
+func TestStoreRescheduleResetsReminders(t *testing.T) {
+	forEachStore(t, func(t *testing.T, rest *Restaurant) {
+		booking := testBooking(rest, "Анна", "79000000001", testDate(0), "19:00", "2")
+		if err := db.CreateBooking(booking, staffActor); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateBookingStatus(booking.ID, StatusPending, StatusConfirmed, staffActor); err != nil {
+			t.Fatal(err)
+		}
+		booking.Status = StatusConfirmed
+
+		remind := func() int {
+			t.Helper()
+			now := time.Now()
+			n, err := db.EnqueueReminders(NoticeReminder24h, now, now.AddDate(0, 0, 30))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return n
+		}
+		steps := []struct {
+			name         string
+			time, guests string
+			want         int
+		}{
+			{"первое напоминание", "", "", 1},
+			{"напоминание не повторяется", "", "", 0},
+			{"время не изменилось", "19:00", "3", 0},
+			{"перенос на другое время", "20:00", "3", 1},
+		}
+		for _, step := range steps {
+			if step.time != "" {
+				guests, _ := strconv.Atoi(step.guests)
+				changes := BookingChanges{Date: booking.Date, Time: step.time, Guests: guests}
+				if err := db.UpdateBooking(booking, changes, staffActor); err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+			}
+			if got := remind(); got != step.want {
+				t.Errorf("%s: поставлено %d напоминаний, ожидалось %d", step.name, got, step.want)
+			}
+		}
+	})
+}
+
+func TestStoreExpirePendingBookings(t *testing.T) {
+	// Уведомления ставятся в очередь только для настроенных каналов; сами они здесь не отправляются
+	saved := notifiers
+	notifiers = map[string]Notifier{NotifyChannelSMS: nil}
+	t.Cleanup(func() { notifiers = saved })
+
+	forEachStore(t, func(t *testing.T, rest *Restaurant) {
+		date := testDate(0)
+		booking := testBooking(rest, "Анна", "79000000001", date, "19:00", "2")
+		if err := db.CreateBooking(booking, staffActor); err != nil {
+			t.Fatal(err)
+		}
+		windowStart, _ := bookingStart(date, "18:00")
+		windowEnd, _ := bookingStart(date, "20:00")
+		entry := &WaitlistEntry{
+			Name: "Борис", Phone: "79000000002", Date: date, Guests: 2,
+			WindowStart: windowStart, WindowEnd: windowEnd, RestaurantID: rest.ID,
+		}
+		if err := db.CreateWaitlistEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+
+		// Бронирование не подтвердили за PendingTTL
+		expired, err := expirePendingBookings(time.Now().Add(config.PendingTTL + time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expired != 1 {
+			t.Fatalf("истекло %d бронирований, ожидалось 1", expired)
+		}
+		stored, err := db.GetBookingByID(booking.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != StatusExpired || stored.ExpiredAt == nil {
+			t.Errorf("бронирование после истечения: %+v", stored)
+		}
+
+		entries, err := db.GetWaitlist(rest.ID, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Status != WaitlistOffered {
+			t.Errorf("освободившееся место не предложено листу ожидания: %+v", entries)
+		}
+
+		queued, err := db.ClaimNotifications(10, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var kinds []string
+		for _, n := range queued {
+			kinds = append(kinds, n.Kind)
+		}
+		if want := []string{NotifyCreated, NotifyExpired, NotifyWaitlistOffer}; !reflect.DeepEqual(kinds, want) {
+			t.Errorf("уведомления %v, ожидались %v", kinds, want)
+		}
+	})
+}
+
+func TestStoreSearchBookingsCursor(t *testing.T) {
+	// Одинаковые количества гостей и имена проверяют порядок по ID внутри равных значений
+	bookings := []struct {
+		name, phone  string
+		days         int
+		time, guests string
+	}{
+		{"Вера", "79000000001", 0, "19:00", "4"},
+		{"Анна", "79000000002", 0, "12:00", "2"},
+		{"Борис", "79000000003", 0, "21:00", "4"},
+		{"Анна", "79000000002", 1, "13:30", "1"},
+		{"Глеб", "79000000004", 1, "10:00", "2"},
+	}
+
+	forEachStore(t, func(t *testing.T, rest *Restaurant) {
+		for _, b := range bookings {
+			if err := db.CreateBooking(testBooking(rest, b.name, b.phone, testDate(b.days), b.time, b.guests), staffActor); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, field := range bookingSortFields {
+			for _, sort := range []string{field.Field, "-" + field.Field} {
+				t.Run(sort, func(t *testing.T) {
+					all, err := db.SearchBookings(rest.ID, BookingQuery{Sort: sort})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(all.Bookings) != len(bookings) || all.NextCursor != "" {
+						t.Fatalf("без страниц: %d бронирований, курсор %q", len(all.Bookings), all.NextCursor)
+					}
+					for i := 1; i < len(all.Bookings); i++ {
+						if !bookingSortedAfter(&all.Bookings[i-1], &all.Bookings[i], sort) {
+							t.Errorf("бронирование %d идет после %d", all.Bookings[i].ID, all.Bookings[i-1].ID)
+						}
+					}
+
+					var paged []Booking
+					q := BookingQuery{Sort: sort, Limit: 2}
+					for pages := 0; ; pages++ {
+						if pages > len(bookings) {
+							t.Fatal("курсор не продвигается")
+						}
+						page, err := db.SearchBookings(rest.ID, q)
+						if err != nil {
+							t.Fatal(err)
+						}
+						paged = append(paged, page.Bookings...)
+						if page.NextCursor == "" {
+							break
+						}
+						if q.Cursor, err = decodeBookingCursor(page.NextCursor, sort); err != nil {
+							t.Fatal(err)
+						}
+					}
+
+					if got, want := bookingIDs(paged), bookingIDs(all.Bookings); !reflect.DeepEqual(got, want) {
+						t.Errorf("по страницам %v, целиком %v", got, want)
+					}
+				})
+			}
+		}
+	})
+}
+
+// bookingSortedAfter сообщает, что next идет за prev при сортировке sort; равные значения — по ID в том же направлении
+func bookingSortedAfter(prev, next *Booking, sort string) bool {
+	field := strings.TrimPrefix(sort, "-")
+	var cmp int
+	switch field {
+	case "starts_at":
+		cmp = prev.StartsAt.Compare(next.StartsAt)
+	case "created_at":
+		cmp = prev.Created.Compare(next.Created)
+	case "guests":
+		a, _ := strconv.Atoi(prev.Guests)
+		b, _ := strconv.Atoi(next.Guests)
+		cmp = a - b
+	case "name":
+		cmp = strings.Compare(prev.Name, next.Name)
+	}
+	if cmp == 0 {
+		cmp = prev.ID - next.ID
+	}
+	if strings.HasPrefix(sort, "-") {
+		cmp = -cmp
+	}
+	return cmp < 0
+}
+
+func bookingIDs(bookings []Booking) []int {
+	ids := make([]int, 0, len(bookings))
+	for _, b := range bookings {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
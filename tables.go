@@ -0,0 +1,460 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Table — столик в зале ресторана
+type Table struct {
+	ID           int    `json:"id" yaml:"-"`
+	RestaurantID int    `json:"restaurant_id" yaml:"-"`
+	Number       int    `json:"number" yaml:"number"`
+	Seats        int    `json:"seats" yaml:"seats"`
+	MinParty     int    `json:"min_party" yaml:"min_party"`
+	MaxParty     int    `json:"max_party" yaml:"max_party"`
+	Zone         string `json:"zone" yaml:"zone"`
+	Combinable   bool   `json:"combinable" yaml:"combinable"`
+	Active       bool   `json:"active" yaml:"active"`
+}
+
+var ErrNoTableAvailable = errors.New("на выбранное время нет свободных столиков")
+
+var errTableNotFound = errors.New("столик не найден")
+
+func (t Table) validate() error {
+	if t.Number <= 0 {
+		return fmt.Errorf("номер столика должен быть положительным")
+	}
+	if t.Seats <= 0 {
+		return fmt.Errorf("количество мест должно быть положительным")
+	}
+	if t.MinParty <= 0 || t.MaxParty < t.MinParty {
+		return fmt.Errorf("неверный диапазон размера компании")
+	}
+	if t.MaxParty > t.Seats {
+		return fmt.Errorf("максимальный размер компании не может превышать количество мест")
+	}
+	return nil
+}
+
+// fits проверяет, можно ли посадить компанию за один этот столик
+func (t Table) fits(guests int) bool {
+	return t.Active && guests >= t.MinParty && guests <= t.MaxParty && guests <= t.Seats
+}
+
+// assignTables подбирает для компании свободный столик, а если подходящего нет —
+// группу объединяемых столиков из одной зоны. Возвращает nil, если мест нет.
+func assignTables(tables []Table, busy map[int]bool, guests int) []Table {
+	var free []Table
+	for _, t := range tables {
+		if t.Active && !busy[t.ID] {
+			free = append(free, t)
+		}
+	}
+
+	// Сначала ищем один столик с минимальным числом лишних мест
+	var best *Table
+	for i := range free {
+		t := free[i]
+		if !t.fits(guests) {
+			continue
+		}
+		if best == nil || t.Seats < best.Seats || (t.Seats == best.Seats && t.Number < best.Number) {
+			best = &free[i]
+		}
+	}
+	if best != nil {
+		return []Table{*best}
+	}
+
+	// Затем пробуем объединить столики внутри одной зоны
+	zones := make(map[string][]Table)
+	for _, t := range free {
+		if t.Combinable {
+			zones[t.Zone] = append(zones[t.Zone], t)
+		}
+	}
+
+	var bestGroup []Table
+	bestSeats := 0
+	for _, zoneTables := range zones {
+		sort.Slice(zoneTables, func(i, j int) bool {
+			if zoneTables[i].Seats != zoneTables[j].Seats {
+				return zoneTables[i].Seats > zoneTables[j].Seats
+			}
+			return zoneTables[i].Number < zoneTables[j].Number
+		})
+
+		var group []Table
+		seats := 0
+		for _, t := range zoneTables {
+			group = append(group, t)
+			seats += t.Seats
+			if seats >= guests {
+				break
+			}
+		}
+		if seats < guests || len(group) < 2 {
+			continue
+		}
+		if bestGroup == nil || len(group) < len(bestGroup) || (len(group) == len(bestGroup) && seats < bestSeats) {
+			bestGroup = group
+			bestSeats = seats
+		}
+	}
+
+	return bestGroup
+}
+
+// overlaps проверяет пересечение интервалов [start1, end1) и [start2, end2)
+func overlaps(start1, end1, start2, end2 time.Time) bool {
+	return start1.Before(end2) && start2.Before(end1)
+}
+
+func (db *Database) GetTables(restaurantID int) ([]Table, error) {
+	defer observeQuery("GetTables", time.Now())
+	return queryTables(db, restaurantID)
+}
+
+func queryTables(q queryer, restaurantID int) ([]Table, error) {
+	rows, err := q.Query(`
+		SELECT id, restaurant_id, number, seats, min_party, max_party, zone, combinable, active
+		FROM restaurant_tables
+		WHERE restaurant_id = $1
+		ORDER BY number
+	`, restaurantID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении столиков: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []Table
+	for rows.Next() {
+		var t Table
+		if err := rows.Scan(&t.ID, &t.RestaurantID, &t.Number, &t.Seats, &t.MinParty, &t.MaxParty, &t.Zone, &t.Combinable, &t.Active); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении столика: %v", err)
+		}
+		tables = append(tables, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам: %v", err)
+	}
+	return tables, nil
+}
+
+func (db *Database) CreateTable(t *Table) error {
+	defer observeQuery("CreateTable", time.Now())
+	query := `
+		INSERT INTO restaurant_tables (restaurant_id, number, seats, min_party, max_party, zone, combinable, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	return db.QueryRow(query, t.RestaurantID, t.Number, t.Seats, t.MinParty, t.MaxParty, t.Zone, t.Combinable, t.Active).Scan(&t.ID)
+}
+
+func (db *Database) UpdateTable(t *Table) error {
+	defer observeQuery("UpdateTable", time.Now())
+	query := `
+		UPDATE restaurant_tables
+		SET number = $1, seats = $2, min_party = $3, max_party = $4, zone = $5, combinable = $6, active = $7
+		WHERE id = $8 AND restaurant_id = $9
+		RETURNING id
+	`
+	err := db.QueryRow(query, t.Number, t.Seats, t.MinParty, t.MaxParty, t.Zone, t.Combinable, t.Active, t.ID, t.RestaurantID).Scan(&t.ID)
+	if err == sql.ErrNoRows {
+		return errTableNotFound
+	}
+	return err
+}
+
+// DeleteTable удаляет столик ресторана; если к нему уже привязаны бронирования, столик только деактивируется
+func (db *Database) DeleteTable(restaurantID, id int) error {
+	defer observeQuery("DeleteTable", time.Now())
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM restaurant_tables WHERE id = $1 AND restaurant_id = $2)`, id, restaurantID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errTableNotFound
+	}
+
+	var used bool
+	err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM booking_tables WHERE table_id = $1)`, id).Scan(&used)
+	if err != nil {
+		return err
+	}
+	if used {
+		_, err = db.Exec(`UPDATE restaurant_tables SET active = false WHERE id = $1`, id)
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM restaurant_tables WHERE id = $1`, id)
+	return err
+}
+
+// EnsureDefaultTables заполняет схему зала ресторана, если столики еще не заведены
+func (db *Database) EnsureDefaultTables(restaurantID int, tables []Table) error {
+	defer observeQuery("EnsureDefaultTables", time.Now())
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM restaurant_tables WHERE restaurant_id = $1`, restaurantID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	for i := range tables {
+		tables[i].RestaurantID = restaurantID
+		if err := db.CreateTable(&tables[i]); err != nil {
+			return fmt.Errorf("ошибка создания столика %d: %v", tables[i].Number, err)
+		}
+	}
+	return nil
+}
+
+// tableOccupancy — интервал, на который столик занят бронированием
+type tableOccupancy struct {
+	TableID int
+	Start   time.Time
+	End     time.Time
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (db *Database) TableOccupancies(restaurantID int, from, to time.Time, excludeID int) ([]tableOccupancy, error) {
+	defer observeQuery("TableOccupancies", time.Now())
+	return tableOccupancies(db, restaurantID, from, to, excludeID, 0)
+}
+
+// tableOccupancies возвращает занятость столиков ресторана, пересекающуюся с [from, to): активные бронирования
+// и действующие предложения из листа ожидания. Завершенные визиты освобождают столик раньше расчетного времени.
+// Бронирование excludeID не учитывается: так его можно перенести, не конфликтуя с самим собой.
+// Предложение заявки claimID тоже не учитывается: его место забирает сам приглашенный гость.
+func tableOccupancies(q queryer, restaurantID int, from, to time.Time, excludeID, claimID int) ([]tableOccupancy, error) {
+	offers, duration, err := liveOffers(q, restaurantID, from, to, claimID)
+	if err != nil {
+		return nil, err
+	}
+	// Столики под предложение подбираются по занятости на все время его визита
+	queryFrom, queryTo := from, to
+	for _, o := range offers {
+		if o.OfferedStart.Before(queryFrom) {
+			queryFrom = *o.OfferedStart
+		}
+		if end := o.OfferedStart.Add(duration); end.After(queryTo) {
+			queryTo = end
+		}
+	}
+
+	rows, err := q.Query(`
+		SELECT b.starts_at, b.ends_at, bt.table_id
+		FROM bookings b
+		JOIN booking_tables bt ON bt.booking_id = b.id
+		WHERE b.starts_at < $1 AND b.ends_at > $2 AND b.id != $3 AND b.restaurant_id = $4 AND b.status IN `+activeStatusesSQL+`
+	`, dbTime(queryTo), dbTime(queryFrom), excludeID, restaurantID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении занятых столиков: %v", err)
+	}
+	var occupancies []tableOccupancy
+	for rows.Next() {
+		var o tableOccupancy
+		if err := rows.Scan(&o.Start, &o.End, &o.TableID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка при чтении занятого столика: %v", err)
+		}
+		occupancies = append(occupancies, o)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil || len(offers) == 0 {
+		return occupancies, err
+	}
+
+	tables, err := queryTables(q, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return append(occupancies, offerHolds(offers, tables, occupancies, duration)...), nil
+}
+
+// busyAt возвращает столики, занятые в интервале [start, end)
+func busyAt(occupancies []tableOccupancy, start, end time.Time) map[int]bool {
+	busy := make(map[int]bool)
+	for _, o := range occupancies {
+		if overlaps(start, end, o.Start, o.End) {
+			busy[o.TableID] = true
+		}
+	}
+	return busy
+}
+
+func handleAdminTables(w http.ResponseWriter, r *http.Request) {
+	tables, err := db.GetTables(currentRestaurant(r).ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении столиков", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tables)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(r, "templates/admin/tables.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона tables.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, tables); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона tables.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	}
+}
+
+func handleCreateTable(w http.ResponseWriter, r *http.Request) {
+	var t Table
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+		return
+	}
+	if err := t.validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+	t.RestaurantID = currentRestaurant(r).ID
+
+	if err := db.CreateTable(&t); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при создании столика", "error", err)
+		if isUniqueViolation(err) {
+			writeError(w, r, http.StatusConflict, "duplicate_table", "Столик с таким номером уже есть в ресторане")
+		} else {
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при создании столика")
+		}
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Столик создан", "table_id", t.ID, "restaurant_id", t.RestaurantID, "number", t.Number)
+	writeCreated(w, r, t)
+}
+
+func handleUpdateTable(w http.ResponseWriter, r *http.Request) {
+	var id int
+	if _, err := fmt.Sscanf(mux.Vars(r)["id"], "%d", &id); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Неверный формат ID")
+		return
+	}
+
+	var t Table
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+		return
+	}
+	t.ID = id
+	t.RestaurantID = currentRestaurant(r).ID
+	if err := t.validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+
+	if err := db.UpdateTable(&t); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при обновлении столика", "table_id", id, "error", err)
+		switch {
+		case errors.Is(err, errTableNotFound):
+			writeError(w, r, http.StatusNotFound, "not_found", err.Error())
+		case isUniqueViolation(err):
+			writeError(w, r, http.StatusConflict, "duplicate_table", "Столик с таким номером уже есть в ресторане")
+		default:
+			writeInternalError(w, r)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+func handleDeleteTable(w http.ResponseWriter, r *http.Request) {
+	var id int
+	if _, err := fmt.Sscanf(mux.Vars(r)["id"], "%d", &id); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Неверный формат ID")
+		return
+	}
+
+	if err := db.DeleteTable(currentRestaurant(r).ID, id); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при удалении столика", "table_id", id, "error", err)
+		if errors.Is(err, errTableNotFound) {
+			writeError(w, r, http.StatusNotFound, "not_found", err.Error())
+		} else {
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при удалении столика")
+		}
+		return
+	}
+
+	writeDeleted(w, r, "Столик удален")
+}
+
+// attachTables заполняет номера столиков, назначенных бронированиям
+func (db *Database) attachTables(bookings []Booking) error {
+	index := make(map[int]int, len(bookings))
+	for i := range bookings {
+		index[bookings[i].ID] = i
+		bookings[i].Tables = nil
+	}
+
+	// Запрашиваем порциями, чтобы не упереться в лимит параметров запроса
+	const chunkSize = 500
+	for from := 0; from < len(bookings); from += chunkSize {
+		to := from + chunkSize
+		if to > len(bookings) {
+			to = len(bookings)
+		}
+
+		placeholders := make([]string, 0, to-from)
+		args := make([]interface{}, 0, to-from)
+		for i, b := range bookings[from:to] {
+			placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+			args = append(args, b.ID)
+		}
+
+		rows, err := db.Query(`
+			SELECT bt.booking_id, t.number
+			FROM booking_tables bt
+			JOIN restaurant_tables t ON t.id = bt.table_id
+			WHERE bt.booking_id IN (`+strings.Join(placeholders, ", ")+`)
+			ORDER BY t.number
+		`, args...)
+		if err != nil {
+			return fmt.Errorf("ошибка при получении столиков бронирований: %v", err)
+		}
+		for rows.Next() {
+			var bookingID, number int
+			if err := rows.Scan(&bookingID, &number); err != nil {
+				rows.Close()
+				return fmt.Errorf("ошибка при чтении столика бронирования: %v", err)
+			}
+			i := index[bookingID]
+			bookings[i].Tables = append(bookings[i].Tables, number)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("ошибка при итерации по результатам: %v", err)
+		}
+	}
+	return nil
+}
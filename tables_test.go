@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAssignTables(t *testing.T) {
+	tables := []Table{
+		{ID: 1, Number: 1, Seats: 2, MinParty: 1, MaxParty: 2, Zone: "main", Combinable: true, Active: true},
+		{ID: 2, Number: 2, Seats: 2, MinParty: 1, MaxParty: 2, Zone: "main", Combinable: true, Active: true},
+		{ID: 3, Number: 3, Seats: 4, MinParty: 2, MaxParty: 4, Zone: "main", Combinable: true, Active: true},
+		{ID: 4, Number: 4, Seats: 4, MinParty: 2, MaxParty: 4, Zone: "window", Combinable: false, Active: true},
+		{ID: 5, Number: 5, Seats: 6, MinParty: 3, MaxParty: 6, Zone: "hall", Combinable: false, Active: false},
+	}
+
+	tests := []struct {
+		name   string
+		busy   []int
+		guests int
+		want   []int
+	}{
+		{"меньший подходящий столик", nil, 2, []int{1}},
+		{"занятый столик пропускается", []int{1}, 2, []int{2}},
+		{"минимальный размер компании", nil, 1, []int{1}},
+		{"из двух одинаковых — с меньшим номером", nil, 3, []int{3}},
+		{"необъединяемый столик целиком", []int{3}, 4, []int{4}},
+		{"объединение столиков зоны", []int{4}, 6, []int{3, 1}},
+		{"неактивный столик не выдается", nil, 6, []int{3, 1}},
+		{"необъединяемые столики не объединяются", []int{1, 2}, 8, nil},
+		{"все столики заняты", []int{1, 2, 3, 4}, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			busy := map[int]bool{}
+			for _, id := range tt.busy {
+				busy[id] = true
+			}
+			var got []int
+			for _, table := range assignTables(tables, busy, tt.guests) {
+				got = append(got, table.Number)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("assignTables(%d гостей) = %v, ожидалось %v", tt.guests, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Role — роль сотрудника, определяющая доступные ему действия
+type Role string
+
+const (
+	RoleOwner    Role = "owner"
+	RoleManager  Role = "manager"
+	RoleHost     Role = "host"
+	RoleReadOnly Role = "readonly"
+)
+
+// Permission — право на группу действий в админ-панели
+type Permission string
+
+const (
+	PermViewBookings   Permission = "bookings.view"
+	PermUpdateBookings Permission = "bookings.update"
+	PermImportBookings Permission = "bookings.import"
+	PermViewSettings   Permission = "settings.view"
+	PermManageSettings Permission = "settings.manage"
+	PermManageUsers    Permission = "users.manage"
+
+	// Открывать новые рестораны сети может только владелец
+	PermManageRestaurants Permission = "restaurants.manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner:    {PermViewBookings, PermUpdateBookings, PermImportBookings, PermViewSettings, PermManageSettings, PermManageUsers, PermManageRestaurants},
+	RoleManager:  {PermViewBookings, PermUpdateBookings, PermImportBookings, PermViewSettings, PermManageSettings, PermManageUsers},
+	RoleHost:     {PermViewBookings, PermUpdateBookings, PermViewSettings},
+	RoleReadOnly: {PermViewBookings, PermViewSettings},
+}
+
+var roleTitles = map[Role]string{
+	RoleOwner:    "Владелец",
+	RoleManager:  "Менеджер",
+	RoleHost:     "Хостес",
+	RoleReadOnly: "Только просмотр",
+}
+
+var errUserNotFound = errors.New("пользователь не найден")
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (r Role) Title() string {
+	if title, ok := roleTitles[r]; ok {
+		return title
+	}
+	return string(r)
+}
+
+// Can проверяет, есть ли у пользователя право p
+func (u *User) Can(p Permission) bool {
+	if u == nil || u.Disabled {
+		return false
+	}
+	for _, granted := range rolePermissions[u.Role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess проверяет, работает ли пользователь в ресторане id. Владельцу доступны все рестораны.
+func (u *User) CanAccess(restaurantID int) bool {
+	if u == nil || u.Disabled {
+		return false
+	}
+	if u.Role == RoleOwner {
+		return true
+	}
+	for _, id := range u.Restaurants {
+		if id == restaurantID {
+			return true
+		}
+	}
+	return false
+}
+
+// sharesRestaurant сообщает, есть ли у сотрудников общий ресторан: не владельцы видят только коллег
+func (u *User) sharesRestaurant(other *User) bool {
+	if u.Role == RoleOwner {
+		return true
+	}
+	for _, id := range other.Restaurants {
+		if u.CanAccess(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// requirePermission пропускает запрос к обработчику, только если у текущего пользователя есть право p
+func requirePermission(p Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(r)
+		if !user.Can(p) {
+			username := ""
+			if user != nil {
+				username = user.Username
+			}
+			slog.WarnContext(r.Context(), "Доступ запрещен", "username", username, "permission", p, "route", routeTemplate(r))
+			writeError(w, r, http.StatusForbidden, "forbidden", "Недостаточно прав для выполнения действия")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (db *Database) GetUsers() ([]User, error) {
+	defer observeQuery("GetUsers", time.Now())
+	rows, err := db.Query(`
+		SELECT id, username, role, disabled, created_at
+		FROM users
+		ORDER BY username
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении пользователей: %v", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.Disabled, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении пользователя: %v", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ptrs := make([]*User, len(users))
+	for i := range users {
+		ptrs[i] = &users[i]
+	}
+	if err := db.attachUserRestaurants(ptrs); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// attachUserRestaurants заполняет списки ресторанов пользователей
+func (db *Database) attachUserRestaurants(users []*User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	byID := make(map[int]*User, len(users))
+	for _, u := range users {
+		u.Restaurants = []int{}
+		byID[u.ID] = u
+	}
+
+	query := `SELECT user_id, restaurant_id FROM user_restaurants ORDER BY restaurant_id`
+	var args []interface{}
+	if len(users) == 1 {
+		query = `SELECT user_id, restaurant_id FROM user_restaurants WHERE user_id = $1 ORDER BY restaurant_id`
+		args = append(args, users[0].ID)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении ресторанов пользователей: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, restaurantID int
+		if err := rows.Scan(&userID, &restaurantID); err != nil {
+			return fmt.Errorf("ошибка при чтении ресторана пользователя: %v", err)
+		}
+		if u, ok := byID[userID]; ok {
+			u.Restaurants = append(u.Restaurants, restaurantID)
+		}
+	}
+	return rows.Err()
+}
+
+func (db *Database) GetUserByID(id int) (*User, error) {
+	defer observeQuery("GetUserByID", time.Now())
+	var u User
+	err := db.QueryRow(`
+		SELECT id, username, role, disabled, created_at
+		FROM users
+		WHERE id = $1
+	`, id).Scan(&u.ID, &u.Username, &u.Role, &u.Disabled, &u.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := db.attachUserRestaurants([]*User{&u}); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (db *Database) CreateUser(username, password string, role Role) (*User, error) {
+	defer observeQuery("CreateUser", time.Now())
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u := User{Username: username, Role: role, Restaurants: []int{}}
+	err = db.QueryRow(`
+		INSERT INTO users (username, password_hash, role)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, username, hash, role).Scan(&u.ID, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UpdateUser меняет роль и статус пользователя; при отключении завершает все его сессии
+func (db *Database) UpdateUser(u *User) error {
+	defer observeQuery("UpdateUser", time.Now())
+	result, err := db.Exec(`UPDATE users SET role = $1, disabled = $2 WHERE id = $3`, u.Role, u.Disabled, u.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	if u.Disabled {
+		return db.DeleteUserSessions(u.ID)
+	}
+	return nil
+}
+
+// SetUserRestaurants заменяет список ресторанов, в которых работает сотрудник
+func (db *Database) SetUserRestaurants(userID int, restaurantIDs []int) error {
+	defer observeQuery("SetUserRestaurants", time.Now())
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_restaurants WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("ошибка при изменении ресторанов пользователя: %v", err)
+	}
+	for _, id := range restaurantIDs {
+		if _, err := tx.Exec(`INSERT INTO user_restaurants (user_id, restaurant_id) VALUES ($1, $2)`, userID, id); err != nil {
+			return fmt.Errorf("ошибка при изменении ресторанов пользователя: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// SetUserPassword задает новый пароль и завершает все сессии пользователя
+func (db *Database) SetUserPassword(id int, password string) error {
+	defer observeQuery("SetUserPassword", time.Now())
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE users SET password_hash = $1 WHERE id = $2`, hash, id); err != nil {
+		return err
+	}
+	return db.DeleteUserSessions(id)
+}
+
+// CountActiveOwners возвращает число включенных учетных записей владельцев
+func (db *Database) CountActiveOwners() (int, error) {
+	defer observeQuery("CountActiveOwners", time.Now())
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE role = $1 AND disabled = false`, RoleOwner).Scan(&count)
+	return count, err
+}
+
+// ensureAdminUser создает владельца AdminUsername при первом запуске. Если пароль не задан
+// в конфигурации, он генерируется и выводится в журнал — только пока сотрудников еще нет.
+func ensureAdminUser() error {
+	password := config.AdminPassword
+	if password != "" {
+		return db.CreateAdminUser(config.AdminUsername, password)
+	}
+
+	users, err := db.GetUsers()
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return nil
+	}
+	password, _, err = newToken()
+	if err != nil {
+		return err
+	}
+	password = password[:16]
+	if err := db.CreateAdminUser(config.AdminUsername, password); err != nil {
+		return err
+	}
+	// Пароль выводится один раз в stderr мимо журнала, чтобы он не попал в собираемые логи
+	slog.Warn("Создан владелец со сгенерированным паролем, пароль выведен в stderr", "username", config.AdminUsername)
+	fmt.Fprintf(os.Stderr, "Пароль владельца %s: %s — сохраните его, повторно он не выводится\n", config.AdminUsername, password)
+	return nil
+}
+
+// resolveUserRestaurants проверяет рестораны, которые actor назначает сотруднику с ролью role.
+// Рестораны, к которым у actor нет доступа, сохраняются из текущего списка current без изменений.
+func resolveUserRestaurants(actor *User, role Role, requested, current []int) ([]int, error) {
+	result := []int{}
+	seen := map[int]bool{}
+	for _, id := range requested {
+		if seen[id] {
+			continue
+		}
+		if !actor.CanAccess(id) {
+			return nil, fmt.Errorf("нет доступа к ресторану %d", id)
+		}
+		if _, err := db.GetRestaurantByID(id); err != nil {
+			if errors.Is(err, errRestaurantNotFound) {
+				return nil, fmt.Errorf("ресторан %d не найден", id)
+			}
+			return nil, err
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	for _, id := range current {
+		if !seen[id] && !actor.CanAccess(id) {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	if role != RoleOwner && len(result) == 0 {
+		return nil, fmt.Errorf("сотруднику нужно назначить хотя бы один ресторан")
+	}
+	return result, nil
+}
+
+// visibleUsers возвращает пользователей, которых видит actor: сотрудники видят только коллег из своих ресторанов
+func visibleUsers(actor *User) ([]User, error) {
+	all, err := db.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	users := []User{}
+	for i := range all {
+		if all[i].ID == actor.ID || actor.sharesRestaurant(&all[i]) {
+			users = append(users, all[i])
+		}
+	}
+	return users, nil
+}
+
+func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := visibleUsers(currentUser(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении пользователей", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(users)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(r, "templates/admin/users.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона users.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.Execute(w, users); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона users.html", "error", err)
+		http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+	}
+}
+
+// createUserRequest — новый сотрудник; рестораны обязательны для всех ролей, кроме владельца
+type createUserRequest struct {
+	Username    string `json:"username" schema:"required"`
+	Password    string `json:"password" schema:"required"`
+	Role        Role   `json:"role" schema:"required,enum=role"`
+	Restaurants []int  `json:"restaurants"`
+}
+
+// updateUserRequest — изменение сотрудника; незаданные поля остаются прежними
+type updateUserRequest struct {
+	Role        *Role   `json:"role" schema:"enum=role"`
+	Disabled    *bool   `json:"disabled"`
+	Password    *string `json:"password"`
+	Restaurants *[]int  `json:"restaurants"`
+}
+
+func handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var data createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+		return
+	}
+
+	data.Username = strings.TrimSpace(data.Username)
+	if data.Username == "" || len(data.Username) > 50 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Имя пользователя должно содержать от 1 до 50 символов")
+		return
+	}
+	if len(data.Password) < 8 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Пароль должен содержать не менее 8 символов")
+		return
+	}
+	if !data.Role.Valid() {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Неизвестная роль")
+		return
+	}
+	// Назначать владельцев может только владелец
+	actor := currentUser(r)
+	if data.Role == RoleOwner && actor.Role != RoleOwner {
+		writeError(w, r, http.StatusForbidden, "forbidden", "Только владелец может назначать роль владельца")
+		return
+	}
+	restaurants, err := resolveUserRestaurants(actor, data.Role, data.Restaurants, nil)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+		return
+	}
+
+	user, err := db.CreateUser(data.Username, data.Password, data.Role)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при создании пользователя", "username", data.Username, "error", err)
+		if isUniqueViolation(err) {
+			writeError(w, r, http.StatusConflict, "duplicate_username", "Пользователь с таким именем уже существует")
+		} else {
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при создании пользователя")
+		}
+		return
+	}
+	if err := db.SetUserRestaurants(user.ID, restaurants); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при назначении ресторанов пользователю", "username", user.Username, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при создании пользователя")
+		return
+	}
+	user.Restaurants = restaurants
+
+	slog.InfoContext(r.Context(), "Пользователь создан", "actor", actor.Username, "username", user.Username, "role", user.Role, "restaurants", user.Restaurants)
+	writeCreated(w, r, user)
+}
+
+func handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var id int
+	if _, err := fmt.Sscanf(mux.Vars(r)["id"], "%d", &id); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Неверный формат ID")
+		return
+	}
+
+	var data updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+		return
+	}
+
+	user, err := db.GetUserByID(id)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			writeError(w, r, http.StatusNotFound, "not_found", "Пользователь не найден")
+		} else {
+			slog.ErrorContext(r.Context(), "Ошибка при получении пользователя", "user_id", id, "error", err)
+			writeInternalError(w, r)
+		}
+		return
+	}
+
+	actor := currentUser(r)
+	if user.ID != actor.ID && !actor.sharesRestaurant(user) {
+		writeError(w, r, http.StatusNotFound, "not_found", "Пользователь не найден")
+		return
+	}
+	wasActiveOwner := user.Role == RoleOwner && !user.Disabled
+
+	// Учетные записи владельцев может менять только владелец
+	if (user.Role == RoleOwner || (data.Role != nil && *data.Role == RoleOwner)) && actor.Role != RoleOwner {
+		writeError(w, r, http.StatusForbidden, "forbidden", "Только владелец может изменять учетные записи владельцев")
+		return
+	}
+	if data.Role != nil {
+		if !data.Role.Valid() {
+			writeError(w, r, http.StatusBadRequest, "validation_failed", "Неизвестная роль")
+			return
+		}
+		user.Role = *data.Role
+	}
+	if data.Disabled != nil {
+		if *data.Disabled && user.ID == actor.ID {
+			writeError(w, r, http.StatusBadRequest, "validation_failed", "Нельзя отключить собственную учетную запись")
+			return
+		}
+		user.Disabled = *data.Disabled
+	}
+	if data.Password != nil && len(*data.Password) < 8 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Пароль должен содержать не менее 8 символов")
+		return
+	}
+	if data.Restaurants != nil {
+		restaurants, err := resolveUserRestaurants(actor, user.Role, *data.Restaurants, user.Restaurants)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "validation_failed", err.Error())
+			return
+		}
+		user.Restaurants = restaurants
+	} else if user.Role != RoleOwner && len(user.Restaurants) == 0 {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Сотруднику нужно назначить хотя бы один ресторан")
+		return
+	}
+
+	// В системе должен остаться хотя бы один действующий владелец
+	if wasActiveOwner && (user.Role != RoleOwner || user.Disabled) {
+		owners, err := db.CountActiveOwners()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при подсчете владельцев", "error", err)
+			writeInternalError(w, r)
+			return
+		}
+		if owners <= 1 {
+			writeError(w, r, http.StatusConflict, "last_owner", "Нельзя отключить или понизить последнего владельца")
+			return
+		}
+	}
+
+	if err := db.UpdateUser(user); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при обновлении пользователя", "user_id", id, "error", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при обновлении пользователя")
+		return
+	}
+
+	if data.Restaurants != nil {
+		if err := db.SetUserRestaurants(user.ID, user.Restaurants); err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при назначении ресторанов пользователю", "user_id", id, "error", err)
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при обновлении пользователя")
+			return
+		}
+	}
+
+	if data.Password != nil {
+		if err := db.SetUserPassword(user.ID, *data.Password); err != nil {
+			slog.ErrorContext(r.Context(), "Ошибка при смене пароля пользователя", "user_id", id, "error", err)
+			writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при смене пароля")
+			return
+		}
+	}
+
+	slog.InfoContext(r.Context(), "Пользователь изменен", "actor", actor.Username, "username", user.Username, "role", user.Role, "disabled", user.Disabled, "restaurants", user.Restaurants)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
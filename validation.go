@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BookingError — ошибка проверки бронирования, текст которой можно показать гостю
+type BookingError struct {
+	Status  int
+	Message string
+	// Машиночитаемая причина отказа; если задана, ошибка отдается в формате JSON
+	Reason string
+	// Причина отказа для метрик (bad_phone, past_date и т.д.); клиенту не отдается
+	Cause string
+}
+
+func (e *BookingError) Error() string {
+	return e.Message
+}
+
+func newBookingError(status int, message string) *BookingError {
+	return &BookingError{Status: status, Message: message}
+}
+
+// withCause помечает ошибку причиной отказа для метрик
+func (e *BookingError) withCause(cause string) *BookingError {
+	e.Cause = cause
+	return e
+}
+
+// writeBookingError отправляет клиенту ошибку проверки с нужным статусом. API v1 получает
+// конверт с кодом ошибки, старые адреса — текст или, если у ошибки есть Reason, прежний JSON.
+func writeBookingError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var bookingErr *BookingError
+	if !errors.As(err, &bookingErr) {
+		return false
+	}
+	if isAPIRequest(r) || bookingErr.Reason == "" {
+		writeError(w, r, bookingErr.Status, bookingErr.code(), bookingErr.Message)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(bookingErr.Status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":  bookingErr.Message,
+		"reason": bookingErr.Reason,
+	})
+	return true
+}
+
+// normalizePhone оставляет в номере только цифры и приводит его к виду 7XXXXXXXXXX
+func normalizePhone(raw string) (string, error) {
+	phone := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, raw)
+
+	// Проверяем длину телефона
+	if len(phone) != 11 {
+		return "", newBookingError(http.StatusBadRequest, "Неверный формат телефона (должно быть 11 цифр)").withCause("bad_phone")
+	}
+
+	// Проверяем, что телефон начинается с 7 или 8
+	if phone[0] != '7' && phone[0] != '8' {
+		return "", newBookingError(http.StatusBadRequest, "Телефон должен начинаться с 7 или 8").withCause("bad_phone")
+	}
+
+	// Если телефон начинается с 8, заменяем на 7
+	if phone[0] == '8' {
+		phone = "7" + phone[1:]
+	}
+	return phone, nil
+}
+
+// normalizeEmail проверяет необязательный адрес почты гостя; пустой адрес допустим
+func normalizeEmail(raw string) (string, error) {
+	email := strings.TrimSpace(raw)
+	if email == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 254 {
+		return "", newBookingError(http.StatusBadRequest, "Неверный формат email").withCause("bad_email")
+	}
+	return email, nil
+}
+
+// parseBookingDate возвращает начало суток date по часовому поясу ресторана
+func parseBookingDate(date string) (time.Time, error) {
+	d, err := time.ParseInLocation("2006-01-02", date, config.Location)
+	if err != nil {
+		return time.Time{}, newBookingError(http.StatusBadRequest, "Неверный формат даты (должен быть YYYY-MM-DD)").withCause("bad_date")
+	}
+	return d, nil
+}
+
+// parseBookingTime возвращает время в формате HH:MM, отбрасывая секунды
+func parseBookingTime(timeStr string) (string, error) {
+	if len(timeStr) > 5 {
+		timeStr = timeStr[:5] // Берем только часы и минуты
+	}
+	if _, err := time.Parse("15:04", timeStr); err != nil {
+		return "", newBookingError(http.StatusBadRequest, "Неверный формат времени (должен быть HH:MM)").withCause("bad_time")
+	}
+	return timeStr, nil
+}
+
+// bookingStart возвращает момент начала визита: дата и время трактуются по часовому поясу ресторана
+func bookingStart(date, timeStr string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04", date+" "+timeStr, config.Location)
+}
+
+// restaurantToday возвращает начало текущих суток по часовому поясу ресторана
+func restaurantToday() time.Time {
+	y, m, d := time.Now().In(config.Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, config.Location)
+}
+
+func parseGuests(guests string) (int, error) {
+	n, err := strconv.Atoi(guests)
+	if err != nil || n < 1 {
+		return 0, newBookingError(http.StatusBadRequest, "Неверное количество гостей").withCause("bad_guests")
+	}
+	return n, nil
+}
+
+// validateBookingSlot проверяет, что на указанные дату, время и количество гостей в ресторане rest в принципе можно
+// забронировать столик. Используется и при создании бронирования, и при расчете свободных слотов.
+func validateBookingSlot(rest *Restaurant, date, timeStr string, guests int, schedule DaySchedule) error {
+	if guests > rest.MaxGuests {
+		return newBookingError(http.StatusBadRequest,
+			"Для компаний больше "+strconv.Itoa(rest.MaxGuests)+" человек бронирование возможно только по телефону").withCause("too_many_guests")
+	}
+
+	// Проверяем, что дата не в прошлом
+	bookingDate, err := parseBookingDate(date)
+	if err != nil {
+		return err
+	}
+	if bookingDate.Before(restaurantToday()) {
+		return newBookingError(http.StatusBadRequest, "Дата бронирования не может быть в прошлом").withCause("past_date")
+	}
+
+	start, err := bookingStart(date, timeStr)
+	if err != nil {
+		return newBookingError(http.StatusBadRequest, "Неверный формат времени (должен быть HH:MM)").withCause("bad_time")
+	}
+	if start.Before(time.Now()) {
+		return newBookingError(http.StatusBadRequest, "Время бронирования уже прошло").withCause("past_time")
+	}
+
+	// Визит должен укладываться в часы работы ресторана
+	return schedule.checkSlot(timeStr, rest.DiningDuration())
+}
@@ -0,0 +1,766 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Статусы заявки в листе ожидания
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistOffered   = "offered"
+	WaitlistClaimed   = "claimed"
+	WaitlistExpired   = "expired"
+	WaitlistCancelled = "cancelled"
+)
+
+var waitlistStatusTitles = map[string]string{
+	WaitlistWaiting:   "Ожидает",
+	WaitlistOffered:   "Место предложено",
+	WaitlistClaimed:   "Забронировано",
+	WaitlistExpired:   "Истекла",
+	WaitlistCancelled: "Снята",
+}
+
+var ErrDuplicateWaitlist = errors.New("на эту дату вы уже стоите в листе ожидания")
+
+var errWaitlistEntryNotFound = errors.New("заявка не найдена")
+
+// WaitlistEntry — заявка гостя на столик, если подходящего свободного времени нет.
+// Гость готов начать визит в любой момент окна TimeFrom–TimeTo.
+type WaitlistEntry struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Phone    string    `json:"phone"`
+	Email    string    `json:"email"`
+	Date     string    `json:"date"` // Дата и окно по часовому поясу ресторана
+	TimeFrom string    `json:"time_from"`
+	TimeTo   string    `json:"time_to"`
+	Guests   int       `json:"guests"`
+	Comments string    `json:"comments"`
+	Status   string    `json:"status"`
+	Created  time.Time `json:"created"`
+
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+
+	// Предложенное освободившееся время и срок, до которого его можно забрать
+	OfferedStart   *time.Time `json:"offered_start,omitempty"`
+	OfferExpiresAt *time.Time `json:"offer_expires_at,omitempty"`
+	// Бронирование, созданное по предложению
+	BookingID *int `json:"booking_id,omitempty"`
+
+	// Место в очереди своей смены; считается только для ожидающих заявок
+	Rank int `json:"rank,omitempty"`
+
+	// Ресторан заявки и его название
+	RestaurantID int    `json:"restaurant_id"`
+	Restaurant   string `json:"restaurant"`
+}
+
+// offerActive сообщает, что предложение еще можно принять
+func (e *WaitlistEntry) offerActive(now time.Time) bool {
+	return e.Status == WaitlistOffered && e.OfferExpiresAt != nil && e.OfferExpiresAt.After(now)
+}
+
+// WaitlistStore — лист ожидания. Освободившееся при отмене бронирования место хранилище
+// само предлагает первой подходящей заявке в той же транзакции, что и отмену.
+type WaitlistStore interface {
+	CreateWaitlistEntry(e *WaitlistEntry) error
+	GetWaitlist(restaurantID int, date string) ([]WaitlistEntry, error)
+	GetWaitlistOffer(token string) (*WaitlistEntry, error)
+	// ClaimWaitlistOffer создает бронирование по предложению и в той же транзакции отмечает
+	// заявку принятой; если предложение уже принято или истекло — ErrStatusChanged
+	ClaimWaitlistOffer(id int, booking *Booking, actor BookingActor) error
+	CancelWaitlistEntry(restaurantID, id int) error
+	// ExpireWaitlist закрывает заявки, окно которых прошло, и непринятые предложения;
+	// место из непринятого предложения переходит следующей заявке
+	ExpireWaitlist(now time.Time) (int, error)
+}
+
+// offerDeadline — до какого момента действует предложение места, начинающегося в start
+func offerDeadline(start, now time.Time) time.Time {
+	deadline := now.Add(config.WaitlistClaimTTL)
+	if deadline.After(start) {
+		deadline = start
+	}
+	return deadline
+}
+
+// pickWaitlistEntry выбирает первую по очереди заявку, компанию из которой можно посадить в [start, end).
+// Столики под действующие предложения другим заявкам уже учтены в occupancies.
+func pickWaitlistEntry(candidates []WaitlistEntry, tables []Table, occupancies []tableOccupancy, start, end time.Time) *WaitlistEntry {
+	busy := busyAt(occupancies, start, end)
+	for i := range candidates {
+		if assignTables(tables, busy, candidates[i].Guests) != nil {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+// offerHolds придерживает столики под действующие предложения (визиты длительностью duration),
+// пока приглашенный гость не забрал место или не истекла ссылка. Предложения идут в порядке начала визита.
+func offerHolds(offers []WaitlistEntry, tables []Table, occupancies []tableOccupancy, duration time.Duration) []tableOccupancy {
+	var holds []tableOccupancy
+	for _, o := range offers {
+		start, end := *o.OfferedStart, o.OfferedStart.Add(duration)
+		busy := busyAt(occupancies, start, end)
+		for id := range busyAt(holds, start, end) {
+			busy[id] = true
+		}
+		for _, t := range assignTables(tables, busy, o.Guests) {
+			holds = append(holds, tableOccupancy{TableID: t.ID, Start: start, End: end})
+		}
+	}
+	return holds
+}
+
+// liveOffers возвращает действующие предложения ресторана, визиты которых пересекаются с [from, to),
+// кроме предложения заявки claimID, и длительность визита в ресторане
+func liveOffers(q queryer, restaurantID int, from, to time.Time, claimID int) ([]WaitlistEntry, time.Duration, error) {
+	var diningMinutes int
+	if err := q.QueryRow(`SELECT dining_minutes FROM restaurants WHERE id = $1`, restaurantID).Scan(&diningMinutes); err != nil {
+		return nil, 0, fmt.Errorf("ошибка при получении ресторана %d: %v", restaurantID, err)
+	}
+	duration := time.Duration(diningMinutes) * time.Minute
+
+	entries, err := queryWaitlist(q, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE status = $1 AND restaurant_id = $2 AND offer_expires_at > $3 AND offered_start < $4 AND id != $5
+		ORDER BY offered_start, id
+	`, WaitlistOffered, restaurantID, dbTime(time.Now()), dbTime(to), claimID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var offers []WaitlistEntry
+	for _, e := range entries {
+		if e.OfferedStart.Add(duration).After(from) {
+			offers = append(offers, e)
+		}
+	}
+	return offers, duration, nil
+}
+
+// waitlistOfferNotifications готовит сообщение гостю со ссылкой, по которой можно забрать место
+func waitlistOfferNotifications(e *WaitlistEntry, token string) ([]Notification, error) {
+	start := e.OfferedStart.In(config.Location)
+	booking := &Booking{
+		Name:     e.Name,
+		Phone:    e.Phone,
+		Email:    e.Email,
+		Date:     start.Format("2006-01-02"),
+		Time:     start.Format("15:04"),
+		Guests:   strconv.Itoa(e.Guests),
+		StartsAt: start,
+
+		RestaurantID: e.RestaurantID,
+		Restaurant:   e.Restaurant,
+	}
+	batch, err := renderNotifications(NotifyWaitlistOffer, notificationData{
+		Booking:   booking,
+		ClaimURL:  siteURL("/waitlist/claim/" + token),
+		ExpiresAt: e.OfferExpiresAt.In(config.Location),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range batch {
+		batch[i].WaitlistID = e.ID
+	}
+	return batch, nil
+}
+
+const waitlistColumns = `id, name, phone, email, window_start, window_end, guests, comments, status,
+	offered_start, offer_expires_at, booking_id, created_at,
+	restaurant_id, (SELECT name FROM restaurants WHERE restaurants.id = waitlist_entries.restaurant_id)`
+
+// scanWaitlistEntry читает заявку; дата и окно выводятся из моментов по часовому поясу ресторана
+func scanWaitlistEntry(row rowScanner, e *WaitlistEntry) error {
+	err := row.Scan(&e.ID, &e.Name, &e.Phone, &e.Email, &e.WindowStart, &e.WindowEnd, &e.Guests, &e.Comments,
+		&e.Status, &e.OfferedStart, &e.OfferExpiresAt, &e.BookingID, &e.Created, &e.RestaurantID, &e.Restaurant)
+	if err != nil {
+		return err
+	}
+	e.WindowStart = e.WindowStart.In(config.Location)
+	e.WindowEnd = e.WindowEnd.In(config.Location)
+	e.Date = e.WindowStart.Format("2006-01-02")
+	e.TimeFrom = e.WindowStart.Format("15:04")
+	e.TimeTo = e.WindowEnd.Format("15:04")
+	e.Created = e.Created.In(config.Location)
+	e.OfferedStart = inRestaurantZone(e.OfferedStart)
+	e.OfferExpiresAt = inRestaurantZone(e.OfferExpiresAt)
+	return nil
+}
+
+func queryWaitlist(q queryer, query string, args ...interface{}) ([]WaitlistEntry, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении листа ожидания: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var e WaitlistEntry
+		if err := scanWaitlistEntry(rows, &e); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении заявки листа ожидания: %v", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (db *Database) CreateWaitlistEntry(e *WaitlistEntry) error {
+	defer observeQuery("CreateWaitlistEntry", time.Now())
+	err := db.QueryRow(`
+		INSERT INTO waitlist_entries (name, phone, email, booking_date, window_start, window_end, guests, comments, restaurant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, e.Name, e.Phone, e.Email, e.Date, dbTime(e.WindowStart), dbTime(e.WindowEnd), e.Guests, e.Comments, e.RestaurantID).Scan(&e.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrDuplicateWaitlist
+		}
+		return err
+	}
+	e.Status = WaitlistWaiting
+	return nil
+}
+
+func (db *Database) GetWaitlist(restaurantID int, date string) ([]WaitlistEntry, error) {
+	defer observeQuery("GetWaitlist", time.Now())
+	return queryWaitlist(db, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE restaurant_id = $1 AND booking_date = $2
+		ORDER BY created_at, id
+	`, restaurantID, date)
+}
+
+// GetWaitlistOffer находит заявку по токену ссылки из предложения; nil, если ссылка неверна
+func (db *Database) GetWaitlistOffer(token string) (*WaitlistEntry, error) {
+	defer observeQuery("GetWaitlistOffer", time.Now())
+	if token == "" {
+		return nil, nil
+	}
+	var e WaitlistEntry
+	row := db.QueryRow(`SELECT `+waitlistColumns+` FROM waitlist_entries WHERE claim_token_hash = $1`, hashToken(token))
+	if err := scanWaitlistEntry(row, &e); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (db *Database) ClaimWaitlistOffer(id int, booking *Booking, actor BookingActor) error {
+	defer observeQuery("ClaimWaitlistOffer", time.Now())
+	return db.createBooking(booking, actor, id)
+}
+
+// CancelWaitlistEntry снимает заявку ресторана; если ей было предложено место, оно переходит следующей
+func (db *Database) CancelWaitlistEntry(restaurantID, id int) error {
+	defer observeQuery("CancelWaitlistEntry", time.Now())
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var e WaitlistEntry
+	row := tx.QueryRow(`SELECT `+waitlistColumns+` FROM waitlist_entries WHERE id = $1 AND restaurant_id = $2`, id, restaurantID)
+	if err := scanWaitlistEntry(row, &e); err != nil {
+		if err == sql.ErrNoRows {
+			return errWaitlistEntryNotFound
+		}
+		return err
+	}
+	result, err := tx.Exec(`
+		UPDATE waitlist_entries SET status = $1
+		WHERE id = $2 AND status = $3
+	`, WaitlistCancelled, id, e.Status)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 || (e.Status != WaitlistWaiting && e.Status != WaitlistOffered) {
+		return ErrStatusChanged
+	}
+	if e.Status == WaitlistOffered && e.OfferedStart != nil {
+		if err := db.offerSlot(tx, e.RestaurantID, e.Date, *e.OfferedStart); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (db *Database) ExpireWaitlist(now time.Time) (int, error) {
+	defer observeQuery("ExpireWaitlist", time.Now())
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE waitlist_entries SET status = $1
+		WHERE status = $2 AND window_end < $3
+	`, WaitlistExpired, WaitlistWaiting, dbTime(now))
+	if err != nil {
+		return 0, fmt.Errorf("ошибка закрытия заявок листа ожидания: %v", err)
+	}
+	n, _ := result.RowsAffected()
+	expired := int(n)
+
+	offers, err := queryWaitlist(tx, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE status = $1 AND offer_expires_at <= $2
+		ORDER BY offer_expires_at, id
+	`, WaitlistOffered, dbTime(now))
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range offers {
+		if _, err := tx.Exec(`UPDATE waitlist_entries SET status = $1 WHERE id = $2`, WaitlistExpired, e.ID); err != nil {
+			return 0, fmt.Errorf("ошибка закрытия предложения %d: %v", e.ID, err)
+		}
+		expired++
+		if err := db.offerSlot(tx, e.RestaurantID, e.Date, *e.OfferedStart); err != nil {
+			return 0, err
+		}
+	}
+	return expired, tx.Commit()
+}
+
+// offerSlot предлагает место ресторана с началом в start первой подходящей заявке на дату и ставит ей уведомление.
+// Вызывается в транзакции, которая это место освободила.
+func (db *Database) offerSlot(tx *sql.Tx, restaurantID int, date string, start time.Time) error {
+	now := time.Now()
+	if !start.After(now) {
+		return nil
+	}
+	var diningMinutes int
+	if err := tx.QueryRow(`SELECT dining_minutes FROM restaurants WHERE id = $1`, restaurantID).Scan(&diningMinutes); err != nil {
+		return fmt.Errorf("ошибка при получении ресторана %d: %v", restaurantID, err)
+	}
+	duration := time.Duration(diningMinutes) * time.Minute
+	end := start.Add(duration)
+
+	candidates, err := queryWaitlist(tx, `
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries
+		WHERE status = $1 AND restaurant_id = $2 AND booking_date = $3 AND window_start <= $4 AND window_end >= $4
+		ORDER BY created_at, id
+	`, WaitlistWaiting, restaurantID, date, dbTime(start))
+	if err != nil || len(candidates) == 0 {
+		return err
+	}
+	tables, err := queryTables(tx, restaurantID)
+	if err != nil {
+		return err
+	}
+	occupancies, err := tableOccupancies(tx, restaurantID, start, end, 0, 0)
+	if err != nil {
+		return err
+	}
+	entry := pickWaitlistEntry(candidates, tables, occupancies, start, end)
+	if entry == nil {
+		return nil
+	}
+
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return err
+	}
+	expires := offerDeadline(start, now)
+	_, err = tx.Exec(`
+		UPDATE waitlist_entries
+		SET status = $1, offered_start = $2, offer_expires_at = $3, claim_token_hash = $4
+		WHERE id = $5
+	`, WaitlistOffered, dbTime(start), dbTime(expires), tokenHash, entry.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка записи предложения из листа ожидания: %v", err)
+	}
+	entry.Status = WaitlistOffered
+	entry.OfferedStart, entry.OfferExpiresAt = &start, &expires
+
+	slog.Info("Место предложено заявке из листа ожидания", "waitlist_id", entry.ID, "slot", start.In(config.Location).Format("2006-01-02 15:04"))
+	batch, err := waitlistOfferNotifications(entry, token)
+	if err != nil {
+		slog.Error("Уведомление по заявке не отправлено", "waitlist_id", entry.ID, "error", err)
+		return nil
+	}
+	return insertNotifications(tx, batch)
+}
+
+// waitlistService — заявки одной смены (периода работы) в порядке очереди
+type waitlistService struct {
+	Name    string          `json:"name"`
+	Open    string          `json:"open,omitempty"`
+	Close   string          `json:"close,omitempty"`
+	Entries []WaitlistEntry `json:"entries"`
+}
+
+// groupWaitlist раскладывает заявки по сменам дня по началу окна и нумерует ожидающие
+func groupWaitlist(entries []WaitlistEntry, periods []ServicePeriod) []waitlistService {
+	services := make([]waitlistService, 0, len(periods)+1)
+	for _, p := range periods {
+		services = append(services, waitlistService{Name: p.Name, Open: p.Open, Close: p.Close, Entries: []WaitlistEntry{}})
+	}
+	other := waitlistService{Name: "Вне часов работы", Entries: []WaitlistEntry{}}
+
+	for _, e := range entries {
+		from := minutesOf(e.TimeFrom)
+		placed := false
+		for i, p := range periods {
+			open, close := p.bounds()
+			if from >= open && from < close {
+				services[i].Entries = append(services[i].Entries, e)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			other.Entries = append(other.Entries, e)
+		}
+	}
+	if len(other.Entries) > 0 {
+		services = append(services, other)
+	}
+
+	for i := range services {
+		rank := 0
+		for j := range services[i].Entries {
+			if services[i].Entries[j].Status == WaitlistWaiting {
+				rank++
+				services[i].Entries[j].Rank = rank
+			}
+		}
+	}
+	return services
+}
+
+// waitlistRequest — заявка гостя в лист ожидания
+type waitlistRequest struct {
+	Name     string `json:"name" schema:"required"`
+	Phone    string `json:"phone" schema:"required"`
+	Email    string `json:"email"`
+	Date     string `json:"date" schema:"required,format=date"`
+	TimeFrom string `json:"time_from" schema:"required,format=time"`
+	TimeTo   string `json:"time_to" schema:"required,format=time"`
+	Guests   string `json:"guests" schema:"required,format=integer"`
+	Comments string `json:"comments"`
+}
+
+// waitlistJoined — ответ о новой заявке в листе ожидания
+type waitlistJoined struct {
+	Message string `json:"message"`
+	ID      int    `json:"id"`
+}
+
+// handleJoinWaitlist ставит гостя в лист ожидания на дату и окно времени
+func handleJoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	var data waitlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_json", "Ошибка при разборе данных")
+		return
+	}
+	if data.Name == "" || data.Phone == "" || data.Date == "" || data.TimeFrom == "" || data.TimeTo == "" || data.Guests == "" {
+		writeError(w, r, http.StatusBadRequest, "validation_failed", "Все обязательные поля должны быть заполнены")
+		return
+	}
+
+	phone, err := normalizePhone(data.Phone)
+	if err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	email, err := normalizeEmail(data.Email)
+	if err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	if _, err := parseBookingDate(data.Date); err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	timeFrom, err := parseBookingTime(data.TimeFrom)
+	if err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	timeTo, err := parseBookingTime(data.TimeTo)
+	if err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	guests, err := parseGuests(data.Guests)
+	if err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+	rest := currentRestaurant(r)
+	if guests > rest.MaxGuests {
+		writeBookingError(w, r, newBookingError(http.StatusBadRequest,
+			"Для компаний больше "+strconv.Itoa(rest.MaxGuests)+" человек бронирование возможно только по телефону"))
+		return
+	}
+
+	windowStart, _ := bookingStart(data.Date, timeFrom)
+	windowEnd, _ := bookingStart(data.Date, timeTo)
+	if windowEnd.Before(windowStart) {
+		writeBookingError(w, r, newBookingError(http.StatusBadRequest, "Конец окна не может быть раньше начала"))
+		return
+	}
+	if !windowEnd.After(time.Now()) {
+		writeBookingError(w, r, newBookingError(http.StatusBadRequest, "Выбранное время уже прошло"))
+		return
+	}
+
+	schedule, err := db.GetDaySchedule(rest.ID, data.Date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении расписания", "date", data.Date, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	if schedule.Closed {
+		writeBookingError(w, r, closedError("holiday", "Ресторан закрыт: "+schedule.Reason))
+		return
+	}
+	if len(schedule.Periods) == 0 {
+		writeBookingError(w, r, closedError("closed_day", "Ресторан не работает в этот день"))
+		return
+	}
+
+	entry := WaitlistEntry{
+		Name:        data.Name,
+		Phone:       phone,
+		Email:       email,
+		Date:        data.Date,
+		TimeFrom:    timeFrom,
+		TimeTo:      timeTo,
+		Guests:      guests,
+		Comments:    data.Comments,
+		WindowStart: windowStart,
+		WindowEnd:   windowEnd,
+
+		RestaurantID: rest.ID,
+		Restaurant:   rest.Name,
+	}
+	if err := db.CreateWaitlistEntry(&entry); err != nil {
+		if errors.Is(err, ErrDuplicateWaitlist) {
+			slog.InfoContext(r.Context(), "Повторная заявка в лист ожидания", "restaurant", rest.Slug, "date", entry.Date)
+			writeError(w, r, http.StatusConflict, "duplicate_waitlist", ErrDuplicateWaitlist.Error())
+			return
+		}
+		slog.ErrorContext(r.Context(), "Ошибка при добавлении в лист ожидания", "error", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при добавлении в лист ожидания")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Заявка добавлена в лист ожидания", "waitlist_id", entry.ID, "restaurant", rest.Slug, "date", entry.Date, "from", timeFrom, "to", timeTo, "guests", guests)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(waitlistJoined{
+		Message: "Вы в листе ожидания. Если место освободится, мы пришлем ссылку для бронирования",
+		ID:      entry.ID,
+	})
+}
+
+// waitlistOffer загружает заявку по токену из адреса; при ошибке сам отвечает клиенту
+func waitlistOffer(w http.ResponseWriter, r *http.Request) (*WaitlistEntry, bool) {
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	entry, err := db.GetWaitlistOffer(mux.Vars(r)["token"])
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении предложения из листа ожидания", "error", err)
+		writeInternalError(w, r)
+		return nil, false
+	}
+	if entry == nil {
+		writeError(w, r, http.StatusNotFound, "not_found", "Предложение не найдено. Проверьте ссылку.")
+		return nil, false
+	}
+	return entry, true
+}
+
+func handleWaitlistClaimPage(w http.ResponseWriter, r *http.Request) {
+	entry, ok := waitlistOffer(w, r)
+	if !ok {
+		return
+	}
+
+	rest, err := db.GetRestaurantByID(entry.RestaurantID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении ресторана", "restaurant_id", entry.RestaurantID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(withRestaurant(r, rest), "templates/waitlist_claim.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона waitlist_claim.html", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	data := struct {
+		Entry      *WaitlistEntry
+		Restaurant *Restaurant
+		Active     bool
+		Token      string
+	}{entry, rest, entry.offerActive(time.Now()), mux.Vars(r)["token"]}
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона waitlist_claim.html", "error", err)
+		writeInternalError(w, r)
+	}
+}
+
+// handleClaimWaitlist превращает предложение из листа ожидания в бронирование
+func handleClaimWaitlist(w http.ResponseWriter, r *http.Request) {
+	entry, ok := waitlistOffer(w, r)
+	if !ok {
+		return
+	}
+	if !entry.offerActive(time.Now()) {
+		writeBookingError(w, r, &BookingError{
+			Status:  http.StatusGone,
+			Message: "Предложение больше не действует",
+			Reason:  "offer_expired",
+		})
+		return
+	}
+
+	rest, err := db.GetRestaurantByID(entry.RestaurantID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении ресторана", "restaurant_id", entry.RestaurantID, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	start := entry.OfferedStart.In(config.Location)
+	booking := Booking{
+		Name:     entry.Name,
+		Phone:    entry.Phone,
+		Email:    entry.Email,
+		Date:     start.Format("2006-01-02"),
+		Time:     start.Format("15:04"),
+		Guests:   strconv.Itoa(entry.Guests),
+		Comments: entry.Comments,
+		Status:   StatusPending,
+		Duration: rest.DiningMinutes,
+
+		RestaurantID: rest.ID,
+		Restaurant:   rest.Name,
+	}
+	if err := db.ClaimWaitlistOffer(entry.ID, &booking, requestActor(r)); err != nil {
+		switch {
+		case errors.Is(err, ErrStatusChanged):
+			writeBookingError(w, r, &BookingError{
+				Status:  http.StatusGone,
+				Message: "Предложение больше не действует",
+				Reason:  "offer_expired",
+			})
+		case errors.Is(err, ErrNoTableAvailable):
+			writeError(w, r, http.StatusConflict, "no_table_available", "К сожалению, это время уже заняли")
+		default:
+			if !writeBookingConflict(w, r, err) {
+				slog.ErrorContext(r.Context(), "Ошибка при бронировании по заявке", "waitlist_id", entry.ID, "error", err)
+				writeError(w, r, http.StatusInternalServerError, "internal_error", "Ошибка при создании бронирования")
+				return
+			}
+		}
+		slog.InfoContext(r.Context(), "Бронирование по заявке отклонено", "waitlist_id", entry.ID, "reason", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Бронирование создано по заявке из листа ожидания", "booking_id", booking.ID, "waitlist_id", entry.ID)
+	recordBookingCreated(&booking, "waitlist")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newBookingCreated(&booking))
+}
+
+func handleAdminWaitlist(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = restaurantToday().Format("2006-01-02")
+	}
+	if _, err := parseBookingDate(date); err != nil {
+		writeBookingError(w, r, err)
+		return
+	}
+
+	restaurantID := currentRestaurant(r).ID
+	entries, err := db.GetWaitlist(restaurantID, date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении листа ожидания", "date", date, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	schedule, err := db.GetDaySchedule(restaurantID, date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при получении расписания", "date", date, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	services := groupWaitlist(entries, schedule.Periods)
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(services)
+		return
+	}
+
+	tmpl, err := createTemplateWithFuncs(r, "templates/admin/waitlist.html")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при загрузке шаблона waitlist.html", "error", err)
+		writeInternalError(w, r)
+		return
+	}
+	data := struct {
+		Date     string
+		Services []waitlistService
+	}{date, services}
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Ошибка при рендеринге шаблона waitlist.html", "error", err)
+		writeInternalError(w, r)
+	}
+}
+
+func handleCancelWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_id", "Неверный формат ID")
+		return
+	}
+
+	if err := db.CancelWaitlistEntry(currentRestaurant(r).ID, id); err != nil {
+		if errors.Is(err, errWaitlistEntryNotFound) {
+			writeError(w, r, http.StatusNotFound, "not_found", "Заявка не найдена")
+			return
+		}
+		if errors.Is(err, ErrStatusChanged) {
+			writeError(w, r, http.StatusConflict, "status_changed", "Заявка уже закрыта")
+			return
+		}
+		slog.ErrorContext(r.Context(), "Ошибка при снятии заявки", "waitlist_id", id, "error", err)
+		writeInternalError(w, r)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Заявка снята из листа ожидания", "waitlist_id", id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Заявка снята"})
+}